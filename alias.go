@@ -0,0 +1,62 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// genreAliases maps from friendly genre names to keys in discover.Genres.
+// Additional aliases can be supplied via -genre-alias.
+var genreAliases = map[string]string{
+	"hiphop":     "hip-hop-rap",
+	"hip-hop":    "hip-hop-rap",
+	"rap":        "hip-hop-rap",
+	"rnb":        "r-b-soul",
+	"r&b":        "r-b-soul",
+	"randb":      "r-b-soul",
+	"soul":       "r-b-soul",
+	"spoken":     "spoken-word",
+	"spokenword": "spoken-word",
+	"children":   "kids",
+	"gospel":     "devotional",
+	"ost":        "soundtrack",
+}
+
+// resolveGenreAlias returns the canonical genre for genre if it is an alias
+// from genreAliases (ignoring case). Otherwise, genre is returned unchanged and
+// ok is false.
+func resolveGenreAlias(genre string) (canon string, ok bool) {
+	key := strings.ToLower(genre)
+	if _, known := discover.Genres[key]; known {
+		return genre, false
+	}
+	if canon, ok = genreAliases[key]; ok {
+		return canon, true
+	}
+	return genre, false
+}
+
+// aliasFlag implements flag.Value for -genre-alias, adding each "alias=genre"
+// value to genreAliases.
+type aliasFlag struct{}
+
+func (aliasFlag) String() string { return "" }
+
+func (aliasFlag) Set(v string) error {
+	alias, genre, ok := strings.Cut(v, "=")
+	alias = strings.ToLower(strings.TrimSpace(alias))
+	genre = strings.ToLower(strings.TrimSpace(genre))
+	if !ok || alias == "" || genre == "" {
+		return fmt.Errorf("%q should be alias=genre", v)
+	}
+	if _, known := discover.Genres[genre]; !known {
+		return fmt.Errorf("unknown genre %q", genre)
+	}
+	genreAliases[alias] = genre
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import "testing"
+
+func TestResolveGenreAlias(t *testing.T) {
+	for _, tc := range []struct {
+		genre  string
+		want   string
+		wantOK bool
+	}{
+		{"hiphop", "hip-hop-rap", true},
+		{"rap", "hip-hop-rap", true},
+		{"rnb", "r-b-soul", true},
+		{"r&b", "r-b-soul", true},
+		{"soul", "r-b-soul", true},
+		{"ost", "soundtrack", true},
+		{"HipHop", "hip-hop-rap", true},
+		{"R&B", "r-b-soul", true},
+		{"rock", "rock", false}, // already canonical
+		{"hip-hop-rap", "hip-hop-rap", false},
+		{"Rock", "Rock", false},
+		{"polka", "polka", false}, // unknown
+		{"", "", false},
+	} {
+		if got, ok := resolveGenreAlias(tc.genre); got != tc.want || ok != tc.wantOK {
+			t.Errorf("resolveGenreAlias(%q) = %q, %v; want %q, %v", tc.genre, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+func TestAliasFlag(t *testing.T) {
+	defer func() { delete(genreAliases, "idm") }()
+
+	var f aliasFlag
+	if err := f.Set(" IDM = Electronic "); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, ok := resolveGenreAlias("idm"); got != "electronic" || !ok {
+		t.Errorf("resolveGenreAlias(%q) = %q, %v; want %q, true", "idm", got, ok, "electronic")
+	}
+	for _, v := range []string{"idm", "=rock", "idm=", "idm=polka"} {
+		if err := f.Set(v); err == nil {
+			t.Errorf("Set(%q) unexpectedly succeeded", v)
+		}
+	}
+}
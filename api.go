@@ -0,0 +1,113 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// apiDiscoverPath is the path of the JSON API endpoint served by the "serve"
+// command.
+const apiDiscoverPath = "/api/discover"
+
+// maxAPIPages is the maximum number of pages that can be requested via the
+// "pages" parameter, to keep a single request from sending many upstream
+// requests.
+const maxAPIPages = 10
+
+// apiServer is an http.Handler that serves Discover results as JSON.
+// Requests look like "/api/discover?genre=electronic/techno&ranking=new&page=1".
+type apiServer struct {
+	client *discover.Client
+	query  discover.Query // defaults for unspecified parameters
+}
+
+func (as *apiServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	q, err := as.parseQuery(req.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	results, err := as.client.Fetch(req.Context(), q)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed fetching %v: %v\n", genreLabel(q.Genre, q.Subgenre), err)
+		writeAPIError(w, http.StatusBadGateway, "failed fetching results")
+		return
+	}
+	if results == nil {
+		results = []discover.Result{} // write "[]" rather than "null"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// parseQuery returns a query built from URL parameters. "genre" may also
+// contain a subgenre, e.g. "electronic/techno".
+func (as *apiServer) parseQuery(vals url.Values) (discover.Query, error) {
+	q := as.query
+	q.Genre = "all"
+	if v := vals.Get("genre"); v != "" {
+		var err error
+		if q.Genre, q.Subgenre, err = discover.ParseGenreSpec(v); err != nil {
+			return q, err
+		}
+	}
+	if v := vals.Get("subgenre"); v != "" {
+		if q.Subgenre != "" {
+			return q, fmt.Errorf("subgenre %q already supplied in genre", q.Subgenre)
+		}
+		q.Subgenre = v
+	}
+	if canon, ok := resolveGenreAlias(q.Genre); ok {
+		q.Genre = canon
+	}
+	if err := discover.CheckGenre(q.Genre, q.Subgenre); err != nil {
+		return q, err
+	}
+
+	for name, dst := range map[string]*string{"ranking": &q.Ranking, "format": &q.Format, "type": &q.Type} {
+		if v := vals.Get(name); v != "" {
+			*dst = v
+		}
+	}
+	for name, dst := range map[string]*int{"page": &q.Page, "pages": &q.Pages, "limit": &q.Limit, "week": &q.Week} {
+		if v := vals.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return q, fmt.Errorf("bad %v %q", name, v)
+			}
+			*dst = n
+		}
+	}
+	if v := vals.Get("location"); v != "" {
+		var err error
+		if q.Location, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return q, fmt.Errorf("bad location %q", v)
+		}
+	}
+	if q.Pages < 1 || q.Pages > maxAPIPages {
+		return q, fmt.Errorf("pages must be between 1 and %d", maxAPIPages)
+	}
+	return q, q.Validate()
+}
+
+// writeAPIError writes a JSON object containing msg as an "error" property.
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{msg})
+}
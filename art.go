@@ -0,0 +1,115 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// maxArtNameLen is the maximum length in bytes of the names of files written
+// by downloadArt, excluding the extension.
+const maxArtNameLen = 200
+
+// downloadArt saves the cover art of results to files in dir, with at most
+// concurrency requests issued simultaneously. Results without art and
+// existing files are skipped. The number of downloaded files is returned,
+// along with errors for individual results.
+func downloadArt(ctx context.Context, client *discover.Client, results []discover.Result,
+	dir string, concurrency int) (int, []error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, []error{err}
+	}
+
+	var saved int
+	var errs []error
+	var mu sync.Mutex // protects saved and errs
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	names := make(map[string]struct{})
+	for i := range results {
+		r := &results[i]
+		if r.ArtID == 0 {
+			continue
+		}
+		name := artFileName(r)
+		if _, ok := names[name]; ok {
+			name = strings.TrimSuffix(name, ".jpg") + fmt.Sprintf(" (%d).jpg", r.ArtID)
+		}
+		names[name] = struct{}{}
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+			err := saveArt(ctx, client, r, p)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%v: %v", r.URL, err))
+			} else {
+				saved++
+			}
+		}()
+	}
+	wg.Wait()
+	return saved, errs
+}
+
+// saveArt writes r's cover art to p.
+func saveArt(ctx context.Context, client *discover.Client, r *discover.Result, p string) error {
+	// Write to a temp file and rename it to avoid leaving partial files.
+	f, err := os.CreateTemp(filepath.Dir(p), ".art-")
+	if err != nil {
+		return err
+	}
+	if err := client.WriteArt(ctx, r, f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// artFileName returns a filename like "Artist - Album.jpg" for r's cover art.
+// Characters that are problematic in filenames are replaced.
+func artFileName(r *discover.Result) string {
+	name := strings.Map(func(ch rune) rune {
+		if unicode.IsControl(ch) || strings.ContainsRune(`<>:"/\|?*`, ch) {
+			return '_'
+		}
+		return ch
+	}, r.Artist+" - "+r.Album)
+	// Leading dots would hide files, and Windows disallows trailing dots and spaces.
+	name = strings.Trim(name, ". ")
+	for len(name) > maxArtNameLen {
+		_, n := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-n]
+	}
+	if name == "" || name == "-" {
+		name = fmt.Sprint(r.ArtID)
+	}
+	return name + ".jpg"
+}
@@ -0,0 +1,144 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// batchSpec describes a single query in a -batch file.
+type batchSpec struct {
+	Genre    string `json:"genre"`
+	Subgenre string `json:"subgenre,omitempty"`
+	Ranking  string `json:"ranking,omitempty"`
+	Format   string `json:"format,omitempty"`
+	Type     string `json:"type,omitempty"`  // "album" if empty
+	Limit    int    `json:"limit,omitempty"` // 0 for no limit
+}
+
+// readBatchFile reads a JSON array of batchSpec objects from the file at p.
+func readBatchFile(p string) ([]batchSpec, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var specs []batchSpec
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&specs); err != nil {
+		return nil, fmt.Errorf("%v: %v", p, err)
+	}
+	return specs, nil
+}
+
+// query validates s and returns the corresponding query.
+// Default values are used for empty fields.
+func (s *batchSpec) query() (discover.Query, error) {
+	q := discover.Query{Ranking: s.Ranking, Format: s.Format, Type: s.Type}
+	if s.Genre == "" {
+		s.Genre = "all"
+	}
+	var err error
+	if q.Genre, q.Subgenre, err = discover.ParseGenreSpec(s.Genre); err != nil {
+		return q, err
+	}
+	q.Genre, _ = resolveGenreAlias(q.Genre)
+	if s.Subgenre != "" {
+		if q.Subgenre != "" {
+			return q, errors.New("subgenre specified twice")
+		}
+		q.Subgenre = strings.ToLower(strings.TrimSpace(s.Subgenre))
+	}
+	if q.Ranking == "" {
+		q.Ranking = "top"
+	}
+	if q.Format == "" {
+		q.Format = "all"
+	}
+	if err := discover.CheckGenre(q.Genre, q.Subgenre); err != nil {
+		return q, err
+	}
+	if err := q.Validate(); err != nil {
+		return q, err
+	}
+	if s.Limit < 0 {
+		return q, errors.New("negative limit")
+	}
+	return q, nil
+}
+
+// batchResult contains the outcome of a single batchSpec.
+type batchResult struct {
+	Query   batchSpec         `json:"query"`
+	Results []discover.Result `json:"results"`
+	Error   string            `json:"error,omitempty"`
+
+	err error // error corresponding to Error
+}
+
+// runBatch runs the queries described by specs, with at most concurrency
+// requests issued simultaneously. The returned slice is in the same order as
+// specs, and the Error field is set for specs that were invalid or failed.
+// If failFast is true, remaining queries are cancelled after the first failure.
+func runBatch(ctx context.Context, client *discover.Client, specs []batchSpec,
+	concurrency int, failFast bool) []batchResult {
+	results := make([]batchResult, len(specs))
+	var queries []discover.Query
+	var indexes []int // indexes into specs for queries
+	for i, s := range specs {
+		results[i].Query = s
+		q, err := s.query()
+		if err != nil {
+			results[i].Error, results[i].err = err.Error(), err
+			continue
+		}
+		queries = append(queries, q)
+		indexes = append(indexes, i)
+	}
+
+	if failFast && len(queries) < len(specs) {
+		return results // don't run anything if some specs were invalid
+	}
+	fetched, errs := fetchAll(ctx, client, queries, concurrency, failFast)
+	for i, res := range fetched {
+		br := &results[indexes[i]]
+		if errs[i] != nil {
+			br.Error, br.err = errs[i].Error(), errs[i]
+			continue
+		}
+		br.Results = res
+	}
+	return results
+}
+
+// dedupBatch removes duplicate results (as determined by key) from results and
+// then applies each query's limit. If perQuery is true, duplicates are only
+// removed within each query's results. Otherwise, a result is only kept for
+// the first query that returned it. If sorted is true, each query's results
+// are sorted by URL before the limit is applied.
+func dedupBatch(results []batchResult, key func(r *discover.Result) string, perQuery, sorted bool) {
+	dd := newDeduper(key)
+	for i := range results {
+		br := &results[i]
+		if perQuery {
+			dd = newDeduper(key)
+		}
+		br.Results = dd.filter(br.Results)
+		if sorted {
+			sortResults(br.Results)
+		}
+		if br.Query.Limit > 0 && len(br.Results) > br.Query.Limit {
+			br.Results = br.Results[:br.Query.Limit]
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+func TestRunDiscover_Batch(t *testing.T) {
+	var mu sync.Mutex
+	var queried []string
+	srv := newAPIServer(t, func(vals url.Values) ([]string, int, error) {
+		g := genreLabel(vals.Get("g"), vals.Get("t"))
+		mu.Lock()
+		queried = append(queried, g+" "+vals.Get("s"))
+		mu.Unlock()
+		switch g {
+		case "rock":
+			return []string{"r1", "r2", "shared"}, 3, nil
+		case "jazz/fusion":
+			return []string{"shared", "j1"}, 2, nil
+		}
+		t.Errorf("Unexpected query for %q", g)
+		return nil, 0, nil
+	})
+
+	p := filepath.Join(t.TempDir(), "batch.json")
+	if err := os.WriteFile(p, []byte(`[
+		{"genre": "rock", "limit": 2},
+		{"genre": "jazz", "subgenre": "fusion", "ranking": "new"}
+	]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	status, stdout, stderr := runDiscoverTest(t, srv, "-batch", p, "-concurrency", "2")
+	if status != 0 {
+		t.Fatalf("runDiscover exited with %d: %s", status, stderr)
+	}
+
+	sort.Strings(queried)
+	if want := []string{"jazz/fusion new", "rock top"}; !reflect.DeepEqual(queried, want) {
+		t.Errorf("Server received queries %q; want %q", queried, want)
+	}
+
+	// Both queries' results should be written as a single JSON array, with
+	// duplicates only listed under the first query.
+	var got []batchResult
+	if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+		t.Fatalf("Failed parsing output: %v\n%s", err, stdout)
+	}
+	urls := make([][]string, len(got))
+	for i, br := range got {
+		for _, r := range br.Results {
+			urls[i] = append(urls[i], r.URL)
+		}
+	}
+	want := [][]string{
+		{testAlbumURL("r1"), testAlbumURL("r2")},
+		{testAlbumURL("j1")},
+	}
+	if !reflect.DeepEqual(urls, want) {
+		t.Errorf("Got URLs %q; want %q", urls, want)
+	}
+	if len(got) == 2 && (got[0].Query.Genre != "rock" || got[1].Query.Subgenre != "fusion") {
+		t.Errorf("Got queries %+v and %+v", got[0].Query, got[1].Query)
+	}
+}
+
+func TestDedupBatch(t *testing.T) {
+	res := func(slugs ...string) []discover.Result {
+		var rs []discover.Result
+		for _, s := range slugs {
+			rs = append(rs, discover.Result{URL: testAlbumURL(s)})
+		}
+		return rs
+	}
+	for _, tc := range []struct {
+		perQuery, sorted bool
+		want             [][]string
+	}{
+		// Shared results are only kept for the first query that returned them.
+		{false, false, [][]string{{"b", "a"}, {"c"}, {}}},
+		// Each query keeps its own copy, but duplicates within a query are dropped.
+		{true, false, [][]string{{"b", "a"}, {"c", "a"}, {"b"}}},
+		// Sorting happens before the limit is applied.
+		{true, true, [][]string{{"a", "b"}, {"a", "c"}, {"b"}}},
+	} {
+		results := []batchResult{
+			{Query: batchSpec{Genre: "rock", Limit: 2}, Results: res("b", "a", "b", "d")},
+			{Query: batchSpec{Genre: "jazz"}, Results: res("c", "a", "c")},
+			{Query: batchSpec{Genre: "metal"}, Results: res("b")},
+		}
+		dedupBatch(results, dedupKeys["url"], tc.perQuery, tc.sorted)
+		for i, br := range results {
+			got := []string{}
+			for _, r := range br.Results {
+				got = append(got, r.URL)
+			}
+			want := []string{}
+			for _, s := range tc.want[i] {
+				want = append(want, testAlbumURL(s))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("dedupBatch(perQuery=%v, sorted=%v) left %v for query %d; want %v",
+					tc.perQuery, tc.sorted, got, i, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,542 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// browseHelp lists the keys accepted by the "browse" command.
+const browseHelp = "j/k move  n/p page  g genre  r ranking  f format  space queue  o open  O open queued  q quit"
+
+// runBrowse runs the "browse" command.
+func runBrowse(args []string) int {
+	fset := newFlagSet("browse", "[flag]...",
+		"Interactively browses Discover results in the terminal.\n"+
+			"URLs of queued results are printed to stdout on exit.")
+	genre := fset.String("genre", "all", `Initial genre, optionally with subgenre (e.g. "electronic/techno")`)
+	ranking := fset.String("ranking", "top", "Initial ranking (top, new, rec)")
+	format := fset.String("format", "all", "Initial format (all, digital, vinyl, cd, cassette)")
+	concurrency := fset.Int("concurrency", 2, "Maximum number of simultaneous album page requests for prices")
+	cf := addClientFlags(fset)
+	if !parseFlags(fset, args) {
+		return 2
+	}
+	if fset.NArg() > 0 {
+		fset.Usage()
+		return 2
+	}
+	if *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "-concurrency must be positive")
+		return 2
+	}
+	if err := loadSavedGenres(*cf.cacheDir); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed reading saved genres:", err)
+		return 1
+	}
+	query := discover.Query{Ranking: *ranking, Format: *format, Pages: 1}
+	var err error
+	if query.Genre, query.Subgenre, err = parseBrowseGenre(*genre); err != nil {
+		fmt.Fprintln(os.Stderr, "Bad -genre:", err)
+		return 2
+	}
+	if err := query.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "Bad query:", err)
+		return 2
+	}
+	client, err := cf.newClient()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed opening terminal:", err)
+		return 1
+	}
+	defer tty.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+
+	b := &browser{
+		client:      client,
+		tty:         tty,
+		concurrency: *concurrency,
+		query:       query,
+		pages:       make(map[discover.Query][]discover.Result),
+		details:     make(map[string]*discover.AlbumDetails),
+		queuedSet:   make(map[string]bool),
+		detailCh:    make(chan browseDetails),
+		pageCh:      make(chan browsePage),
+	}
+	if err := b.run(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed browsing:", err)
+		return 1
+	}
+	for _, u := range b.queued {
+		fmt.Println(u)
+	}
+	return 0
+}
+
+// parseBrowseGenre parses a "genre" or "genre/subgenre" string and checks
+// that it's known.
+func parseBrowseGenre(s string) (genre, subgenre string, err error) {
+	if genre, subgenre, err = discover.ParseGenreSpec(s); err != nil {
+		return "", "", err
+	}
+	if canon, ok := resolveGenreAlias(genre); ok {
+		genre = canon
+	}
+	return genre, subgenre, discover.CheckGenre(genre, subgenre)
+}
+
+// browser implements the "browse" command's terminal UI.
+type browser struct {
+	client      *discover.Client
+	tty         *os.File
+	concurrency int // maximum simultaneous AlbumDetails calls
+
+	query   discover.Query                       // current page's query
+	pages   map[discover.Query][]discover.Result // previously-fetched pages
+	results []discover.Result                    // current page's results
+	cursor  int                                  // index into results
+	offset  int                                  // index of first displayed result
+
+	pageCh      chan browsePage
+	cancelFetch context.CancelFunc // cancels the in-progress Fetch call, if any
+
+	details       map[string]*discover.AlbumDetails // keyed by URL; nil value if fetch failed
+	detailCh      chan browseDetails
+	cancelDetails context.CancelFunc // cancels the current page's detail fetches
+
+	rows, cols int // terminal size, updated when resized
+
+	queued    []string // queued URLs in the order they were queued
+	queuedSet map[string]bool
+
+	status string  // message displayed at the bottom of the screen
+	prompt *string // genre being typed, or nil if not prompting
+}
+
+// browsePage is sent via browser.pageCh when a page of results has been
+// fetched.
+type browsePage struct {
+	query   discover.Query
+	results []discover.Result
+	err     error
+}
+
+// browseDetails is sent via browser.detailCh when a result's details have
+// been fetched.
+type browseDetails struct {
+	url     string
+	details *discover.AlbumDetails // nil on failure
+}
+
+// run displays the UI and handles input until the user quits.
+func (b *browser) run(ctx context.Context) error {
+	restore, err := b.setupTerminal()
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	keys := make(chan string)
+	go readKeys(b.tty, keys)
+
+	resize := make(chan os.Signal, 1)
+	if len(resizeSignals) > 0 {
+		signal.Notify(resize, resizeSignals...)
+		defer signal.Stop(resize)
+	}
+	b.rows, b.cols = b.size()
+
+	b.loadPage(ctx)
+	for {
+		b.draw()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-resize:
+			b.rows, b.cols = b.size()
+		case p := <-b.pageCh:
+			b.handlePage(ctx, p)
+		case d := <-b.detailCh:
+			b.details[d.url] = d.details
+		case key, ok := <-keys:
+			if !ok || !b.handleKey(ctx, key) {
+				return nil
+			}
+		}
+	}
+}
+
+// setupTerminal switches b.tty to an alternate screen without line buffering
+// or echoing. The returned function restores the terminal's original state.
+func (b *browser) setupTerminal() (restore func(), err error) {
+	saved, err := b.stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("stty: %v", err)
+	}
+	if _, err := b.stty("-icanon", "-echo", "-isig", "min", "1"); err != nil {
+		return nil, fmt.Errorf("stty: %v", err)
+	}
+	fmt.Fprint(b.tty, "\x1b[?1049h\x1b[?25l") // alternate screen, hide cursor
+	return func() {
+		fmt.Fprint(b.tty, "\x1b[?25h\x1b[?1049l")
+		b.stty(strings.TrimSpace(saved))
+	}, nil
+}
+
+// stty runs stty(1) with args against b.tty and returns its output.
+func (b *browser) stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = b.tty
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// size returns the terminal's dimensions, falling back to 24x80.
+func (b *browser) size() (rows, cols int) {
+	if out, err := b.stty("size"); err == nil {
+		if f := strings.Fields(out); len(f) == 2 {
+			rows, _ = strconv.Atoi(f[0])
+			cols, _ = strconv.Atoi(f[1])
+		}
+	}
+	if rows <= 0 || cols <= 0 {
+		return 24, 80
+	}
+	return rows, cols
+}
+
+// readKeys reads keypresses from r and sends them to ch until an error occurs.
+// Special keys are translated to names like "up" and "enter".
+func readKeys(r *os.File, ch chan<- string) {
+	defer close(ch)
+	buf := make([]byte, 64)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		ch <- keyName(buf[:n])
+	}
+}
+
+// keyName returns a name for the key sequence in b.
+func keyName(b []byte) string {
+	switch {
+	case bytes.Equal(b, []byte("\x1b[A")), bytes.Equal(b, []byte("\x1bOA")):
+		return "up"
+	case bytes.Equal(b, []byte("\x1b[B")), bytes.Equal(b, []byte("\x1bOB")):
+		return "down"
+	case bytes.Equal(b, []byte("\x1b[C")), bytes.Equal(b, []byte("\x1bOC")), bytes.Equal(b, []byte("\x1b[6~")):
+		return "next"
+	case bytes.Equal(b, []byte("\x1b[D")), bytes.Equal(b, []byte("\x1bOD")), bytes.Equal(b, []byte("\x1b[5~")):
+		return "prev"
+	case len(b) == 1:
+		switch b[0] {
+		case 0x1b:
+			return "esc"
+		case '\r', '\n':
+			return "enter"
+		case 0x7f, '\b':
+			return "backspace"
+		case 0x03, 0x04: // Ctrl-C, Ctrl-D
+			return "quit"
+		}
+	}
+	return string(b)
+}
+
+// handleKey handles key and returns false if the program should exit.
+func (b *browser) handleKey(ctx context.Context, key string) bool {
+	if b.prompt != nil {
+		b.handlePromptKey(ctx, key)
+		return true
+	}
+	b.status = ""
+	switch key {
+	case "q", "quit":
+		return false
+	case "j", "down":
+		b.move(1)
+	case "k", "up":
+		b.move(-1)
+	case "n", "next":
+		b.query.Page++
+		b.loadPage(ctx)
+	case "p", "prev":
+		if b.query.Page > 0 {
+			b.query.Page--
+			b.loadPage(ctx)
+		}
+	case "g":
+		b.prompt = new(string)
+	case "r":
+		b.query.Ranking = nextValue(discover.Rankings, b.query.Ranking)
+		b.query.Page = 0
+		b.loadPage(ctx)
+	case "f":
+		b.query.Format = nextValue(append([]string{"all"}, discover.Formats...), b.query.Format)
+		b.query.Page = 0
+		b.loadPage(ctx)
+	case " ":
+		if r := b.current(); r != nil {
+			b.toggleQueued(r.URL)
+		}
+	case "o", "enter":
+		if r := b.current(); r != nil {
+			b.open(r.URL)
+		}
+	case "O":
+		for _, u := range b.queued {
+			b.open(u)
+		}
+	}
+	return true
+}
+
+// handlePromptKey handles key while the user is typing a genre.
+func (b *browser) handlePromptKey(ctx context.Context, key string) {
+	switch key {
+	case "esc", "quit":
+		b.prompt = nil
+	case "backspace":
+		if s := *b.prompt; s != "" {
+			_, n := utf8.DecodeLastRuneInString(s)
+			*b.prompt = s[:len(s)-n]
+		}
+	case "enter":
+		genre, subgenre, err := parseBrowseGenre(strings.ToLower(strings.TrimSpace(*b.prompt)))
+		b.prompt = nil
+		if err != nil {
+			b.status = err.Error()
+			return
+		}
+		b.query.Genre, b.query.Subgenre, b.query.Page = genre, subgenre, 0
+		b.loadPage(ctx)
+	default:
+		if !strings.HasPrefix(key, "\x1b") {
+			*b.prompt += key
+		}
+	}
+}
+
+// nextValue returns the value following cur in vals, wrapping around.
+func nextValue(vals []string, cur string) string {
+	for i, v := range vals {
+		if v == cur {
+			return vals[(i+1)%len(vals)]
+		}
+	}
+	return vals[0]
+}
+
+// current returns the result under the cursor, or nil if there are no results.
+func (b *browser) current() *discover.Result {
+	if b.cursor >= len(b.results) {
+		return nil
+	}
+	return &b.results[b.cursor]
+}
+
+// move moves the cursor by delta results.
+func (b *browser) move(delta int) {
+	b.cursor += delta
+	if b.cursor >= len(b.results) {
+		b.cursor = len(b.results) - 1
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+}
+
+func (b *browser) toggleQueued(u string) {
+	if b.queuedSet[u] {
+		delete(b.queuedSet, u)
+		for i, q := range b.queued {
+			if q == u {
+				b.queued = append(b.queued[:i], b.queued[i+1:]...)
+				break
+			}
+		}
+		return
+	}
+	b.queuedSet[u] = true
+	b.queued = append(b.queued, u)
+}
+
+func (b *browser) open(u string) {
+	if err := openURL(u); err != nil {
+		b.status = "Failed opening browser: " + err.Error()
+	}
+}
+
+// loadPage displays the results for b.query if they were already fetched.
+// Otherwise, it starts fetching them in the background; they're passed to
+// handlePage via b.pageCh so keys can still be handled in the meantime.
+func (b *browser) loadPage(ctx context.Context) {
+	if b.cancelDetails != nil {
+		b.cancelDetails()
+		b.cancelDetails = nil
+	}
+	if b.cancelFetch != nil {
+		b.cancelFetch()
+		b.cancelFetch = nil
+	}
+	b.cursor, b.offset = 0, 0
+	if results, ok := b.pages[b.query]; ok {
+		b.showPage(ctx, results)
+		return
+	}
+	b.results = nil
+	b.status = "Loading..."
+	fctx, cancel := context.WithCancel(ctx)
+	b.cancelFetch = cancel
+	go func(q discover.Query) {
+		results, err := b.client.Fetch(fctx, q)
+		select {
+		case b.pageCh <- browsePage{q, results, err}:
+		case <-fctx.Done():
+		}
+	}(b.query)
+}
+
+// handlePage handles a page fetched by loadPage.
+func (b *browser) handlePage(ctx context.Context, p browsePage) {
+	if p.query != b.query {
+		return // the user moved to a different page
+	}
+	b.cancelFetch()
+	b.cancelFetch = nil
+	if p.err != nil {
+		b.status = "Failed fetching results: " + p.err.Error()
+		return
+	}
+	b.pages[p.query] = p.results
+	b.status = ""
+	b.showPage(ctx, p.results)
+}
+
+// showPage displays results for b.query and starts fetching their details.
+func (b *browser) showPage(ctx context.Context, results []discover.Result) {
+	b.results = results
+
+	dctx, cancel := context.WithCancel(ctx)
+	b.cancelDetails = cancel
+	sem := make(chan struct{}, b.concurrency)
+	for _, r := range results {
+		if _, ok := b.details[r.URL]; ok {
+			continue
+		}
+		go func(u string) {
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-dctx.Done():
+				return
+			}
+			d, err := b.client.AlbumDetails(dctx, u)
+			if err != nil {
+				if dctx.Err() != nil {
+					return // try again if the page is displayed later
+				}
+				d = nil
+			}
+			select {
+			case b.detailCh <- browseDetails{u, d}:
+			case <-dctx.Done():
+			}
+		}(r.URL)
+	}
+}
+
+// draw redraws the screen.
+func (b *browser) draw() {
+	rows, cols := b.rows, b.cols
+	listRows := rows - 3 // header, status, and help lines
+	if listRows < 1 {
+		listRows = 1
+	}
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	} else if b.cursor >= b.offset+listRows {
+		b.offset = b.cursor - listRows + 1
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\x1b[H\x1b[2J")
+	header := fmt.Sprintf("%v · %v · %v · page %d · %d queued",
+		genreLabel(b.query.Genre, b.query.Subgenre), b.query.Ranking, b.query.Format, b.query.Page+1, len(b.queued))
+	sb.WriteString("\x1b[1m" + fitLine(header, cols) + "\x1b[0m\r\n")
+	for i := b.offset; i < len(b.results) && i < b.offset+listRows; i++ {
+		r := &b.results[i]
+		mark := ' '
+		if b.queuedSet[r.URL] {
+			mark = '*'
+		}
+		pr := b.priceLabel(r.URL)
+		line := fitLine(fmt.Sprintf("%c %3d. %v – %v", mark, r.Rank, r.Artist, r.Album), cols-utf8.RuneCountInString(pr)-1)
+		if pad := cols - utf8.RuneCountInString(line) - utf8.RuneCountInString(pr); pad > 0 {
+			line += strings.Repeat(" ", pad) + pr
+		}
+		if i == b.cursor {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		sb.WriteString(line + "\r\n")
+	}
+	fmt.Fprintf(&sb, "\x1b[%d;1H", rows-1)
+	if b.prompt != nil {
+		sb.WriteString(fitLine("Genre: "+*b.prompt, cols))
+	} else {
+		sb.WriteString(fitLine(b.status, cols))
+	}
+	fmt.Fprintf(&sb, "\x1b[%d;1H\x1b[2m%v\x1b[0m", rows, fitLine(browseHelp, cols))
+	b.tty.WriteString(sb.String())
+}
+
+// priceLabel returns a short description of the price of the album at u.
+func (b *browser) priceLabel(u string) string {
+	d, ok := b.details[u]
+	switch {
+	case !ok:
+		return "…"
+	case d == nil:
+		return "?"
+	case d.Free:
+		return "free"
+	case d.NameYourPrice:
+		return price{d.Price, d.Currency}.String() + "+"
+	default:
+		return price{d.Price, d.Currency}.String()
+	}
+}
+
+// fitLine truncates s to at most n characters.
+func fitLine(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	rs := []rune(s)
+	return string(rs[:n-1]) + "…"
+}
@@ -0,0 +1,14 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// resizeSignals lists the signals sent when the terminal is resized.
+var resizeSignals = []os.Signal{syscall.SIGWINCH}
@@ -0,0 +1,10 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import "os"
+
+// resizeSignals lists the signals sent when the terminal is resized.
+// Windows doesn't send one, so the size is only read at startup.
+var resizeSignals []os.Signal
@@ -0,0 +1,118 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// clientFlags holds flags used by all commands that send requests to Bandcamp.
+type clientFlags struct {
+	apiBase      *string
+	api          *string
+	apiVersion   *int
+	rate         *float64
+	retries      *int
+	retryBackoff *time.Duration
+	retryBudget  *time.Duration
+	cacheDir     *string
+	cacheTTL     *time.Duration
+	maxConns     *int
+	idleTimeout  *time.Duration
+	proxy        *string
+	userAgent    *string
+	timeout      *time.Duration
+}
+
+// addClientFlags defines client-related flags in fset.
+func addClientFlags(fset *flag.FlagSet) *clientFlags {
+	return &clientFlags{
+		rate:    fset.Float64("rate", 2, "Maximum HTTP requests per second across all workers (0 for no limit)"),
+		retries: fset.Int("retries", 0, "Maximum times to retry rate-limited, server-error, or network-error requests"),
+		retryBackoff: fset.Duration("retry-backoff", discover.DefaultRetryBackoff,
+			"Initial delay before retrying server or network errors (doubled after each retry)"),
+		retryBudget: fset.Duration("retry-budget", 0,
+			"Maximum total time to wait before retrying requests (0 for no limit)"),
+		apiBase: fset.String("api-base", discover.DefaultBaseURL, "Scheme and host to send requests to"),
+		api: fset.String("discover-api", discover.GetWebAPI, "Discover API to use ("+
+			strings.Join(discover.APIs, ", ")+")"),
+		apiVersion: fset.Int("discover-version", discover.DefaultAPIVersion,
+			"Discover API version to use with -discover-api="+discover.GetWebAPI),
+		cacheDir: fset.String("cache-dir", defaultCacheDir(), "Directory for cached API responses (empty to disable caching)"),
+		cacheTTL: fset.Duration("cache-ttl", time.Hour,
+			"Maximum age of cached API responses to use (0 to disable caching)"),
+		// Each simultaneous request (see -concurrency) needs its own connection, so -max-conns
+		// should be at least -concurrency to avoid reconnecting. -rate spaces requests out,
+		// so -idle-timeout should exceed the interval between requests for connections to be reused.
+		maxConns:    fset.Int("max-conns", 4, "Maximum idle HTTP connections to keep per host"),
+		idleTimeout: fset.Duration("idle-timeout", 2*time.Minute, "Time after which idle HTTP connections are closed"),
+		proxy: fset.String("proxy", "", "Proxy URL (http, https, or socks5); "+
+			"HTTP_PROXY, HTTPS_PROXY, and NO_PROXY are used by default"),
+		userAgent: fset.String("user-agent", defaultUserAgent(), "User-Agent header to send with requests"),
+		timeout:   fset.Duration("timeout", 30*time.Second, "Timeout for each HTTP request (0 for no timeout)"),
+	}
+}
+
+// newClient validates the flags and returns a new client configured by them.
+// Errors describe bad flag values.
+func (cf *clientFlags) newClient() (*discover.Client, error) {
+	if !contains(discover.APIs, *cf.api) {
+		return nil, errors.New("-discover-api must be one of: " + strings.Join(discover.APIs, ", "))
+	}
+	if *cf.apiVersion < 1 || *cf.apiVersion > 99 {
+		return nil, errors.New("-discover-version must be a small positive integer")
+	}
+	if *cf.rate < 0 {
+		return nil, errors.New("-rate must be non-negative")
+	}
+	if *cf.maxConns < 1 {
+		return nil, errors.New("-max-conns must be positive")
+	}
+	var proxyURL *url.URL
+	if *cf.proxy != "" {
+		var err error
+		if proxyURL, err = parseProxyURL(*cf.proxy); err != nil {
+			return nil, errors.New("bad -proxy value: " + err.Error())
+		}
+	}
+	if *cf.timeout < 0 {
+		return nil, errors.New("-timeout must be non-negative")
+	}
+	client := &discover.Client{
+		HTTPClient: &http.Client{
+			Transport: newTransport(*cf.maxConns, *cf.idleTimeout, proxyURL),
+			Timeout:   *cf.timeout,
+		},
+		BaseURL:      *cf.apiBase,
+		UserAgent:    *cf.userAgent,
+		API:          *cf.api,
+		APIVersion:   *cf.apiVersion,
+		Limiter:      discover.NewLimiter(*cf.rate),
+		Retries:      *cf.retries,
+		RetryBackoff: *cf.retryBackoff,
+		RetryBudget:  *cf.retryBudget,
+	}
+	if *cf.cacheTTL < 0 {
+		return nil, errors.New("-cache-ttl must be non-negative")
+	}
+	if *cf.cacheTTL > 0 && *cf.cacheDir != "" {
+		client.Cache = &discover.Cache{Dir: *cf.cacheDir, TTL: *cf.cacheTTL}
+	}
+	return client, nil
+}
+
+// capCacheTTL shortens the TTL of client's cache (if any) so that requests
+// repeated every interval aren't answered using cached responses.
+func capCacheTTL(client *discover.Client, interval time.Duration) {
+	if client.Cache != nil && client.Cache.TTL >= interval {
+		client.Cache.TTL = interval / 2
+	}
+}
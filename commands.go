@@ -0,0 +1,364 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// command describes a subcommand, e.g. "genres" in "bandcamp-discover genres".
+type command struct {
+	name string
+	desc string
+	run  func(args []string) int // receives arguments following the command name
+}
+
+// commands lists the available subcommands. "help" is handled by run.
+var commands = []command{
+	{"discover", "Query the Bandcamp Discover API (default)", runDiscover},
+	{"genres", "List, update, or check known genres", runGenres},
+	{"tag", "Query Bandcamp tag pages", runTag},
+	{"fan", "List albums in fans' collections or wishlists", runFan},
+	{"artist", "List albums or full discographies of artists", func(args []string) int { return runMusicPages("artist", args) }},
+	{"label", "List albums released by labels", func(args []string) int { return runMusicPages("label", args) }},
+	{"history", "List when results were first printed", runHistory},
+	{"diff", "Compare saved results", runDiff},
+	{"cache", "Show or clean the response cache", runCache},
+	{"browse", "Interactively browse results in the terminal", runBrowse},
+	{"serve", "Serve RSS feeds and a JSON API over HTTP", runServe},
+}
+
+// defaultCommand is run if the first argument isn't a command name.
+const defaultCommand = "discover"
+
+// run runs the program and returns the process's exit status.
+func run() int {
+	args := os.Args[1:]
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runDiscover(args) // keep supporting plain "bandcamp-discover -flag ..."
+	}
+	if args[0] == "help" {
+		printCommands(os.Stdout)
+		return 0
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+	printCommands(os.Stderr)
+	return 2
+}
+
+// printCommands writes a list of the available commands to w.
+func printCommands(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %v [command] [flag]...\n\nCommands:\n", os.Args[0])
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %v\t%v\n", cmd.name, cmd.desc)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nRun \"%v <command> -help\" to list a command's flags.\n", os.Args[0])
+}
+
+// newFlagSet returns a flag set for the named command. argsUsage describes
+// the command's arguments (e.g. "[flag]... <url>...") and desc describes what
+// it does.
+func newFlagSet(name, argsUsage, desc string) *flag.FlagSet {
+	fset := flag.NewFlagSet(name, flag.ExitOnError)
+	fset.Usage = func() {
+		cmd := name
+		if name == defaultCommand {
+			cmd = "[" + name + "]"
+		}
+		fmt.Fprintf(fset.Output(), "Usage: %v %v %v\n%v\n\n"+
+			"Flags can also be set via %vFLAG_NAME environment variables\n"+
+			"(e.g. %v for -cache-ttl) or via the -config file.\n"+
+			"Run \"%v help\" to list other commands.\n\n",
+			os.Args[0], cmd, argsUsage, desc, envPrefix, envVarName("cache-ttl"), os.Args[0])
+		fset.PrintDefaults()
+	}
+	return fset
+}
+
+// flagSetCollector is called by parseFlags instead of parsing arguments if
+// non-nil. It is used to inspect commands' flags.
+var flagSetCollector func(fset *flag.FlagSet)
+
+func init() {
+	// This is assigned here rather than in its declaration to avoid an
+	// initialization cycle, since allFlagNames reads commands.
+	knownFlagNames = allFlagNames
+}
+
+// knownFlagNames returns the names of all flags accepted by any command.
+// It is used by parseFlags to report unknown settings.
+var knownFlagNames func() map[string]bool
+
+// allFlagNames returns the names of all flags defined by commands.
+func allFlagNames() map[string]bool {
+	defer func() { flagSetCollector = nil }()
+	names := make(map[string]bool)
+	flagSetCollector = func(fset *flag.FlagSet) {
+		fset.VisitAll(func(f *flag.Flag) { names[f.Name] = true })
+	}
+	for _, cmd := range commands {
+		cmd.run(nil) // returns after calling flagSetCollector
+	}
+	return names
+}
+
+// parseFlags defines -config in fset and parses args. Flags that aren't set
+// on the command line are then loaded from environment variables and from the
+// config file, in that order. Settings for flags belonging to other commands
+// are ignored so that a single config file and environment can be shared by
+// all commands, but settings that no command accepts are reported as errors.
+// Errors are printed to stderr and false is returned if the command shouldn't
+// continue.
+func parseFlags(fset *flag.FlagSet, args []string) bool {
+	configPath := fset.String("config", defaultConfigPath(), "TOML file containing default flag values")
+	if flagSetCollector != nil {
+		flagSetCollector(fset)
+		return false
+	}
+	fset.Parse(args) // exits on error
+	known := knownFlagNames()
+
+	// Flags from the command line take precedence over environment variables,
+	// which take precedence over the config file.
+	if err := applyEnv(fset, os.Environ(), known); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed reading environment:", err)
+		return false
+	}
+	configSet := false
+	fset.Visit(func(f *flag.Flag) { configSet = configSet || f.Name == "config" })
+	if *configPath != "" {
+		if err := applyConfig(fset, *configPath, configSet, known); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed loading config:", err)
+			return false
+		}
+	}
+	return true
+}
+
+// runGenres runs the "genres" command.
+func runGenres(args []string) int {
+	fset := newFlagSet("genres", "[flag]...", "Lists genres and subgenres accepted by the Discover API.")
+	output := fset.String("output", "text", "Output format ("+strings.Join(genreListFormats, ", ")+")")
+	update := fset.Bool("update", false, "Fetch Bandcamp's current genres and save them to -cache-dir "+
+		"(saved genres are merged with embedded ones in later runs)")
+	check := fset.Bool("check", false, "Compare embedded genres against Bandcamp's and exit with 1 if they differ")
+	quiet := fset.Bool("quiet", false, "With -update, don't print changes to stderr")
+	cf := addClientFlags(fset)
+	if !parseFlags(fset, args) {
+		return 2
+	}
+	if fset.NArg() > 0 {
+		fset.Usage()
+		return 2
+	}
+
+	if *update || *check {
+		if *update && *check {
+			fmt.Fprintln(os.Stderr, "-update and -check can't be used together")
+			return 2
+		}
+		client, err := cf.newClient()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if *check {
+			return checkStaleGenres(ctx, client)
+		}
+		if *cf.cacheDir == "" {
+			fmt.Fprintln(os.Stderr, "-update requires -cache-dir")
+			return 2
+		}
+		return updateGenresFile(ctx, client, *cf.cacheDir, *quiet)
+	}
+
+	if !contains(genreListFormats, *output) {
+		fmt.Fprintln(os.Stderr, "-output must be one of:", strings.Join(genreListFormats, ", "))
+		return 2
+	}
+	if err := loadSavedGenres(*cf.cacheDir); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed reading saved genres:", err)
+		return 1
+	}
+	if err := printGenres(os.Stdout, *output); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed listing genres:", err)
+		return 1
+	}
+	return 0
+}
+
+// runMusicPages runs the "artist" or "label" command (identified by name),
+// which prints the album URLs listed on artists' or labels' music pages.
+func runMusicPages(name string, args []string) int {
+	fset := newFlagSet(name, "[flag]... <url-or-subdomain>...",
+		fmt.Sprintf("Prints the URLs of albums listed on each %v's Bandcamp music page.", name))
+	discography := fset.Bool("discography", false,
+		"List albums and tracks with release dates, newest first (fetches each release's page)")
+	output := fset.String("output", "", "Output format with -discography ("+
+		strings.Join(sortedKeys(outputFormats), ", ")+") (default \"tsv\")")
+	concurrency := fset.Int("concurrency", 1, "Maximum number of simultaneous release page requests for -discography")
+	cf := addClientFlags(fset)
+	if !parseFlags(fset, args) {
+		return 2
+	}
+	if fset.NArg() == 0 {
+		fset.Usage()
+		return 2
+	}
+	if *output != "" && !*discography {
+		fmt.Fprintln(os.Stderr, "-output requires -discography")
+		return 2
+	} else if *output == "" {
+		*output = "tsv"
+	}
+	if _, ok := outputFormats[*output]; !ok {
+		fmt.Fprintln(os.Stderr, "-output must be one of:", strings.Join(sortedKeys(outputFormats), ", "))
+		return 2
+	}
+	if *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "-concurrency must be positive")
+		return 2
+	}
+	client, err := cf.newClient()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *discography {
+		return printDiscographies(ctx, client, fset.Args(), *output, *concurrency)
+	}
+
+	var status int
+	seen := make(map[string]struct{})
+	for _, arg := range fset.Args() {
+		urls, err := client.ArtistAlbums(ctx, musicPageURL(arg))
+		if interrupted(ctx) {
+			return interruptedStatus
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed getting albums for %v: %v\n", arg, err)
+			status = 1
+			continue
+		}
+		for _, u := range urls {
+			if _, ok := seen[u]; !ok {
+				seen[u] = struct{}{}
+				fmt.Println(u)
+			}
+		}
+	}
+	return status
+}
+
+// discographyColumns contains the default columns for -discography with
+// -output=tsv and csv.
+const discographyColumns = "release_date,type,artist,album,url"
+
+// printDiscographies writes the releases listed on the music pages of args
+// (URLs or subdomains) to stdout in the supplied format. Releases whose pages
+// can't be loaded are reported to stderr. At most concurrency release pages are
+// fetched simultaneously. The process's exit status is returned.
+func printDiscographies(ctx context.Context, client *discover.Client, args []string,
+	format string, concurrency int) int {
+	client.SkipFunc = func(desc, reason string) {
+		fmt.Fprintf(os.Stderr, "Skipping %v: %v\n", desc, reason)
+	}
+	var status int
+	var results []discover.Result
+	for _, arg := range args {
+		res, err := client.ArtistDiscography(ctx, musicPageURL(arg), concurrency)
+		if interrupted(ctx) {
+			return interruptedStatus
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed getting discography for %v: %v\n", arg, err)
+			status = 1
+			continue
+		}
+		for i := range res {
+			res[i].Details.Tracks = nil // only used by -tracks in the discover command
+		}
+		results = append(results, res...)
+	}
+	results = newDeduper(dedupKeys["url"]).filter(results)
+
+	opts := outputOptions{title: "Bandcamp discography: " + strings.Join(args, ", "), warnings: os.Stderr}
+	opts.columns, _ = parseColumns(discographyColumns)
+	if err := writeResults(os.Stdout, format, results, &opts); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed writing output:", err)
+		return 1
+	}
+	return status
+}
+
+// musicPageURL returns the base URL for s, which is either a URL like
+// "https://artist.bandcamp.com" or a bare subdomain like "artist".
+func musicPageURL(s string) string {
+	if strings.Contains(s, "://") {
+		return s
+	}
+	return "https://" + s + ".bandcamp.com"
+}
+
+// runCache runs the "cache" command.
+func runCache(args []string) int {
+	fset := newFlagSet("cache", "[flag]... <dir|clean>",
+		`Prints the cache directory ("dir") or deletes cached API responses ("clean").`)
+	cacheDir := fset.String("cache-dir", defaultCacheDir(), "Directory for cached API responses")
+	cacheTTL := fset.Duration("cache-ttl", 0, `With "clean", only delete responses older than this`)
+	if !parseFlags(fset, args) {
+		return 2
+	}
+	if fset.NArg() != 1 {
+		fset.Usage()
+		return 2
+	}
+	if *cacheDir == "" {
+		fmt.Fprintln(os.Stderr, "-cache-dir must be set")
+		return 2
+	}
+	switch fset.Arg(0) {
+	case "dir":
+		fmt.Println(*cacheDir)
+		return 0
+	case "clean":
+		return cleanCache(&discover.Cache{Dir: *cacheDir, TTL: *cacheTTL})
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown cache action %q\n", fset.Arg(0))
+		return 2
+	}
+}
+
+// cleanCache deletes files older than c.TTL from c and prints a summary.
+// The process's exit status is returned.
+func cleanCache(c *discover.Cache) int {
+	removed, freed, err := c.Clean(time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed cleaning cache:", err)
+		return 1
+	}
+	fmt.Printf("Removed %d file(s), freeing %d byte(s)\n", removed, freed)
+	return 0
+}
@@ -0,0 +1,80 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureOutput calls fn and returns what it wrote to stdout and stderr.
+func captureOutput(t *testing.T, fn func()) (stdout, stderr string) {
+	t.Helper()
+	read := func(f **os.File) func() string {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		orig := *f
+		*f = w
+		ch := make(chan string)
+		go func() {
+			b, _ := io.ReadAll(r)
+			r.Close()
+			ch <- string(b)
+		}()
+		return func() string {
+			*f = orig
+			w.Close()
+			return <-ch
+		}
+	}
+	finishOut := read(&os.Stdout)
+	finishErr := read(&os.Stderr)
+	fn()
+	return finishOut(), finishErr()
+}
+
+func TestRunCache(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	for name, data := range map[string]string{"a.cache": "12345", "a.meta": "{}", "b.cache": "123"} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if name != "b.cache" {
+			if err := os.Chtimes(p, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		args   []string
+		status int
+		stdout string
+	}{
+		{[]string{"-cache-dir", dir, "dir"}, 0, dir + "\n"},
+		{[]string{"-cache-dir", dir, "-cache-ttl", "1h", "clean"}, 0, "Removed 2 file(s), freeing 7 byte(s)\n"},
+		{[]string{"-cache-dir", dir, "-cache-ttl", "1h", "clean"}, 0, "Removed 0 file(s), freeing 0 byte(s)\n"},
+		{[]string{"-cache-dir", dir, "clean"}, 0, "Removed 1 file(s), freeing 3 byte(s)\n"},
+		{[]string{"-cache-dir", dir, "bogus"}, 2, ""},
+		{[]string{"-cache-dir", "", "dir"}, 2, ""},
+		{[]string{"-cache-dir", dir}, 2, ""},
+		{[]string{"-cache-dir", dir, "dir", "clean"}, 2, ""},
+	} {
+		var status int
+		args := append([]string{"-config", ""}, tc.args...)
+		stdout, stderr := captureOutput(t, func() { status = runCache(args) })
+		if status != tc.status || stdout != tc.stdout {
+			t.Errorf("runCache(%q) = %d with stdout %q; want %d with %q (stderr %q)",
+				args, status, stdout, tc.status, tc.stdout, strings.TrimSpace(stderr))
+		}
+	}
+}
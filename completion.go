@@ -0,0 +1,237 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+func init() {
+	// This is registered here rather than in the commands declaration to avoid
+	// an initialization cycle, since runCompletion reads commands.
+	commands = append(commands, command{"completion", "Print a bash, zsh, or fish completion script",
+		runCompletion})
+}
+
+// completionShells lists the shells supported by the "completion" command.
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// genreListArg is passed to the "completion" command by completion scripts
+// to list genre names.
+const genreListArg = "genres"
+
+// runCompletion runs the "completion" command.
+func runCompletion(args []string) int {
+	fset := newFlagSet("completion", "[flag]... <"+strings.Join(completionShells, "|")+">",
+		"Prints a shell completion script, e.g. for \"source <("+progName()+" completion bash)\".")
+	cacheDir := fset.String("cache-dir", defaultCacheDir(), "Directory containing genres saved by \"genres -update\"")
+	if !parseFlags(fset, args) {
+		return 2
+	}
+	if fset.NArg() != 1 {
+		fset.Usage()
+		return 2
+	}
+
+	// Completion scripts run "completion genres" to complete -genre values.
+	if fset.Arg(0) == genreListArg {
+		if err := loadSavedGenres(*cacheDir); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed reading saved genres:", err)
+			return 1
+		}
+		for _, g := range completionGenres() {
+			fmt.Println(g)
+		}
+		return 0
+	}
+
+	if !contains(completionShells, fset.Arg(0)) {
+		fmt.Fprintln(os.Stderr, "Shell must be one of:", strings.Join(completionShells, ", "))
+		return 2
+	}
+	if err := writeCompletion(os.Stdout, fset.Arg(0), progName()); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed writing completion script:", err)
+		return 1
+	}
+	return 0
+}
+
+// progName returns the program's name for use in completion scripts.
+func progName() string {
+	return filepath.Base(os.Args[0])
+}
+
+// completionGenres returns the sorted names of all genres (including "all")
+// and "genre/subgenre" pairs in discover.Genres.
+func completionGenres() []string {
+	return append(append([]string{"all"}, sortedKeys(discover.Genres)...), flattenGenres()...)
+}
+
+// completionCommand describes a command in completion scripts.
+type completionCommand struct {
+	Name  string
+	Desc  string
+	Flags []completionFlag // sorted by name
+}
+
+// completionFlag describes a flag in completion scripts.
+type completionFlag struct {
+	Name  string
+	Usage string
+	Bool  bool // flag doesn't take a value
+}
+
+// getCompletionCommands returns descriptions of all commands and their flags.
+func getCompletionCommands() []completionCommand {
+	defer func() { flagSetCollector = nil }()
+	var ccs []completionCommand
+	for _, cmd := range commands {
+		cc := completionCommand{Name: cmd.name, Desc: cmd.desc}
+		flagSetCollector = func(fset *flag.FlagSet) {
+			fset.VisitAll(func(f *flag.Flag) {
+				bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+				cc.Flags = append(cc.Flags, completionFlag{f.Name, f.Usage, ok && bf.IsBoolFlag()})
+			})
+		}
+		cmd.run(nil) // returns after calling flagSetCollector
+		ccs = append(ccs, cc)
+	}
+	return ccs
+}
+
+// funcNameRegexp matches characters that can't be used in shell function names.
+var funcNameRegexp = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// writeCompletion writes a completion script for shell (from completionShells)
+// and the program named prog to w.
+func writeCompletion(w io.Writer, shell, prog string) error {
+	tmpl, err := template.New("").Funcs(template.FuncMap{
+		"fishQuote": func(s string) string {
+			return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+		},
+	}).Parse(completionTemplates[shell])
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, struct {
+		Prog, Func, GenreList, Default string
+		Commands                       []completionCommand
+	}{
+		Prog:      prog,
+		Func:      "_" + funcNameRegexp.ReplaceAllString(prog, "_"),
+		GenreList: "completion " + genreListArg,
+		Default:   defaultCommand,
+		Commands:  getCompletionCommands(),
+	})
+}
+
+// completionTemplates contains text/template templates for completion scripts
+// keyed by shell name.
+var completionTemplates = map[string]string{
+	"bash": `# bash completion for {{.Prog}}
+# Add "source <({{.Prog}} completion bash)" to ~/.bashrc to enable it.
+{{.Func}}() {
+	local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+	# COMP_WORDBREAKS splits "-flag=value" into separate words.
+	if [[ $cur == = ]]; then
+		cur=
+	elif [[ $prev == = && $COMP_CWORD -gt 1 ]]; then
+		prev=${COMP_WORDS[COMP_CWORD-2]}
+	fi
+	local cmd={{.Default}}
+	if [[ $COMP_CWORD -gt 1 && ${COMP_WORDS[1]} != -* ]]; then
+		cmd=${COMP_WORDS[1]}
+	fi
+
+	if [[ $prev == -genre || $prev == --genre ]]; then
+		# Complete the last item in comma-separated lists.
+		local pre=
+		[[ $cur == *,* ]] && pre=${cur%,*},
+		COMPREPLY=($(compgen -P "$pre" -W "$({{.Prog}} {{.GenreList}} 2>/dev/null)" -- "${cur##*,}"))
+		return
+	fi
+	if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then
+		COMPREPLY=($(compgen -W "{{range .Commands}}{{.Name}} {{end}}help" -- "$cur"))
+		return
+	fi
+	if [[ $cur == -* ]]; then
+		case $cmd in
+{{- range .Commands}}
+		{{.Name}}) COMPREPLY=($(compgen -W "{{range .Flags}}-{{.Name}} {{end}}" -- "$cur")) ;;
+{{- end}}
+		esac
+	fi
+}
+complete -o default -F {{.Func}} {{.Prog}}
+`,
+
+	"zsh": `#compdef {{.Prog}}
+# zsh completion for {{.Prog}}
+# Add "source <({{.Prog}} completion zsh)" to ~/.zshrc to enable it.
+{{.Func}}() {
+	local cmd={{.Default}}
+	if (( CURRENT > 2 )) && [[ ${words[2]} != -* ]]; then
+		cmd=${words[2]}
+	fi
+
+	if [[ ${words[CURRENT-1]} == (-|--)genre ]]; then
+		local -a genres
+		genres=(${(f)"$({{.Prog}} {{.GenreList}} 2>/dev/null)"})
+		# Complete the last item in comma-separated lists.
+		compset -P '*,'
+		compadd -a genres
+		return
+	fi
+	if (( CURRENT == 2 )) && [[ ${words[CURRENT]} != -* ]]; then
+		local -a cmds
+		cmds=({{range .Commands}}'{{.Name}}:{{.Desc}}' {{end}}'help:List commands')
+		_describe command cmds
+		return
+	fi
+	if [[ ${words[CURRENT]} == -* ]]; then
+		case $cmd in
+{{- range .Commands}}
+		{{.Name}}) compadd -- {{range .Flags}}-{{.Name}} {{end}};;
+{{- end}}
+		esac
+		return
+	fi
+	_files
+}
+compdef {{.Func}} {{.Prog}}
+`,
+
+	"fish": `# fish completion for {{.Prog}}
+# Run "{{.Prog}} completion fish > ~/.config/fish/completions/{{.Prog}}.fish" to enable it.
+function {{.Func}}_cmd
+	set -l tokens (commandline -opc)
+	if test (count $tokens) -gt 1; and not string match -q -- '-*' $tokens[2]
+		echo $tokens[2]
+	else
+		echo {{.Default}}
+	end
+end
+
+complete -c {{.Prog}} -n __fish_use_subcommand -f -a help -d 'List commands'
+{{- $prog := .Prog}}{{$func := .Func}}{{$genres := .GenreList}}
+{{- range .Commands}}
+complete -c {{$prog}} -n __fish_use_subcommand -f -a {{.Name}} -d {{fishQuote .Desc}}
+{{- $cmd := .Name}}
+{{- range .Flags}}
+complete -c {{$prog}} -n 'test ({{$func}}_cmd) = {{$cmd}}' -o {{.Name}}
+{{- if not .Bool}} -r{{end}}
+{{- if eq .Name "genre"}} -f -a '({{$prog}} {{$genres}} 2>/dev/null)'{{end}} -d {{fishQuote .Usage}}
+{{- end}}
+{{- end}}
+`,
+}
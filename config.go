@@ -0,0 +1,200 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultConfigPath returns the default value of -config.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "bandcamp-discover", "config.toml")
+}
+
+// configEntry is a key and its values from a config file.
+type configEntry struct {
+	key  string   // flag name, e.g. "genre" or "cache-ttl" for "ttl" in "[cache]"
+	vals []string // multiple values are only permitted for repeatable flags
+	line int
+}
+
+// readConfig parses the TOML config file at p. It supports a subset of TOML:
+// "key = value" pairs, where values are strings, numbers, booleans, or
+// single-line arrays of these, and "[section]" headers. Keys within sections
+// are prefixed by the section name and a hyphen.
+func readConfig(p string) ([]configEntry, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseConfig(f)
+}
+
+// parseConfig implements readConfig.
+func parseConfig(r io.Reader) ([]configEntry, error) {
+	var entries []configEntry
+	var section string
+	sc := bufio.NewScanner(r)
+	for ln := 1; sc.Scan(); ln++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			end := strings.IndexByte(line, ']')
+			if end < 0 || !isConfigComment(line[end+1:]) {
+				return nil, fmt.Errorf("line %d: bad section header", ln)
+			}
+			section = strings.TrimSpace(line[1:end])
+			continue
+		}
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", ln)
+		}
+		if key = strings.TrimSpace(key); key == "" {
+			return nil, fmt.Errorf("line %d: empty key", ln)
+		}
+		if section != "" {
+			key = section + "-" + key
+		}
+		vals, err := parseConfigValue(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", ln, err)
+		}
+		entries = append(entries, configEntry{key, vals, ln})
+	}
+	return entries, sc.Err()
+}
+
+// parseConfigValue parses s, a TOML value optionally followed by a comment.
+// Arrays are returned as multiple values.
+func parseConfigValue(s string) ([]string, error) {
+	if strings.HasPrefix(s, "[") {
+		var vals []string
+		s = strings.TrimSpace(s[1:])
+		for {
+			if strings.HasPrefix(s, "]") {
+				if !isConfigComment(s[1:]) {
+					return nil, errors.New("trailing characters after array")
+				}
+				return vals, nil
+			}
+			v, rest, err := parseConfigScalar(s)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, v)
+			s = strings.TrimSpace(rest)
+			if strings.HasPrefix(s, ",") {
+				s = strings.TrimSpace(s[1:])
+			} else if !strings.HasPrefix(s, "]") {
+				return nil, errors.New("expected , or ] in array")
+			}
+		}
+	}
+	v, rest, err := parseConfigScalar(s)
+	if err != nil {
+		return nil, err
+	}
+	if !isConfigComment(rest) {
+		return nil, errors.New("trailing characters after value")
+	}
+	return []string{v}, nil
+}
+
+// parseConfigScalar parses the string, number, or boolean at the beginning of s
+// and returns it along with the remainder of s.
+func parseConfigScalar(s string) (val, rest string, err error) {
+	switch {
+	case s == "":
+		return "", "", errors.New("missing value")
+	case s[0] == '"':
+		// TOML basic strings use the same escapes as Go, except for \e and \x.
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				v, err := strconv.Unquote(s[:i+1])
+				return v, s[i+1:], err
+			}
+		}
+		return "", "", errors.New("unterminated string")
+	case s[0] == '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", errors.New("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	default:
+		end := strings.IndexAny(s, " \t,]#")
+		if end < 0 {
+			end = len(s)
+		}
+		return s[:end], s[end:], nil
+	}
+}
+
+// isConfigComment returns true if s is empty or contains only a comment.
+func isConfigComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || s[0] == '#'
+}
+
+// repeatableFlag is implemented by flag.Values that accumulate repeated values.
+type repeatableFlag interface{ repeatable() }
+
+func (*genreListFlag) repeatable() {}
+func (aliasFlag) repeatable()      {}
+
+// applyConfig sets flags in fset from the config file at p. Flags that were
+// already set on the command line are left unchanged. If required is false,
+// a missing file is ignored. Settings for flags in known (but not in fset)
+// are ignored, while an error is returned for other unknown settings. If known
+// is nil, all unknown settings are ignored.
+func applyConfig(fset *flag.FlagSet, p string, required bool, known map[string]bool) error {
+	entries, err := readConfig(p)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	explicit := make(map[string]bool)
+	fset.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for _, e := range entries {
+		f := fset.Lookup(e.key)
+		if f == nil || e.key == "config" {
+			if f == nil && (known == nil || known[e.key]) {
+				continue
+			}
+			return fmt.Errorf("%v:%d: unknown setting %q", p, e.line, e.key)
+		}
+		if _, ok := f.Value.(repeatableFlag); !ok && len(e.vals) != 1 {
+			return fmt.Errorf("%v:%d: %q takes a single value", p, e.line, e.key)
+		}
+		if explicit[e.key] {
+			continue
+		}
+		for _, v := range e.vals {
+			if err := fset.Set(e.key, v); err != nil {
+				return fmt.Errorf("%v:%d: bad %q value: %v", p, e.line, e.key, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes data to a config file in a temp dir and returns its path.
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestApplyConfig_Precedence(t *testing.T) {
+	p := writeConfig(t, `# Comment
+genre = "jazz"   # overridden by environment
+pages = 4        # overridden by command line
+quiet = true
+addr = ":8080"   # belongs to another command
+
+[cache]
+ttl = "3h"
+`)
+	fset, genre, pages, ttl, quiet := newTestFlagSet()
+	if err := fset.Parse([]string{"-pages", "2"}); err != nil {
+		t.Fatal(err)
+	}
+	known := map[string]bool{"genre": true, "pages": true, "cache-ttl": true, "quiet": true, "addr": true}
+	// parseFlags applies the environment before the config file.
+	if err := applyEnv(fset, []string{"BANDCAMP_DISCOVER_GENRE=rock"}, known); err != nil {
+		t.Fatal("applyEnv failed:", err)
+	}
+	if err := applyConfig(fset, p, true, known); err != nil {
+		t.Fatal("applyConfig failed:", err)
+	}
+	if *genre != "rock" || *pages != 2 || *ttl != 3*time.Hour || !*quiet {
+		t.Errorf("Got genre=%q pages=%d cache-ttl=%v quiet=%v; want rock, 2, 3h, true",
+			*genre, *pages, *ttl, *quiet)
+	}
+}
+
+func TestApplyConfig_Missing(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "missing.toml")
+	fset, _, _, _, _ := newTestFlagSet()
+	if err := applyConfig(fset, p, false, nil); err != nil {
+		t.Errorf("applyConfig with missing optional file failed: %v", err)
+	}
+	if err := applyConfig(fset, p, true, nil); err == nil {
+		t.Error("applyConfig with missing required file succeeded")
+	}
+}
+
+func TestApplyConfig_Errors(t *testing.T) {
+	known := map[string]bool{"genre": true, "pages": true, "cache-ttl": true, "quiet": true, "config": true}
+	for _, tc := range []struct {
+		data string
+		want string // substring of error
+	}{
+		{"pages = \"many\"\n", `1: bad "pages" value`},
+		{"quiet = 3\n", `1: bad "quiet" value`},
+		{"[cache]\nttl = 5\n", `2: bad "cache-ttl" value`},
+		{"pages = [1, 2]\n", `1: "pages" takes a single value`},
+		{"bogus = 1\n", `1: unknown setting "bogus"`},
+		{"config = \"other.toml\"\n", `1: unknown setting "config"`},
+		{"genre = \"rock\n", "line 1: unterminated string"},
+		{"genre\n", "line 1: expected key = value"},
+		{"[cache\nttl = 5\n", "line 1: bad section header"},
+		{"genre = rock jazz\n", "line 1: trailing characters after value"},
+	} {
+		p := writeConfig(t, tc.data)
+		fset, _, _, _, _ := newTestFlagSet()
+		fset.String("config", "", "") // defined by parseFlags
+		if err := applyConfig(fset, p, true, known); err == nil {
+			t.Errorf("applyConfig(%q) succeeded unexpectedly", tc.data)
+		} else if !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("applyConfig(%q) returned %q; want error containing %q", tc.data, err, tc.want)
+		}
+	}
+}
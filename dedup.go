@@ -0,0 +1,73 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// dedupKeys maps from -dedup-by values to functions returning the
+// corresponding keys for results.
+var dedupKeys = map[string]func(r *discover.Result) string{
+	"url":    func(r *discover.Result) string { return r.URL },
+	"artist": artistKey,
+	"album":  func(r *discover.Result) string { return normalizeTitle(r.Album) },
+}
+
+// artistKey returns the hostname from r's URL, e.g. "artist.bandcamp.com".
+func artistKey(r *discover.Result) string {
+	if u, err := url.Parse(r.URL); err == nil && u.Host != "" {
+		return strings.ToLower(u.Host)
+	}
+	return r.URL
+}
+
+// normalizeTitle lowercases s and removes non-alphanumeric characters so that
+// minor differences in capitalization, punctuation, and spacing are ignored.
+func normalizeTitle(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+// deduper is used to skip results with already-seen keys.
+type deduper struct {
+	key  func(r *discover.Result) string
+	seen map[string]struct{}
+}
+
+func newDeduper(key func(r *discover.Result) string) *deduper {
+	return &deduper{key: key, seen: make(map[string]struct{})}
+}
+
+// keep returns true if r's key hasn't been seen before.
+func (d *deduper) keep(r *discover.Result) bool {
+	k := d.key(r)
+	if _, ok := d.seen[k]; ok {
+		return false
+	}
+	d.seen[k] = struct{}{}
+	return true
+}
+
+// filter returns the results from rs that should be kept.
+func (d *deduper) filter(rs []discover.Result) []discover.Result {
+	if rs == nil {
+		return nil
+	}
+	kept := make([]discover.Result, 0, len(rs))
+	for i := range rs {
+		if d.keep(&rs[i]) {
+			kept = append(kept, rs[i])
+		}
+	}
+	return kept
+}
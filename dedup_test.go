@@ -0,0 +1,59 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+func TestDedupKeys(t *testing.T) {
+	results := []discover.Result{
+		{Artist: "A", Album: "First", URL: "https://a.bandcamp.com/album/first"},
+		{Artist: "A", Album: "First", URL: "https://a.bandcamp.com/album/first"},         // same URL
+		{Artist: "A", Album: "Second", URL: "https://A.bandcamp.com/album/second"},       // same artist
+		{Artist: "B", Album: "first!", URL: "https://b.bandcamp.com/album/first"},        // same album
+		{Artist: "C", Album: "The  Third", URL: "https://music.example.org/album/third"}, // custom domain
+		{Artist: "C", Album: "the third", URL: "https://music.example.org/track/third"},
+	}
+	for _, tc := range []struct {
+		key  string
+		want []int // indexes of kept results
+	}{
+		{"url", []int{0, 2, 3, 4, 5}},
+		{"artist", []int{0, 3, 4}},
+		{"album", []int{0, 2, 4}},
+	} {
+		fn, ok := dedupKeys[tc.key]
+		if !ok {
+			t.Errorf("dedupKeys doesn't contain %q", tc.key)
+			continue
+		}
+		var want []discover.Result
+		for _, i := range tc.want {
+			want = append(want, results[i])
+		}
+		if got := newDeduper(fn).filter(results); !reflect.DeepEqual(got, want) {
+			t.Errorf("Deduping by %v kept %v; want %v", tc.key, got, want)
+		}
+	}
+}
+
+func TestDeduper_Keep(t *testing.T) {
+	// A single deduper should remember keys across calls, e.g. for
+	// multiple queries.
+	d := newDeduper(dedupKeys["url"])
+	r := discover.Result{URL: "https://a.bandcamp.com/album/a"}
+	if !d.keep(&r) {
+		t.Error("keep returned false for first result")
+	}
+	if got := d.filter([]discover.Result{r}); len(got) != 0 {
+		t.Errorf("filter kept already-seen result: %v", got)
+	}
+	if got := d.filter(nil); got != nil {
+		t.Errorf("filter(nil) = %v; want nil", got)
+	}
+}
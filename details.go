@@ -0,0 +1,92 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// detailColumns contains the outputColumns keys that are filled by -details.
+// They are appended to the default columns for -output=tsv and csv.
+const detailColumns = "release_date,label,tags,price,currency,nyp,free,track_count"
+
+// trackColumns contains the outputColumns keys that are filled by -tracks.
+// They are appended to the default columns for -output=tsv and csv.
+const trackColumns = "tracks,duration"
+
+// addDetails fetches the album pages of results and sets their Details fields,
+// with at most concurrency requests issued simultaneously. Track listings are
+// only retained if withTracks is true. Errors for individual albums are returned.
+func addDetails(ctx context.Context, client *discover.Client, results []discover.Result,
+	concurrency int, withTracks bool) []error {
+	errs := make([]error, len(results))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			if results[i].Details, errs[i] = client.AlbumDetails(ctx, results[i].URL); errs[i] == nil && !withTracks {
+				results[i].Details.Tracks = nil
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return failed
+}
+
+// detailFilter configures filterDetails.
+type detailFilter struct {
+	maxPrice    *price // nil to not filter by price
+	nyp         bool   // only keep name-your-price results
+	free        bool   // only keep free results
+	withTracks  bool   // keep track listings
+	concurrency int    // maximum simultaneous album page requests
+	quiet       bool   // don't print warnings about failed requests
+}
+
+// filterDetails adds details to results as described by addDetails and returns
+// the results that pass f's filters. Rejected results are reported to e.
+func filterDetails(ctx context.Context, client *discover.Client, results []discover.Result,
+	f detailFilter, e *explainer) []discover.Result {
+	errs := addDetails(ctx, client, results, f.concurrency, f.withTracks)
+	if !f.quiet {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, "Warning: failed getting details:", err)
+		}
+	}
+	if f.maxPrice != nil {
+		results = priceResults(results, *f.maxPrice, e)
+	}
+	if f.nyp {
+		results = filterResults(results, func(r *discover.Result) bool {
+			return r.Details != nil && r.Details.NameYourPrice
+		}, e, "not name-your-price")
+	}
+	if f.free {
+		results = filterResults(results, func(r *discover.Result) bool {
+			return r.Details != nil && r.Details.Free
+		}, e, "not free")
+	}
+	return results
+}
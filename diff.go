@@ -0,0 +1,164 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// readResultsFile reads a JSON array of results (as written by -output=json)
+// from the file at p.
+func readResultsFile(p string) ([]discover.Result, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var results []discover.Result
+	if err := json.Unmarshal(b, &results); err != nil {
+		return nil, fmt.Errorf("%v: %v", p, err)
+	}
+	return results, nil
+}
+
+// diffResults compares old and cur by URL and returns the results that are
+// only present in cur (added) and only present in old (removed).
+// Results are returned in their original order.
+func diffResults(old, cur []discover.Result) (added, removed []discover.Result) {
+	oldURLs := make(map[string]struct{}, len(old))
+	for _, r := range old {
+		oldURLs[r.URL] = struct{}{}
+	}
+	curURLs := make(map[string]struct{}, len(cur))
+	for _, r := range cur {
+		curURLs[r.URL] = struct{}{}
+		if _, ok := oldURLs[r.URL]; !ok {
+			added = append(added, r)
+		}
+	}
+	for _, r := range old {
+		if _, ok := curURLs[r.URL]; !ok {
+			removed = append(removed, r)
+		}
+	}
+	return added, removed
+}
+
+// diffFormats lists the -output values supported by the "diff" command.
+var diffFormats = []string{"text", "url", "json"}
+
+// runDiff runs the "diff" command.
+func runDiff(args []string) int {
+	fset := newFlagSet("diff", "[flag]... <old.json> <new.json>",
+		"Prints results that were added to or removed from files written by -output=json.\n"+
+			`Either file may be "-" to read from stdin, e.g. to compare against the current results.`)
+	output := fset.String("output", "text", "Output format ("+strings.Join(diffFormats, ", ")+")")
+	update := fset.Bool("update", false, "Overwrite the old file with the new results afterward "+
+		"(a missing old file is treated as empty)")
+	if !parseFlags(fset, args) {
+		return 2
+	}
+	if fset.NArg() != 2 {
+		fset.Usage()
+		return 2
+	}
+	if !contains(diffFormats, *output) {
+		fmt.Fprintln(os.Stderr, "-output must be one of:", strings.Join(diffFormats, ", "))
+		return 2
+	}
+	oldPath, newPath := fset.Arg(0), fset.Arg(1)
+	if *update && oldPath == "-" {
+		fmt.Fprintln(os.Stderr, "-update requires the old results to be in a file")
+		return 2
+	}
+
+	old, err := readResultsArg(oldPath)
+	if errors.Is(err, fs.ErrNotExist) && *update {
+		old, err = nil, nil
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed reading old results:", err)
+		return 1
+	}
+	cur, err := readResultsArg(newPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed reading new results:", err)
+		return 1
+	}
+	added, removed := diffResults(old, cur)
+	if err := writeDiff(os.Stdout, *output, added, removed); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed writing output:", err)
+		return 1
+	}
+
+	if *update {
+		var b bytes.Buffer
+		if err := writeResults(&b, "json", cur, &outputOptions{}); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed encoding results:", err)
+			return 1
+		}
+		if err := os.WriteFile(oldPath, b.Bytes(), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed updating old results:", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// readResultsArg reads results from the file at p, or from stdin if p is "-".
+func readResultsArg(p string) ([]discover.Result, error) {
+	if p != "-" {
+		return readResultsFile(p)
+	}
+	var results []discover.Result
+	if err := json.NewDecoder(os.Stdin).Decode(&results); err != nil {
+		return nil, fmt.Errorf("stdin: %v", err)
+	}
+	return results, nil
+}
+
+// writeDiff writes added and removed results (from diffResults) to w in format
+// (from diffFormats).
+func writeDiff(w io.Writer, format string, added, removed []discover.Result) error {
+	if format == "json" {
+		// Write "[]" rather than "null" for empty lists.
+		if added == nil {
+			added = []discover.Result{}
+		}
+		if removed == nil {
+			removed = []discover.Result{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Added   []discover.Result `json:"added"`
+			Removed []discover.Result `json:"removed"`
+		}{added, removed})
+	}
+	for _, list := range []struct {
+		prefix  string
+		results []discover.Result
+	}{{"+", added}, {"-", removed}} {
+		for _, r := range list.results {
+			var err error
+			if format == "url" {
+				_, err = fmt.Fprintf(w, "%v %v\n", list.prefix, r.URL)
+			} else {
+				_, err = fmt.Fprintf(w, "%v %v – %v <%v>\n", list.prefix, r.Artist, r.Album, r.URL)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
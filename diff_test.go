@@ -0,0 +1,43 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+func TestDiffResults(t *testing.T) {
+	a := discover.Result{Artist: "A", URL: "https://a.bandcamp.com/album/a"}
+	b := discover.Result{Artist: "B", URL: "https://b.bandcamp.com/album/b"}
+	c := discover.Result{Artist: "C", URL: "https://c.bandcamp.com/album/c"}
+	d := discover.Result{Artist: "D", URL: "https://d.bandcamp.com/album/d"}
+	renamed := discover.Result{Artist: "Renamed", URL: a.URL} // compared by URL
+
+	for _, tc := range []struct {
+		desc           string
+		old, cur       []discover.Result
+		added, removed []discover.Result
+	}{
+		{"empty", nil, nil, nil, nil},
+		{"unchanged", []discover.Result{a, b}, []discover.Result{a, b}, nil, nil},
+		{"reordered", []discover.Result{a, b}, []discover.Result{b, a}, nil, nil},
+		{"renamed", []discover.Result{a}, []discover.Result{renamed}, nil, nil},
+		{"added", []discover.Result{a}, []discover.Result{c, a, b}, []discover.Result{c, b}, nil},
+		{"removed", []discover.Result{a, b, c}, []discover.Result{b}, nil, []discover.Result{a, c}},
+		{"all new", nil, []discover.Result{a, b}, []discover.Result{a, b}, nil},
+		{"all gone", []discover.Result{a, b}, nil, nil, []discover.Result{a, b}},
+		{"mixed", []discover.Result{a, b, c}, []discover.Result{d, b, a}, []discover.Result{d}, []discover.Result{c}},
+	} {
+		added, removed := diffResults(tc.old, tc.cur)
+		if !reflect.DeepEqual(added, tc.added) {
+			t.Errorf("%v: diffResults added %v; want %v", tc.desc, added, tc.added)
+		}
+		if !reflect.DeepEqual(removed, tc.removed) {
+			t.Errorf("%v: diffResults removed %v; want %v", tc.desc, removed, tc.removed)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// emailNotifier sends a digest of results to email recipients via SMTP.
+type emailNotifier struct {
+	addr string    // SMTP server as "host:port"
+	auth smtp.Auth // nil if no authentication is needed
+	from string
+	to   []string
+	html bool // send HTML instead of plain text
+}
+
+// newEmailNotifier returns an emailNotifier that sends mail via the SMTP
+// server at addr ("host:port"). If user is non-empty, PLAIN authentication is
+// used. to is a comma-separated list of recipients.
+func newEmailNotifier(addr, user, pass, from, to string, html bool) (*emailNotifier, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("bad server %q: %v", addr, err)
+	}
+	n := &emailNotifier{addr: addr, from: from, html: html}
+	if user != "" {
+		n.auth = smtp.PlainAuth("", user, pass, host)
+	}
+	for _, s := range strings.Split(to, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			n.to = append(n.to, s)
+		}
+	}
+	if len(n.to) == 0 {
+		return nil, errors.New("no recipients")
+	}
+	if n.from == "" {
+		return nil, errors.New("no sender")
+	}
+	return n, nil
+}
+
+func (n *emailNotifier) notify(ctx context.Context, results []discover.Result) (int, error) {
+	msg, err := n.message(results, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	// net/smtp doesn't support contexts.
+	if err := smtp.SendMail(n.addr, n.auth, n.from, n.to, msg); err != nil {
+		return 0, err
+	}
+	return len(results), nil
+}
+
+// message returns a message listing results, grouped by genre.
+func (n *emailNotifier) message(results []discover.Result, now time.Time) ([]byte, error) {
+	ctype := "text/plain"
+	if n.html {
+		ctype = "text/html"
+	}
+	subject := fmt.Sprintf("%d new Bandcamp release(s)", len(results))
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %v\r\nTo: %v\r\nSubject: %v\r\nDate: %v\r\nMIME-Version: 1.0\r\n"+
+		"Content-Type: %v; charset=UTF-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n",
+		n.from, strings.Join(n.to, ", "), mime.QEncoding.Encode("utf-8", subject),
+		now.Format(time.RFC1123Z), ctype)
+
+	qw := quotedprintable.NewWriter(&b)
+	groups := groupByGenre(results)
+	if n.html {
+		if err := emailTemplate.Execute(qw, struct {
+			Title  string
+			Groups []genreGroup
+		}{subject, groups}); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, g := range groups {
+			fmt.Fprintf(qw, "%v\r\n", g.Label)
+			for _, r := range g.Results {
+				fmt.Fprintf(qw, "  %v – %v\r\n  %v\r\n", r.Artist, r.Album, r.URL)
+			}
+			io.WriteString(qw, "\r\n")
+		}
+	}
+	if err := qw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// genreGroup contains the results from a single genre.
+type genreGroup struct {
+	Label   string // e.g. "electronic/techno"
+	Results []discover.Result
+}
+
+// groupByGenre groups results by genre and subgenre. Groups are sorted by
+// label, and results retain their original order within groups.
+func groupByGenre(results []discover.Result) []genreGroup {
+	var groups []genreGroup
+	idx := make(map[string]int)
+	for _, r := range results {
+		label := genreLabel(r.Genre, r.Subgenre)
+		if label == "" {
+			label = "other"
+		}
+		i, ok := idx[label]
+		if !ok {
+			i = len(groups)
+			idx[label] = i
+			groups = append(groups, genreGroup{Label: label})
+		}
+		groups[i].Results = append(groups[i].Results, r)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Label < groups[j].Label })
+	return groups
+}
+
+// emailTemplate is used to write HTML emails.
+var emailTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body>
+{{- range .Groups}}
+<h2>{{.Label}}</h2>
+<ul>
+{{- range .Results}}
+<li>
+{{- with .ArtURL}}<img src="{{.}}" width="100" height="100" alt=""> {{end -}}
+<a href="{{.URL}}">{{.Artist}} – {{.Album}}</a></li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
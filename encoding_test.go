@@ -0,0 +1,49 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import "testing"
+
+func TestEncodeOutput(t *testing.T) {
+	const in = "Café Tacvba — Ñ\n"
+	for _, tc := range []struct {
+		enc  string
+		want string
+	}{
+		{"utf-8", in},
+		{"utf-8-bom", "\xef\xbb\xbf" + in},
+		{"transliterate-ascii", "Cafe Tacvba - N\n"},
+	} {
+		if got, err := encodeOutput([]byte(in), tc.enc); err != nil {
+			t.Errorf("encodeOutput(%q, %q) failed: %v", in, tc.enc, err)
+		} else if string(got) != tc.want {
+			t.Errorf("encodeOutput(%q, %q) = %q; want %q", in, tc.enc, got, tc.want)
+		}
+	}
+
+	if got, err := encodeOutput([]byte(in), "latin-1"); err == nil {
+		t.Errorf("encodeOutput(%q, %q) = %q; want error", in, "latin-1", got)
+	}
+}
+
+func TestTransliterateASCII(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"plain ASCII\t~", "plain ASCII\t~"},
+		{"Sigur Rós", "Sigur Ros"},
+		{"Mötley Crüe", "Motley Crue"},
+		{"Œuvre Straße Łódź", "OEuvre Strasse Lodz"},
+		{"“Quoted” ‘title’…", `"Quoted" 'title'...`},
+		{"© 2023 €5", "(c) 2023 EUR5"},
+		{"坂本龍一", "????"},                // no approximations
+		{"Björk 🎵", "Bjork ?"},          // one '?' per rune, not per byte
+		{"bad \xff byte", "bad ? byte"}, // invalid UTF-8 decodes to U+FFFD
+	} {
+		if got := transliterateASCII(tc.in); got != tc.want {
+			t.Errorf("transliterateASCII(%q) = %q; want %q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// envPrefix is prepended to flag names to get the names of environment
+// variables that can be used to set them, e.g. BANDCAMP_DISCOVER_CACHE_TTL
+// for -cache-ttl.
+const envPrefix = "BANDCAMP_DISCOVER_"
+
+// envVarName returns the name of the environment variable for the named flag.
+func envVarName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets flags in fset from environ (formatted like os.Environ).
+// Flags that were already set on the command line are left unchanged.
+// Variables starting with envPrefix that correspond to flags in known (but
+// not in fset) are ignored, while an error is returned for other unknown
+// variables. If known is nil, all unknown variables are ignored.
+func applyEnv(fset *flag.FlagSet, environ []string, known map[string]bool) error {
+	names := make(map[string]string) // env var name to flag name
+	fset.VisitAll(func(f *flag.Flag) { names[envVarName(f.Name)] = f.Name })
+	knownVars := make(map[string]bool)
+	for name := range known {
+		knownVars[envVarName(name)] = true
+	}
+	explicit := make(map[string]bool)
+	fset.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	for _, kv := range environ {
+		k, v, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(k, envPrefix) {
+			continue
+		}
+		name, ok := names[k]
+		if !ok {
+			if known != nil && !knownVars[k] {
+				return fmt.Errorf("unknown variable %v", k)
+			}
+			continue
+		}
+		if explicit[name] {
+			continue
+		}
+		if err := fset.Set(name, v); err != nil {
+			return fmt.Errorf("bad %v value: %v", k, err)
+		}
+	}
+	return nil
+}
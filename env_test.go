@@ -0,0 +1,103 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+	"time"
+)
+
+// newTestFlagSet returns a flag set with a few flags of different types.
+func newTestFlagSet() (fset *flag.FlagSet, genre *string, pages *int, ttl *time.Duration, quiet *bool) {
+	fset = flag.NewFlagSet("test", flag.ContinueOnError)
+	fset.SetOutput(io.Discard)
+	genre = fset.String("genre", "all", "")
+	pages = fset.Int("pages", 1, "")
+	ttl = fset.Duration("cache-ttl", 0, "")
+	quiet = fset.Bool("quiet", false, "")
+	return fset, genre, pages, ttl, quiet
+}
+
+func TestEnvVarName(t *testing.T) {
+	for flag, want := range map[string]string{
+		"genre":     "BANDCAMP_DISCOVER_GENRE",
+		"cache-ttl": "BANDCAMP_DISCOVER_CACHE_TTL",
+	} {
+		if got := envVarName(flag); got != want {
+			t.Errorf("envVarName(%q) = %q; want %q", flag, got, want)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	fset, genre, pages, ttl, quiet := newTestFlagSet()
+	if err := fset.Parse([]string{"-pages", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	environ := []string{
+		"HOME=/home/user",
+		"BANDCAMP_DISCOVER_GENRE=rock",
+		"BANDCAMP_DISCOVER_PAGES=5", // overridden by command line
+		"BANDCAMP_DISCOVER_CACHE_TTL=2h",
+		"BANDCAMP_DISCOVER_QUIET=true",
+		"BANDCAMP_DISCOVER_ADDR=:8080", // belongs to another command
+	}
+	known := map[string]bool{"genre": true, "pages": true, "cache-ttl": true, "quiet": true, "addr": true}
+	if err := applyEnv(fset, environ, known); err != nil {
+		t.Fatal("applyEnv failed:", err)
+	}
+	if *genre != "rock" || *pages != 3 || *ttl != 2*time.Hour || !*quiet {
+		t.Errorf("applyEnv set genre=%q pages=%d cache-ttl=%v quiet=%v; want rock, 3, 2h, true",
+			*genre, *pages, *ttl, *quiet)
+	}
+}
+
+func TestApplyEnv_Errors(t *testing.T) {
+	known := map[string]bool{"genre": true, "pages": true, "cache-ttl": true, "quiet": true}
+	for _, tc := range []struct {
+		env   string
+		known map[string]bool
+		ok    bool
+	}{
+		{"BANDCAMP_DISCOVER_PAGES=many", known, false},
+		{"BANDCAMP_DISCOVER_CACHE_TTL=5", known, false},
+		{"BANDCAMP_DISCOVER_BOGUS=1", known, false},
+		{"BANDCAMP_DISCOVER_BOGUS=1", nil, true}, // unknown vars are ignored without known
+		{"OTHER_PAGES=many", known, true},
+	} {
+		fset, _, _, _, _ := newTestFlagSet()
+		if err := applyEnv(fset, []string{tc.env}, tc.known); err == nil && !tc.ok {
+			t.Errorf("applyEnv(%q) succeeded unexpectedly", tc.env)
+		} else if err != nil && tc.ok {
+			t.Errorf("applyEnv(%q) failed: %v", tc.env, err)
+		}
+	}
+}
+
+func TestAllFlagNames(t *testing.T) {
+	// Variables and settings for flags belonging to any command should be
+	// accepted so that they can be shared.
+	names := allFlagNames()
+	for _, name := range []string{"genre", "cache-ttl", "addr", "refresh", "wishlist", "discography", "config"} {
+		if !names[name] {
+			t.Errorf("allFlagNames() doesn't include %q", name)
+		}
+	}
+	if names["bogus"] {
+		t.Error(`allFlagNames() includes "bogus"`)
+	}
+
+	// The discover command's flags don't include "refresh" (used by serve),
+	// but the variable shouldn't be rejected.
+	fset := flag.NewFlagSet("discover", flag.ContinueOnError)
+	fset.String("genre", "all", "")
+	if err := applyEnv(fset, []string{"BANDCAMP_DISCOVER_REFRESH=2h"}, names); err != nil {
+		t.Error("applyEnv with other command's variable failed:", err)
+	}
+	if err := applyEnv(fset, []string{"BANDCAMP_DISCOVER_BOGUS=1"}, names); err == nil {
+		t.Error("applyEnv with unknown variable succeeded")
+	}
+}
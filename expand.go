@@ -0,0 +1,73 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// expandArtists fetches the music pages of the artists of results and returns
+// results describing all of their albums, with at most concurrency requests
+// issued simultaneously. Errors for individual artists are returned
+// separately.
+func expandArtists(ctx context.Context, client *discover.Client, results []discover.Result,
+	concurrency int) ([]discover.Result, []error) {
+	// Use the first result from each artist as a template.
+	var artists []*discover.Result
+	dd := newDeduper(artistKey)
+	for i := range results {
+		if dd.keep(&results[i]) {
+			artists = append(artists, &results[i])
+		}
+	}
+
+	expanded := make([][]discover.Result, len(artists))
+	errs := make([]error, len(artists))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, ar := range artists {
+		wg.Add(1)
+		go func(i int, ar *discover.Result) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			artistURL := "https://" + artistKey(ar)
+			urls, err := client.ArtistAlbums(ctx, artistURL)
+			if err != nil {
+				errs[i] = fmt.Errorf("%v: %v", artistURL, err)
+				return
+			}
+			for _, u := range urls {
+				expanded[i] = append(expanded[i], discover.Result{
+					Artist:   ar.Artist,
+					URL:      u,
+					Type:     "album",
+					Genre:    ar.Genre,
+					Subgenre: ar.Subgenre,
+					Ranking:  ar.Ranking,
+				})
+			}
+		}(i, ar)
+	}
+	wg.Wait()
+
+	var all []discover.Result
+	var failed []error
+	for i, res := range expanded {
+		all = append(all, res...)
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+		}
+	}
+	return all, failed
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// redirectTransport sends all requests to a test server while preserving
+// their original hosts in Request.Host.
+type redirectTransport struct{ srv *url.URL }
+
+func (rt *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Host = req.URL.Host
+	req.URL.Scheme = rt.srv.Scheme
+	req.URL.Host = rt.srv.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newRedirectClient returns a discover.Client that sends all requests to srv.
+func newRedirectClient(t *testing.T, srv *httptest.Server) *discover.Client {
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &discover.Client{HTTPClient: &http.Client{Transport: &redirectTransport{u}}}
+}
+
+func TestExpandArtists(t *testing.T) {
+	var mu sync.Mutex
+	reqs := make(map[string]int) // keyed by host and path
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		reqs[r.Host+r.URL.Path]++
+		mu.Unlock()
+		if r.URL.Path != "/music" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Host {
+		case "a.bandcamp.com":
+			fmt.Fprint(w, `<ol id="music-grid">`+
+				`<li class="music-grid-item"><a href="/album/one">One</a></li>`+
+				`<li class="music-grid-item"><a href="/album/two">Two</a></li>`+
+				`<li class="music-grid-item"><a href="/track/single">Single</a></li></ol>`)
+		case "b.example.org":
+			fmt.Fprint(w, `<ol id="music-grid" data-client-items="[{&quot;page_url&quot;:&quot;https://b.example.org/album/three&quot;}]"></ol>`)
+		default:
+			http.Error(w, "no such artist", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	results := []discover.Result{
+		{Artist: "A", Album: "One", URL: "https://a.bandcamp.com/album/one", Genre: "rock", Ranking: "top"},
+		{Artist: "Broken", Album: "X", URL: "https://broken.bandcamp.com/album/x"},
+		{Artist: "A", Album: "Two", URL: "https://A.bandcamp.com/album/two", Genre: "jazz"},
+		{Artist: "B", Album: "Three", URL: "https://b.example.org/album/three", Genre: "pop", Subgenre: "indie"},
+	}
+	got, errs := expandArtists(context.Background(), newRedirectClient(t, srv), results, 2)
+
+	// Each artist should only be fetched once, using its first result as a template.
+	want := []discover.Result{
+		{Artist: "A", URL: "https://a.bandcamp.com/album/one", Type: "album", Genre: "rock", Ranking: "top"},
+		{Artist: "A", URL: "https://a.bandcamp.com/album/two", Type: "album", Genre: "rock", Ranking: "top"},
+		{Artist: "B", URL: "https://b.example.org/album/three", Type: "album", Genre: "pop", Subgenre: "indie"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expandArtists returned %+v; want %+v", got, want)
+	}
+	for _, p := range []string{"a.bandcamp.com/music", "b.example.org/music", "broken.bandcamp.com/music"} {
+		if n := reqs[p]; n != 1 {
+			t.Errorf("%v requested %d time(s); want 1", p, n)
+		}
+	}
+
+	// The failing artist should be reported separately.
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "https://broken.bandcamp.com") {
+		t.Errorf("expandArtists returned errors %v; want one for broken.bandcamp.com", errs)
+	}
+}
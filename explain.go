@@ -0,0 +1,70 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// explainer writes -explain output describing why items were kept or
+// rejected. Methods may be called on a nil explainer, in which case they do
+// nothing.
+type explainer struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// skip reports that item (as described by discover.Client.SkipFunc) was
+// rejected for the supplied reason.
+func (e *explainer) skip(item, reason string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fmt.Fprintf(e.w, "Rejected %v: %v\n", item, reason)
+}
+
+// reject reports that r was rejected for the supplied reason.
+func (e *explainer) reject(r *discover.Result, reason string) {
+	if e != nil {
+		e.skip(describeResult(r), reason)
+	}
+}
+
+// keep reports that each of results was kept.
+func (e *explainer) keep(results []discover.Result) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := range results {
+		fmt.Fprintf(e.w, "Kept %v\n", describeResult(&results[i]))
+	}
+}
+
+// describeResult returns a short description of r for -explain.
+func describeResult(r *discover.Result) string {
+	return fmt.Sprintf("%q by %q (%v)", r.Album, r.Artist, r.URL)
+}
+
+// filterResults returns the results in rs for which keep returns true.
+// reason is passed to e for rejected results.
+func filterResults(rs []discover.Result, keep func(r *discover.Result) bool,
+	e *explainer, reason string) []discover.Result {
+	var kept []discover.Result
+	for i := range rs {
+		if keep(&rs[i]) {
+			kept = append(kept, rs[i])
+		} else {
+			e.reject(&rs[i], reason)
+		}
+	}
+	return kept
+}
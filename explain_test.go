@@ -0,0 +1,51 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+func TestExplainer(t *testing.T) {
+	results := []discover.Result{
+		{Artist: "A", Album: "Cheap", URL: "https://a.bandcamp.com/album/cheap",
+			Details: &discover.AlbumDetails{Price: 5, Currency: "USD"}},
+		{Artist: "A", Album: "Cheap", URL: "https://a.bandcamp.com/album/cheap"},
+		{Artist: "B", Album: "Pricey", URL: "https://b.bandcamp.com/album/pricey",
+			Details: &discover.AlbumDetails{Price: 20, Currency: "USD"}},
+		{Artist: "C", Album: "Euros", URL: "https://c.bandcamp.com/album/euros",
+			Details: &discover.AlbumDetails{Price: 1, Currency: "EUR"}},
+		{Artist: "D", Album: "Unknown", URL: "https://d.bandcamp.com/album/unknown"},
+	}
+
+	var b bytes.Buffer
+	exp := &explainer{w: &b}
+	exp.skip(`"Item" by "E"`, "missing required fields")
+	kept := filterResults(results, newDeduper(dedupKeys["url"]).keep, exp, "already seen")
+	kept = priceResults(kept, price{10, "USD"}, exp)
+	exp.keep(kept)
+
+	// Each rejection should be attributed to the filter that made it.
+	const want = `Rejected "Item" by "E": missing required fields
+Rejected "Cheap" by "A" (https://a.bandcamp.com/album/cheap): already seen
+Rejected "Pricey" by "B" (https://b.bandcamp.com/album/pricey): price 20.00 USD exceeds 10.00 USD
+Rejected "Euros" by "C" (https://c.bandcamp.com/album/euros): price in EUR
+Rejected "Unknown" by "D" (https://d.bandcamp.com/album/unknown): price unknown
+Kept "Cheap" by "A" (https://a.bandcamp.com/album/cheap)
+`
+	if got := b.String(); got != want {
+		t.Errorf("explainer wrote:\n%s\nwant:\n%s", got, want)
+	}
+
+	// A nil explainer should be usable.
+	var nilExp *explainer
+	nilExp.skip("item", "reason")
+	if got := filterResults(results, func(*discover.Result) bool { return false }, nilExp, "x"); len(got) != 0 {
+		t.Errorf("filterResults with nil explainer kept %v", got)
+	}
+	nilExp.keep(results)
+}
@@ -0,0 +1,202 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// runFan runs the "fan" command.
+func runFan(args []string) int {
+	fset := newFlagSet("fan", "[flag]... <username-or-url>...",
+		"Prints albums in Bandcamp fans' public collections (e.g. https://bandcamp.com/username)\n"+
+			"or wishlists, newest first.")
+	wishlist := fset.Bool("wishlist", false, "List fans' wishlists instead of their collections")
+	typ := fset.String("type", "all", "Type of results to print (album, track, all)")
+	limit := fset.Int("limit", 0, "Maximum number of results to print per fan (0 for no limit)")
+	output := fset.String("output", "url", "Output format ("+strings.Join(sortedKeys(outputFormats), ", ")+")")
+	dedupBy := fset.String("dedup-by", "url", "Skip results with duplicate keys (url, artist, album)")
+	newOnly := fset.Bool("new-only", false, "Only print results that weren't printed by previous runs (see -seen-db)")
+	seenDBPath := fset.String("seen-db", "", "File recording all printed results "+
+		"(used with -new-only; defaults to "+seenFileName+" in the cache directory)")
+	details := fset.Bool("details", false, "Fetch each result's page to add its release date, label, tags, "+
+		"price, and track count to -output=json, jsonl, csv, and tsv")
+	maxPriceFlag := fset.String("max-price", "", "Only print results with minimum digital prices at most this, "+
+		`e.g. "10" or "10 EUR" (implies -details; a currency also omits results priced in others)`)
+	nyp := fset.Bool("nyp", false, "Only print name-your-price results (implies -details)")
+	free := fset.Bool("free", false, "Only print results that can be downloaded for free (implies -details)")
+	withTracks := fset.Bool("tracks", false, "With -details, also add track titles and durations")
+	concurrency := fset.Int("concurrency", 1, "Maximum number of simultaneous album page requests for -details")
+	explain := fset.Bool("explain", false, "Print to stderr why each item was kept or rejected")
+	quiet := fset.Bool("quiet", false, "Suppress warnings")
+	cf := addClientFlags(fset)
+	if !parseFlags(fset, args) {
+		return 2
+	}
+	if fset.NArg() == 0 {
+		fset.Usage()
+		return 2
+	}
+	if _, ok := outputFormats[*output]; !ok {
+		fmt.Fprintln(os.Stderr, "-output must be one of:", strings.Join(sortedKeys(outputFormats), ", "))
+		return 2
+	}
+	if *typ != "all" && !contains(discover.Types, *typ) {
+		fmt.Fprintln(os.Stderr, "-type must be one of: all,", strings.Join(discover.Types, ", "))
+		return 2
+	}
+	if *limit < 0 {
+		fmt.Fprintln(os.Stderr, "-limit must be non-negative")
+		return 2
+	}
+	if *concurrency <= 0 {
+		fmt.Fprintln(os.Stderr, "-concurrency must be positive")
+		return 2
+	}
+	dedupKey, ok := dedupKeys[*dedupBy]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "-dedup-by must be one of:", strings.Join(sortedKeys(dedupKeys), ", "))
+		return 2
+	}
+	df := detailFilter{nyp: *nyp, free: *free, withTracks: *withTracks, concurrency: *concurrency, quiet: *quiet}
+	if *maxPriceFlag != "" {
+		mp, err := parsePrice(*maxPriceFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Bad -max-price value:", err)
+			return 2
+		}
+		df.maxPrice = &mp
+		*details = true
+	}
+	*details = *details || *nyp || *free
+	if *withTracks && !*details {
+		fmt.Fprintln(os.Stderr, "-tracks requires -details")
+		return 2
+	}
+	if *seenDBPath == "" && *newOnly {
+		*seenDBPath = defaultSeenDB()
+	}
+	var seen *seenDB
+	if *seenDBPath != "" {
+		var err error
+		if seen, err = openSeenDB(*seenDBPath); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed reading seen database:", err)
+			return 1
+		}
+	} else if *newOnly {
+		fmt.Fprintln(os.Stderr, "-new-only requires -seen-db")
+		return 2
+	}
+	var exp *explainer
+	if *explain {
+		exp = &explainer{w: os.Stderr}
+	}
+	client, err := cf.newClient()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if exp != nil {
+		client.SkipFunc = exp.skip
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	list, fetch := "collection", client.FanCollection
+	if *wishlist {
+		list, fetch = "wishlist", client.FanWishlist
+	}
+
+	var status int
+	var results []discover.Result
+	var names []string
+	for _, arg := range fset.Args() {
+		name := fanUsername(arg)
+		// With -type, the limit is applied after filtering so it counts printed results.
+		max := *limit
+		if *typ != "all" {
+			max = 0
+		}
+		res, err := fetch(ctx, name, max)
+		if interrupted(ctx) {
+			return interruptedStatus
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed getting %v for %v: %v\n", list, arg, err)
+			status = 1
+			continue
+		}
+		var kept []discover.Result
+		for _, r := range res {
+			if *typ == "all" || r.Type == *typ {
+				kept = append(kept, r)
+			}
+		}
+		if *limit > 0 && len(kept) > *limit {
+			kept = kept[:*limit]
+		}
+		results = append(results, kept...)
+		names = append(names, name)
+	}
+	results = filterResults(results, newDeduper(dedupKey).keep, exp, "already seen")
+	if *newOnly {
+		results = seen.filterNew(results, exp)
+	}
+	if *details {
+		results = filterDetails(ctx, client, results, df, exp)
+		if interrupted(ctx) {
+			return interruptedStatus
+		}
+	}
+
+	exp.keep(results)
+
+	title := fmt.Sprintf("Bandcamp %v: %v", list, strings.Join(names, ", "))
+	opts := outputOptions{title: title, warnings: os.Stderr}
+	if cols := defaultColumns[*output]; cols != "" {
+		if *details {
+			cols += "," + detailColumns
+			if *withTracks {
+				cols += "," + trackColumns
+			}
+		}
+		opts.columns, _ = parseColumns(cols)
+	}
+	if seen != nil {
+		opts.firstSeen = seen.firstSeen
+	}
+	if err := writeResults(os.Stdout, *output, results, &opts); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed writing output:", err)
+		return 1
+	}
+	if seen != nil {
+		if _, err := seen.add(results, time.Now()); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed updating seen database:", err)
+			return 1
+		}
+	}
+	return status
+}
+
+// fanUsername returns the username from s, which is either a fan page URL like
+// "https://bandcamp.com/username" or a bare username.
+func fanUsername(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	name, _, _ := strings.Cut(strings.Trim(u.Path, "/"), "/")
+	return name
+}
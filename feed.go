@@ -0,0 +1,177 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// feedLink is used as the feed-level link in RSS and Atom feeds.
+const feedLink = "https://bandcamp.com/discover"
+
+// feedItemTitle returns the title to use for r's feed entry.
+func feedItemTitle(r *discover.Result) string {
+	return r.Artist + " — " + r.Album
+}
+
+// feedItemDescription returns the description to use for r's feed entry.
+func feedItemDescription(r *discover.Result) string {
+	desc := r.Album + " by " + r.Artist
+	if r.Genre != "" {
+		desc += " (" + genreLabel(r.Genre, r.Subgenre) + ")"
+	}
+	return desc
+}
+
+// firstSeenFunc returns the time at which the result with URL u was first
+// seen. ok is false if it hasn't been seen before.
+type firstSeenFunc func(u string) (t time.Time, ok bool)
+
+// itemTime returns the publication time to use for the feed entry for the
+// result with URL u. firstSeen may be nil, in which case now is used.
+func itemTime(firstSeen firstSeenFunc, u string, now time.Time) time.Time {
+	if firstSeen != nil {
+		if t, ok := firstSeen(u); ok {
+			return t
+		}
+	}
+	return now
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	Description string        `xml:"description"`
+	Category    string        `xml:"category,omitempty"`
+	GUID        string        `xml:"guid"`
+	PubDate     string        `xml:"pubDate"` // time at which the result was discovered
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int    `xml:"length,attr"` // unknown, so always 0
+	Type   string `xml:"type,attr"`
+}
+
+// writeRSS writes results to w as an RSS 2.0 feed with the supplied title.
+// Items are dated using firstSeen (which may be nil) or now.
+func writeRSS(w io.Writer, title string, results []discover.Result, firstSeen firstSeenFunc, now time.Time) error {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         title,
+			Link:          feedLink,
+			Description:   title,
+			LastBuildDate: now.Format(time.RFC1123Z),
+		},
+	}
+	for i := range results {
+		r := &results[i]
+		item := rssItem{
+			Title:       feedItemTitle(r),
+			Link:        r.URL,
+			Description: feedItemDescription(r),
+			Category:    r.Genre,
+			GUID:        r.URL,
+			PubDate:     itemTime(firstSeen, r.URL, now).Format(time.RFC1123Z),
+		}
+		if art := r.ArtURL(); art != "" {
+			item.Enclosure = &rssEnclosure{URL: art, Type: "image/jpeg"}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	return writeXML(w, feed)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	ID        string     `xml:"id"`
+	Published string     `xml:"published"` // time at which the result was discovered
+	Updated   string     `xml:"updated"`
+	Author    atomAuthor `xml:"author"` // required since the feed has no author
+	Summary   string     `xml:"summary"`
+	Links     []atomLink `xml:"link"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+// writeAtom writes results to w as an Atom feed with the supplied title.
+// Entries are dated using firstSeen (which may be nil) or now.
+func writeAtom(w io.Writer, title string, results []discover.Result, firstSeen firstSeenFunc, now time.Time) error {
+	updated := now.UTC().Format(time.RFC3339)
+	feed := atomFeed{
+		Title:   title,
+		ID:      feedLink,
+		Updated: updated,
+		Links:   []atomLink{{Href: feedLink}},
+	}
+	for i := range results {
+		r := &results[i]
+		published := itemTime(firstSeen, r.URL, now).UTC().Format(time.RFC3339)
+		entry := atomEntry{
+			Title:     feedItemTitle(r),
+			ID:        r.URL,
+			Published: published,
+			Updated:   published,
+			Author:    atomAuthor{Name: r.Artist},
+			Summary:   feedItemDescription(r),
+			Links:     []atomLink{{Href: r.URL}},
+		}
+		if art := r.ArtURL(); art != "" {
+			entry.Links = append(entry.Links, atomLink{Href: art, Rel: "enclosure", Type: "image/jpeg"})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return writeXML(w, feed)
+}
+
+// writeXML writes an XML header followed by the indented encoding of v to w.
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// feedResults and feedFirstSeen are used by feed tests. The first result was
+// seen before and the second one wasn't.
+var feedResults = []discover.Result{
+	{Artist: "A", Album: "One", URL: "https://a.bandcamp.com/album/one", ArtID: 123, Genre: "rock"},
+	{Artist: "B", Album: "Two", URL: "https://b.bandcamp.com/album/two"},
+}
+
+var feedSeenTime = time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func feedFirstSeen(u string) (time.Time, bool) {
+	if u == feedResults[0].URL {
+		return feedSeenTime, true
+	}
+	return time.Time{}, false
+}
+
+func TestWriteRSS(t *testing.T) {
+	now := time.Date(2023, 2, 3, 4, 5, 6, 0, time.UTC)
+	var b bytes.Buffer
+	if err := writeRSS(&b, "Title", feedResults, feedFirstSeen, now); err != nil {
+		t.Fatal("writeRSS failed:", err)
+	}
+	var feed rssFeed
+	if err := xml.Unmarshal(b.Bytes(), &feed); err != nil {
+		t.Fatalf("Failed parsing RSS: %v\n%s", err, b.String())
+	}
+	if feed.Version != "2.0" || feed.Channel.Title != "Title" {
+		t.Errorf("Got version %q and title %q; want 2.0 and Title", feed.Version, feed.Channel.Title)
+	}
+	items := feed.Channel.Items
+	if len(items) != len(feedResults) {
+		t.Fatalf("Got %d item(s); want %d", len(items), len(feedResults))
+	}
+	for i, want := range []struct {
+		pubDate   time.Time
+		enclosure *rssEnclosure
+	}{
+		{feedSeenTime, &rssEnclosure{URL: feedResults[0].ArtURL(), Type: "image/jpeg"}},
+		{now, nil},
+	} {
+		it := items[i]
+		if it.GUID != feedResults[i].URL || it.Link != feedResults[i].URL {
+			t.Errorf("Item %d has GUID %q and link %q; want %q", i, it.GUID, it.Link, feedResults[i].URL)
+		}
+		if pd, err := time.Parse(time.RFC1123Z, it.PubDate); err != nil || !pd.Equal(want.pubDate) {
+			t.Errorf("Item %d has pubDate %q; want %v", i, it.PubDate, want.pubDate)
+		}
+		if !reflect.DeepEqual(it.Enclosure, want.enclosure) {
+			t.Errorf("Item %d has enclosure %+v; want %+v", i, it.Enclosure, want.enclosure)
+		}
+	}
+}
+
+func TestWriteAtom(t *testing.T) {
+	now := time.Date(2023, 2, 3, 4, 5, 6, 0, time.UTC)
+	var b bytes.Buffer
+	if err := writeAtom(&b, "Title", feedResults, feedFirstSeen, now); err != nil {
+		t.Fatal("writeAtom failed:", err)
+	}
+	var feed atomFeed
+	if err := xml.Unmarshal(b.Bytes(), &feed); err != nil {
+		t.Fatalf("Failed parsing Atom: %v\n%s", err, b.String())
+	}
+	if feed.Title != "Title" || feed.Updated != now.Format(time.RFC3339) {
+		t.Errorf("Got title %q and updated %q", feed.Title, feed.Updated)
+	}
+	if len(feed.Entries) != len(feedResults) {
+		t.Fatalf("Got %d entries; want %d", len(feed.Entries), len(feedResults))
+	}
+	for i, want := range []struct {
+		published time.Time
+		links     []atomLink
+	}{
+		{feedSeenTime, []atomLink{
+			{Href: feedResults[0].URL},
+			{Href: feedResults[0].ArtURL(), Rel: "enclosure", Type: "image/jpeg"},
+		}},
+		{now, []atomLink{{Href: feedResults[1].URL}}},
+	} {
+		e := feed.Entries[i]
+		if e.ID != feedResults[i].URL {
+			t.Errorf("Entry %d has ID %q; want %q", i, e.ID, feedResults[i].URL)
+		}
+		if p, err := time.Parse(time.RFC3339, e.Published); err != nil || !p.Equal(want.published) {
+			t.Errorf("Entry %d has published time %q; want %v", i, e.Published, want.published)
+		}
+		if !reflect.DeepEqual(e.Links, want.links) {
+			t.Errorf("Entry %d has links %+v; want %+v", i, e.Links, want.links)
+		}
+	}
+}
+
+func TestWriteRSS_NoFirstSeen(t *testing.T) {
+	// Without first-seen times, all items are dated now.
+	now := time.Date(2023, 2, 3, 4, 5, 6, 0, time.UTC)
+	var b bytes.Buffer
+	if err := writeRSS(&b, "Title", feedResults, nil, now); err != nil {
+		t.Fatal("writeRSS failed:", err)
+	}
+	var feed rssFeed
+	if err := xml.Unmarshal(b.Bytes(), &feed); err != nil {
+		t.Fatal("Failed parsing RSS:", err)
+	}
+	for i, it := range feed.Channel.Items {
+		if want := now.Format(time.RFC1123Z); it.PubDate != want {
+			t.Errorf("Item %d has pubDate %q; want %q", i, it.PubDate, want)
+		}
+	}
+}
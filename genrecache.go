@@ -0,0 +1,113 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// genresFileName is the name of the file within -cache-dir that holds the
+// genre map written by -update-genres.
+const genresFileName = "genres.json"
+
+// embeddedGenres holds the genres compiled into the program, before
+// loadSavedGenres merges saved genres into discover.Genres.
+var embeddedGenres = discover.Genres
+
+// loadSavedGenres merges the genres saved in dir by updateGenresFile (if any)
+// into discover.Genres. Nothing is done if dir is empty.
+func loadSavedGenres(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	saved, err := readGenresFile(dir)
+	if err != nil {
+		return err
+	}
+	if saved != nil {
+		discover.Genres = discover.MergeGenres(embeddedGenres, saved)
+	}
+	return nil
+}
+
+// readGenresFile reads a genre map written by writeGenresFile from dir.
+// A nil map is returned if the file doesn't exist.
+func readGenresFile(dir string) (map[string][]string, error) {
+	b, err := os.ReadFile(filepath.Join(dir, genresFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var genres map[string][]string
+	if err := json.Unmarshal(b, &genres); err != nil {
+		return nil, err
+	}
+	return genres, nil
+}
+
+// writeGenresFile writes genres to a file in dir, creating dir if needed.
+func writeGenresFile(dir string, genres map[string][]string) error {
+	b, err := json.MarshalIndent(genres, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	p := filepath.Join(dir, genresFileName)
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// updateGenresFile fetches Bandcamp's current genres and saves them to dir.
+// Differences from the embedded genres are printed to stderr unless quiet is
+// true. The process's exit status is returned.
+func updateGenresFile(ctx context.Context, client *discover.Client, dir string, quiet bool) int {
+	live, err := client.FetchGenres(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed getting genres:", err)
+		return 1
+	}
+	if err := writeGenresFile(dir, live); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed saving genres:", err)
+		return 1
+	}
+	if !quiet {
+		for _, d := range discover.DiffGenres(embeddedGenres, live) {
+			fmt.Fprintln(os.Stderr, d)
+		}
+	}
+	return 0
+}
+
+// checkStaleGenres fetches Bandcamp's current genres and prints their
+// differences from the embedded genres to stdout. The process's exit status
+// is returned: 1 if there are differences or an error occurred, and 0 otherwise.
+func checkStaleGenres(ctx context.Context, client *discover.Client) int {
+	live, err := client.FetchGenres(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed getting genres:", err)
+		return 1
+	}
+	diffs := discover.DiffGenres(embeddedGenres, live)
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if len(diffs) > 0 {
+		return 1
+	}
+	return 0
+}
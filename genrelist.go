@@ -0,0 +1,91 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// genreListFlag implements flag.Value for -genre, which may be repeated.
+type genreListFlag []string
+
+func (f *genreListFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *genreListFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+// genreSpec describes a genre and (possibly empty) subgenre to query.
+type genreSpec struct{ genre, subgenre string }
+
+func (s genreSpec) String() string { return genreLabel(s.genre, s.subgenre) }
+
+// parseGenreList parses -genre values, each containing comma-separated "genre"
+// or "genre/subgenre" items. Items without slashes that follow items with
+// subgenres are treated as additional subgenres of the same genre, so
+// "electronic/techno,house" is equivalent to "electronic/techno" and
+// "electronic/house". Duplicate items are dropped.
+func parseGenreList(vals []string) ([]genreSpec, error) {
+	var specs []genreSpec
+	seen := make(map[genreSpec]struct{})
+	for _, val := range vals {
+		var prev string // genre of previous item if it had a subgenre
+		for _, item := range strings.Split(val, ",") {
+			if prev != "" && !strings.Contains(item, "/") {
+				item = prev + "/" + item
+			}
+			genre, subgenre, err := discover.ParseGenreSpec(item)
+			if err != nil {
+				return nil, err
+			}
+			if subgenre != "" {
+				prev = genre
+			} else {
+				prev = ""
+			}
+			spec := genreSpec{genre, subgenre}
+			if _, ok := seen[spec]; !ok {
+				seen[spec] = struct{}{}
+				specs = append(specs, spec)
+			}
+		}
+	}
+	return specs, nil
+}
+
+// expandSubgenres returns a copy of specs in which each spec without a
+// subgenre is replaced by specs for all of the genre's known subgenres.
+// Catch-all subgenres like "all-jazz" are omitted.
+func expandSubgenres(specs []genreSpec) ([]genreSpec, error) {
+	var expanded []genreSpec
+	for _, spec := range specs {
+		if spec.subgenre != "" {
+			expanded = append(expanded, spec)
+			continue
+		}
+		subs := discover.Genres[spec.genre]
+		if len(subs) == 0 {
+			return nil, fmt.Errorf("no known subgenres for %q", spec.genre)
+		}
+		for _, sub := range subs {
+			if !strings.HasPrefix(sub, "all-") {
+				expanded = append(expanded, genreSpec{spec.genre, sub})
+			}
+		}
+	}
+	return expanded, nil
+}
+
+// genreListLabel returns a comma-separated description of specs.
+func genreListLabel(specs []genreSpec) string {
+	labels := make([]string, len(specs))
+	for i, s := range specs {
+		labels[i] = s.String()
+	}
+	return strings.Join(labels, ",")
+}
@@ -0,0 +1,79 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseGenreList(t *testing.T) {
+	for _, tc := range []struct {
+		vals []string
+		want []genreSpec // nil if an error is expected
+	}{
+		{[]string{"rock"}, []genreSpec{{"rock", ""}}},
+		{[]string{"rock,Jazz"}, []genreSpec{{"rock", ""}, {"jazz", ""}}},
+		{[]string{"metal/doom,sludge-metal"}, []genreSpec{{"metal", "doom"}, {"metal", "sludge-metal"}}},
+		{[]string{"electronic/techno,house,rock/indie,punk"}, []genreSpec{
+			{"electronic", "techno"}, {"electronic", "house"}, {"rock", "indie"}, {"rock", "punk"}}},
+		// Subgenres don't carry over between -genre values.
+		{[]string{"metal/doom", "jazz"}, []genreSpec{{"metal", "doom"}, {"jazz", ""}}},
+		// Duplicates are dropped.
+		{[]string{"metal/doom,doom", "metal/doom", "rock"}, []genreSpec{{"metal", "doom"}, {"rock", ""}}},
+		{[]string{"metal/doom,"}, nil},
+		{[]string{"a/b/c"}, nil},
+	} {
+		got, err := parseGenreList(tc.vals)
+		if tc.want == nil {
+			if err == nil {
+				t.Errorf("parseGenreList(%q) = %v; want error", tc.vals, got)
+			}
+		} else if err != nil {
+			t.Errorf("parseGenreList(%q) failed: %v", tc.vals, err)
+		} else if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseGenreList(%q) = %v; want %v", tc.vals, got, tc.want)
+		}
+	}
+}
+
+func TestRunDiscover_Subgenres(t *testing.T) {
+	var mu sync.Mutex
+	var queried []string
+	srv := newAPIServer(t, func(vals url.Values) ([]string, int, error) {
+		label := genreLabel(vals.Get("g"), vals.Get("t"))
+		mu.Lock()
+		queried = append(queried, label)
+		mu.Unlock()
+		switch label {
+		case "metal/doom":
+			return []string{"d1", "shared"}, 2, nil
+		case "metal/sludge-metal":
+			return []string{"shared", "s1"}, 2, nil
+		}
+		t.Errorf("Unexpected query for %q", label)
+		return nil, 0, nil
+	})
+
+	status, stdout, stderr := runDiscoverTest(t, srv, "-genre", "metal/doom,bogus,sludge-metal")
+	if status != 0 {
+		t.Fatalf("runDiscover exited with %d: %s", status, stderr)
+	}
+	sort.Strings(queried)
+	if want := []string{"metal/doom", "metal/sludge-metal"}; !reflect.DeepEqual(queried, want) {
+		t.Errorf("Server received queries %q; want %q", queried, want)
+	}
+	// Results should be merged without duplicates.
+	if want := testAlbumURL("d1") + "\n" + testAlbumURL("shared") + "\n" + testAlbumURL("s1") + "\n"; stdout != want {
+		t.Errorf("runDiscover printed %q; want %q", stdout, want)
+	}
+	// The unknown subgenre should be reported without aborting the run.
+	if !strings.Contains(stderr, "Warning: skipping metal/bogus") {
+		t.Errorf("runDiscover didn't warn about unknown subgenre: %q", stderr)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// historyFormats lists the -output values supported by the "history" command.
+var historyFormats = []string{"text", "json"}
+
+// historyDateLayout is the layout used for -since and -until.
+const historyDateLayout = "2006-01-02"
+
+// runHistory runs the "history" command.
+func runHistory(args []string) int {
+	fset := newFlagSet("history", "[flag]...", "Lists when results were first printed, according to -seen-db.")
+	seenDBPath := fset.String("seen-db", defaultSeenDB(), "File recording all printed results")
+	genre := fset.String("genre", "", `Only list results from this genre or genre/subgenre (e.g. "electronic/techno")`)
+	since := fset.String("since", "", "Only list results first seen on or after this YYYY-MM-DD date")
+	until := fset.String("until", "", "Only list results first seen before this YYYY-MM-DD date")
+	output := fset.String("output", "text", "Output format ("+strings.Join(historyFormats, ", ")+")")
+	if !parseFlags(fset, args) {
+		return 2
+	}
+	if fset.NArg() > 0 {
+		fset.Usage()
+		return 2
+	}
+	if !contains(historyFormats, *output) {
+		fmt.Fprintln(os.Stderr, "-output must be one of:", strings.Join(historyFormats, ", "))
+		return 2
+	}
+	var wantGenre, wantSubgenre string
+	if *genre != "" {
+		var err error
+		if wantGenre, wantSubgenre, err = discover.ParseGenreSpec(*genre); err != nil {
+			fmt.Fprintln(os.Stderr, "Bad -genre value:", err)
+			return 2
+		}
+		wantGenre, _ = resolveGenreAlias(wantGenre)
+	}
+	var start, end time.Time
+	for _, d := range []struct {
+		name, val string
+		dst       *time.Time
+	}{{"since", *since, &start}, {"until", *until, &end}} {
+		if d.val == "" {
+			continue
+		}
+		t, err := time.ParseInLocation(historyDateLayout, d.val, time.Local)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Bad -%v value: %q isn't a YYYY-MM-DD date\n", d.name, d.val)
+			return 2
+		}
+		*d.dst = t
+	}
+	if *seenDBPath == "" {
+		fmt.Fprintln(os.Stderr, "-seen-db must be set")
+		return 2
+	}
+
+	db, err := openSeenDB(*seenDBPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed reading seen database:", err)
+		return 1
+	}
+	var entries []seenEntry
+	for _, e := range db.entries {
+		if (wantGenre != "" && e.Genre != wantGenre) ||
+			(wantSubgenre != "" && e.Subgenre != wantSubgenre) ||
+			(!start.IsZero() && e.FirstSeen.Before(start)) ||
+			(!end.IsZero() && !e.FirstSeen.Before(end)) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	switch *output {
+	case "json":
+		if entries == nil {
+			entries = []seenEntry{} // write "[]" rather than "null"
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(entries)
+	default:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%v\t%v\t%v – %v\t%v\n", e.FirstSeen.Local().Format("2006-01-02 15:04"),
+				genreLabel(e.Genre, e.Subgenre), e.Artist, e.Album, e.URL)
+		}
+		err = tw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed writing output:", err)
+		return 1
+	}
+	return 0
+}
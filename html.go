@@ -0,0 +1,49 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"html/template"
+	"io"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// htmlTemplate is used to write results as a self-contained HTML page.
+var htmlTemplate = template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em; background: #fff; color: #222; }
+h1 { font-size: 1.5em; }
+ul { display: grid; grid-template-columns: repeat(auto-fill, minmax(180px, 1fr)); gap: 1em; list-style: none; padding: 0; }
+li a { color: inherit; text-decoration: none; }
+li img, li .noart { display: block; width: 100%; aspect-ratio: 1; object-fit: cover; background: #ddd; }
+.album { font-weight: bold; margin-top: 0.3em; }
+.artist { color: #666; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<ul>
+{{- range .Results}}
+<li><a href="{{.URL}}">
+{{- with .ArtURL}}<img src="{{.}}" alt="" loading="lazy">{{else}}<div class="noart"></div>{{end -}}
+<div class="album">{{.Album}}</div><div class="artist">{{.Artist}}</div></a></li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+// writeHTML writes results to w as an HTML page with the supplied title.
+func writeHTML(w io.Writer, title string, results []discover.Result) error {
+	return htmlTemplate.Execute(w, struct {
+		Title   string
+		Results []discover.Result
+	}{title, results})
+}
@@ -0,0 +1,148 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// selectResults lists results on w and reads commands from r to let the user
+// choose some of them. The chosen results are returned in their original order.
+//
+// Lines can contain numbers and ranges like "1 3 5-7" to toggle results,
+// "/text" to only list results that fuzzily match text ("/" lists all results),
+// "a" to select all listed results, or "q" to select nothing. An empty line
+// finishes the selection.
+func selectResults(r io.Reader, w io.Writer, results []discover.Result) ([]discover.Result, error) {
+	selected := make([]bool, len(results))
+	var filter string
+	br := bufio.NewReader(r)
+	for {
+		var shown []int // indexes into results
+		for i := range results {
+			if fuzzyMatch(filter, resultSearchText(&results[i])) {
+				shown = append(shown, i)
+			}
+		}
+		nsel := 0
+		for _, s := range selected {
+			if s {
+				nsel++
+			}
+		}
+		for _, i := range shown {
+			mark := ' '
+			if selected[i] {
+				mark = '*'
+			}
+			res := &results[i]
+			fmt.Fprintf(w, "%c%3d. %v – %v", mark, i+1, res.Artist, res.Album)
+			if res.Genre != "" {
+				fmt.Fprintf(w, " (%v)", genreLabel(res.Genre, res.Subgenre))
+			}
+			fmt.Fprintln(w)
+		}
+		if filter != "" {
+			fmt.Fprintf(w, "Showing %d of %d matching %q\n", len(shown), len(results), filter)
+		}
+		fmt.Fprintf(w, "%d selected. Toggle (e.g. \"1 3 5-7\"), \"/text\" to search, \"a\" for all shown, "+
+			"\"q\" to cancel, or empty line to finish: ", nsel)
+
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err == io.EOF {
+			fmt.Fprintln(w)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			return pickSelected(results, selected), nil
+		case line == "q":
+			return nil, nil
+		case line == "a":
+			for _, i := range shown {
+				selected[i] = true
+			}
+		case strings.HasPrefix(line, "/"):
+			filter = strings.TrimSpace(line[1:])
+		default:
+			idxs, err := parseSelection(line, len(results))
+			if err != nil {
+				fmt.Fprintln(w, err)
+				continue
+			}
+			for _, i := range idxs {
+				selected[i] = !selected[i]
+			}
+		}
+		if err == io.EOF {
+			return pickSelected(results, selected), nil
+		}
+	}
+}
+
+// pickSelected returns the results whose entries in selected are true.
+func pickSelected(results []discover.Result, selected []bool) []discover.Result {
+	var picked []discover.Result
+	for i, s := range selected {
+		if s {
+			picked = append(picked, results[i])
+		}
+	}
+	return picked
+}
+
+// parseSelection parses a list of 1-based numbers and ranges like "1 3,5-7"
+// and returns the corresponding 0-based indexes. Numbers above n are rejected.
+func parseSelection(s string, n int) ([]int, error) {
+	var idxs []int
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		lo, hi, isRange := strings.Cut(f, "-")
+		if !isRange {
+			hi = lo
+		}
+		start, err1 := strconv.Atoi(lo)
+		end, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || start < 1 || end < start || end > n {
+			return nil, fmt.Errorf("%q isn't a number or range between 1 and %d", f, n)
+		}
+		for i := start; i <= end; i++ {
+			idxs = append(idxs, i-1)
+		}
+	}
+	return idxs, nil
+}
+
+// resultSearchText returns the text of r that is matched by selectResults's
+// search.
+func resultSearchText(r *discover.Result) string {
+	return r.Artist + " " + r.Album + " " + r.Genre + " " + r.Subgenre
+}
+
+// fuzzyMatch returns true if the characters of pattern appear in order (but
+// not necessarily consecutively) in s, ignoring case and spaces in pattern.
+// An empty pattern matches everything.
+func fuzzyMatch(pattern, s string) bool {
+	s = strings.ToLower(s)
+	for _, pr := range strings.ToLower(pattern) {
+		if unicode.IsSpace(pr) {
+			continue
+		}
+		i := strings.IndexRune(s, pr)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(string(pr)):]
+	}
+	return true
+}
@@ -0,0 +1,31 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// resolveLocation returns the location described by s, which may be either a
+// GeoNames ID or a place name to search for (e.g. "berlin").
+func resolveLocation(ctx context.Context, client *discover.Client, s string) (discover.Location, error) {
+	if id, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if id <= 0 {
+			return discover.Location{}, fmt.Errorf("invalid ID %d", id)
+		}
+		return discover.Location{ID: id}, nil
+	}
+	locs, err := client.SearchLocations(ctx, s)
+	if err != nil {
+		return discover.Location{}, err
+	}
+	if len(locs) == 0 {
+		return discover.Location{}, fmt.Errorf("no locations matching %q", s)
+	}
+	return locs[0], nil
+}
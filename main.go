@@ -4,429 +4,1166 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
-	"flag"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime/debug"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
 )
 
 func main() {
-	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %v [flag]...\n"+
-			"Queries the Bandcamp Discover API and prints album URLs.\n\n", os.Args[0])
-		flag.PrintDefaults()
+	os.Exit(run())
+}
+
+// runDiscover runs the "discover" command with the supplied command-line
+// arguments and returns the process's exit status.
+func runDiscover(args []string) int {
+	fset := newFlagSet("discover", "[flag]...", "Queries the Bandcamp Discover API and prints album URLs.")
+	var genres genreListFlag
+	fset.Var(&genres, "genre", `Genre or genre/subgenre to query (default "all"); may be repeated or `+
+		`comma-separated (e.g. "ambient,jazz/fusion" or "electronic/techno,house")`)
+	allSubgenres := fset.Bool("all-subgenres", false, "Query each known subgenre of -genre genres without "+
+		"subgenres (results' subgenres are included in -output=json and csv)")
+	fset.Var(aliasFlag{}, "genre-alias", `Additional genre alias as "alias=genre" (may be repeated)`)
+	selfTestFlag := fset.Bool("self-test", false, "Check that the API returns albums and exit")
+	listGenres := fset.Bool("list-genres", false, "Print all genres to stdout (as JSON, CSV, or TSV with -output)")
+	updateGenres := fset.Bool("update-genres", false, "Fetch Bandcamp's current genres, save them to -cache-dir, "+
+		"and exit (saved genres are merged with embedded ones in later runs)")
+	failOnStaleGenres := fset.Bool("fail-on-stale-genres", false,
+		"Compare embedded genres against Bandcamp's and exit with 1 if they differ")
+	ranking := fset.String("ranking", "top", "Ranking to display (top, new, rec)")
+	format := fset.String("format", "all", "Format to display (all, digital, vinyl, cd, cassette)")
+	countByFormat := fset.Bool("count-by-format", false, "Print the number of results in each format instead of URLs")
+	concurrency := fset.Int("concurrency", 1, "Maximum number of simultaneous API requests")
+	expand := fset.Bool("expand-artists", false, "Also list all albums by the artists of the results")
+	details := fset.Bool("details", false, "Fetch each result's page to add its release date, label, tags, "+
+		"price, and track count to -output=json, jsonl, csv, and tsv")
+	maxPriceFlag := fset.String("max-price", "", "Only print results with minimum digital prices at most this, "+
+		`e.g. "10" or "10 EUR" (implies -details; a currency also omits results priced in others)`)
+	nyp := fset.Bool("nyp", false, "Only print name-your-price results (implies -details)")
+	free := fset.Bool("free", false, "Only print results that can be downloaded for free (implies -details)")
+	artDir := fset.String("download-art", "", "Directory to save results' cover art to")
+	withTracks := fset.Bool("tracks", false, "With -details, also add track titles and durations")
+	stable := fset.Bool("stable", false, "Sort results by URL so output is deterministic")
+	validate := fset.Bool("validate", false, "Send HEAD requests to check result URLs (summarized by -verbose)")
+	liveOnly := fset.Bool("live-only", false, "Only print results whose URLs return 200 (implies -validate)")
+	checksum := fset.Bool("checksum", false, "Print a SHA-256 hash of the sorted URLs instead of the URLs")
+	verbose := fset.Bool("verbose", false, "Print additional information to stderr")
+	summary := fset.Bool("summary", false, "Print a one-line summary of the run to stderr")
+	explain := fset.Bool("explain", false, "Print to stderr why each item was kept or rejected")
+	quiet := fset.Bool("quiet", false, "Suppress warnings")
+	minResults := fset.Int("min-results", 0, "Warn about genres returning fewer than this many results")
+	output := fset.String("output", "url", "Output format ("+strings.Join(sortedKeys(outputFormats), ", ")+")")
+	showNames := fset.Bool("show-names", false, `Print "Artist – Album <url>" lines (same as -output=long)`)
+	outputEnc := fset.String("output-encoding", "utf-8", "Text encoding for output ("+
+		strings.Join(outputEncodings, ", ")+"); JSON output is always UTF-8")
+	columns := fset.String("columns", "", "Comma-separated columns for -output=tsv and csv (default depends on -output)")
+	noHeader := fset.Bool("no-header", false, "Omit header row for -output=tsv and csv")
+	tmplText := fset.String("template", "", "Go text/template executed for each result instead of using -output "+
+		`(e.g. "{{.Artist}}: {{.URL}}")`)
+	stream := fset.Bool("stream", false, "Print results as they're received rather than after all pages are fetched "+
+		"(only with -template or -output="+strings.Join(streamFormats, ", ")+")")
+	interactive := fset.Bool("interactive", false, "Choose which results to print (or -open) from a list on the terminal")
+	openCount := fset.Int("open", 0, "Open the first N results in the default web browser")
+	showNewOnly := fset.String("show-new-only", "", "Only print results absent from this file written by -output=json")
+	newOnly := fset.Bool("new-only", false, "Only print results that weren't printed by previous runs (see -seen-db)")
+	watch := fset.Duration("watch", 0, "Keep running and print new results at this interval (implies -new-only)")
+	webhook := fset.String("webhook", "", "URL to POST new results to as JSON objects (notifications require -new-only or -watch)")
+	webhookBatch := fset.Bool("webhook-batch", false, "POST a JSON array of all new results to -webhook at once")
+	discordWebhook := fset.String("discord-webhook", "", "Discord webhook URL to post new results to")
+	slackWebhook := fset.String("slack-webhook", "", "Slack incoming webhook URL to post new results to")
+	emailTo := fset.String("email-to", "", "Comma-separated email addresses to send digests of new results to")
+	emailFrom := fset.String("email-from", "", "Sender address for -email-to")
+	emailHTML := fset.Bool("email-html", false, "Send HTML instead of plain-text digests")
+	smtpServer := fset.String("smtp-server", "", `SMTP server used to send email as "host:port" (STARTTLS is used if supported)`)
+	smtpUser := fset.String("smtp-user", "", "Username for authenticating to -smtp-server")
+	smtpPass := fset.String("smtp-password", "", "Password for -smtp-user (consider using the environment variable)")
+	telegramToken := fset.String("telegram-token", "", "Telegram bot token for sending new results to -telegram-chat")
+	telegramChat := fset.String("telegram-chat", "", `Telegram chat ID or "@channel" to send new results to`)
+	seenDBPath := fset.String("seen-db", "", "File recording all printed results "+
+		"(used with -new-only; defaults to "+seenFileName+" in the cache directory)")
+	showRemoved := fset.Bool("removed", false, "With -show-new-only, print results from the file that are now absent")
+	dedupBy := fset.String("dedup-by", "url", "Skip results with duplicate keys (url, artist, album)")
+	dedupPerQuery := fset.Bool("dedup-per-query", false, "In multi-query runs, only skip duplicates within each "+
+		"query's results instead of listing each result under just the first query that returned it")
+	locationFlag := fset.String("location", "", `Place name or GeoNames ID to find artists from (e.g. "berlin"); `+
+		"not used with -batch")
+	weekFlag := fset.String("week", "0", `Week to query, either relative to the current one (e.g. "-1" for last week) `+
+		`or as a date within it (e.g. "2023-01-15")`)
+	itemType := fset.String("type", "album", "Type of results to print (album, track, all)")
+	onlyItemType := fset.String("only-item-type", "", `Exit with 2 if items of other types are returned (e.g. "a")`)
+	limit := fset.Int("limit", 0, "Maximum number of results to print (0 for no limit)")
+	pages := fset.Int("pages", 1, "Number of pages to fetch")
+	startPage := fset.Int("start-page", 0, "First page to fetch (starting at 0)")
+	allPages := fset.Bool("all-pages", false, "Fetch pages until no more results are returned")
+	sampleGenres := fset.Int("sample-genres", 0, "Query this many randomly-chosen genre/subgenre pairs "+
+		"instead of -genre (see -seed; use e.g. -output=csv to label results)")
+	sample := fset.Int("sample", 0, fmt.Sprintf("Query this many randomly-chosen pages (up to %d)", maxSamplePage+1))
+	seed := fset.Int64("seed", 0, "Seed for random choices (0 to use the current time)")
+	failFast := fset.Bool("fail-fast", false, "Abort multi-query runs after the first failure")
+	keepGoing := fset.Bool("keep-going", true, fmt.Sprintf(
+		"Continue multi-query runs after failures and exit with %d (overridden by -fail-fast)", partialFailureStatus))
+	batch := fset.String("batch", "", "JSON file containing an array of queries to run "+
+		`(e.g. [{"genre":"jazz","subgenre":"fusion","ranking":"new","format":"vinyl","limit":10}])`)
+	dryRun := fset.Bool("dry-run", false, "Print API URLs instead of sending requests")
+	cacheClean := fset.Bool("cache-clean", false, "Delete cached API responses older than -cache-ttl and exit")
+	cf := addClientFlags(fset)
+	if !parseFlags(fset, args) {
+		return 2
+	}
+	if fset.NArg() > 0 {
+		fset.Usage()
+		return 2
+	}
+	if err := loadSavedGenres(*cf.cacheDir); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed reading saved genres:", err)
+		return 1
 	}
-	genre := flag.String("genre", "all", "Genre or genre/subgenre to query")
-	listGenres := flag.Bool("list-genres", false, "Print all genres to stdout")
-	ranking := flag.String("ranking", "top", "Ranking to display (top, new, rec)")
-	format := flag.String("format", "all", "Format to display (all, digital, vinyl, cd, cassette)")
-	flag.Parse()
 
 	if *listGenres {
-		printGenres(os.Stdout)
-		os.Exit(0)
+		listFormat := *output
+		if listFormat == "url" {
+			listFormat = "text" // default -output value
+		}
+		if !contains(genreListFormats, listFormat) {
+			fmt.Fprintln(os.Stderr, "-list-genres supports -output values:", strings.Join(genreListFormats, ", "))
+			return 2
+		}
+		if err := printGenres(os.Stdout, listFormat); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed listing genres:", err)
+			return 1
+		}
+		return 0
+	}
+
+	if *concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "-concurrency must be positive")
+		return 2
+	}
+	dedupKey, ok := dedupKeys[*dedupBy]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "-dedup-by must be one of:", strings.Join(sortedKeys(dedupKeys), ", "))
+		return 2
+	}
+	if !contains(discover.Rankings, *ranking) {
+		fmt.Fprintln(os.Stderr, "-ranking must be one of:", strings.Join(discover.Rankings, ", "))
+		return 2
+	}
+	if *format != "all" && !contains(discover.Formats, *format) {
+		fmt.Fprintln(os.Stderr, "-format must be one of: all,", strings.Join(discover.Formats, ", "))
+		return 2
+	}
+	if *itemType != "all" && !contains(discover.Types, *itemType) {
+		fmt.Fprintln(os.Stderr, "-type must be one of: all,", strings.Join(discover.Types, ", "))
+		return 2
+	}
+	week, err := parseWeek(*weekFlag, time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Bad -week value:", err)
+		return 2
+	}
+	client, err := cf.newClient()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	client.Concurrency = *concurrency // also fetch multiple pages of a query in parallel
+	// Cancel in-progress requests on SIGINT or SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *cacheClean {
+		if client.Cache == nil {
+			fmt.Fprintln(os.Stderr, "-cache-clean requires -cache-dir and a positive -cache-ttl")
+			return 2
+		}
+		return cleanCache(client.Cache)
+	}
+
+	var exp *explainer
+	if *explain {
+		exp = &explainer{w: os.Stderr}
+		client.SkipFunc = exp.skip
+	}
+	if *verbose {
+		defer func() {
+			if n := client.InvalidItems(); n > 0 {
+				fmt.Fprintf(os.Stderr, "Skipped %d invalid item(s)\n", n)
+			}
+			if client.RetryBudget > 0 {
+				fmt.Fprintf(os.Stderr, "Waited %v of %v retry budget\n", client.RetryWait(), client.RetryBudget)
+			} else {
+				fmt.Fprintf(os.Stderr, "Waited %v to retry requests\n", client.RetryWait())
+			}
+		}()
+	}
+
+	*failFast = *failFast || !*keepGoing
+
+	if *selfTestFlag {
+		n, err := selfTest(ctx, client)
+		if err != nil {
+			fmt.Println("FAIL:", err)
+			return 1
+		}
+		fmt.Printf("OK: got %d album(s)\n", n)
+		return 0
+	}
+
+	if *updateGenres {
+		if *cf.cacheDir == "" {
+			fmt.Fprintln(os.Stderr, "-update-genres requires -cache-dir")
+			return 2
+		}
+		return updateGenresFile(ctx, client, *cf.cacheDir, *quiet)
+	}
+
+	if *failOnStaleGenres {
+		return checkStaleGenres(ctx, client)
+	}
+
+	if *batch != "" {
+		specs, err := readBatchFile(*batch)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed reading batch file:", err)
+			return 2
+		}
+		results := runBatch(ctx, client, specs, *concurrency, *failFast)
+		if interrupted(ctx) {
+			return interruptedStatus
+		}
+		errs := make([]error, len(results))
+		labels := make([]string, len(results))
+		for i, br := range results {
+			errs[i], labels[i] = br.err, fmt.Sprintf("query %d", i)
+		}
+		status := checkFetchErrors(errs, labels, *failFast)
+		if status != 0 && *failFast {
+			return status
+		}
+		if !*quiet {
+			for _, br := range results {
+				if br.err == nil {
+					label := genreLabel(br.Query.Genre, br.Query.Subgenre)
+					warnFewResults(label, len(br.Results), *minResults)
+				}
+			}
+		}
+		dedupBatch(results, dedupKey, *dedupPerQuery, *stable)
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed writing output:", err)
+			return 1
+		}
+		return status
+	}
+
+	var location discover.Location
+	if *locationFlag != "" {
+		if location, err = resolveLocation(ctx, client, *locationFlag); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed resolving location:", err)
+			return 1
+		}
+		if !*quiet && location.FullName != "" {
+			fmt.Fprintf(os.Stderr, "Using location %q (%d) for %q\n", location.FullName, location.ID, *locationFlag)
+		}
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	if *sampleGenres > 0 {
+		if len(genres) > 0 {
+			fmt.Fprintln(os.Stderr, "-sample-genres can't be used with -genre")
+			return 2
+		}
+		// Query the sampled pairs as if they were passed via -genre so that
+		// they're deduplicated, filtered, and printed like other results.
+		genres = genreListFlag(sampleGenrePairs(rand.New(rand.NewSource(*seed)), *sampleGenres))
+	}
+
+	if len(genres) == 0 {
+		genres = genreListFlag{"all"}
+	}
+	specs, err := parseGenreList(genres)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Bad -genre value:", err)
+		return 2
+	}
+	for i := range specs {
+		if canon, ok := resolveGenreAlias(specs[i].genre); ok {
+			if !*quiet {
+				fmt.Fprintf(os.Stderr, "Using genre %q for %q\n", canon, specs[i].genre)
+			}
+			specs[i].genre = canon
+		}
+	}
+	if *allSubgenres {
+		if specs, err = expandSubgenres(specs); err != nil {
+			fmt.Fprintln(os.Stderr, "Bad -genre value for -all-subgenres:", err)
+			return 2
+		}
+	}
+	// The API ignores invalid parameters, so check genres before querying.
+	if len(specs) == 1 {
+		if err := discover.CheckGenre(specs[0].genre, specs[0].subgenre); err != nil {
+			fmt.Fprintf(os.Stderr, "Bad -genre value: %v; see -list-genres and -update-genres\n", err)
+			return 2
+		}
+	} else {
+		var valid []genreSpec
+		for _, spec := range specs {
+			if err := discover.CheckGenre(spec.genre, spec.subgenre); err != nil {
+				if !*quiet {
+					fmt.Fprintf(os.Stderr, "Warning: skipping %v: %v\n", spec, err)
+				}
+				continue
+			}
+			valid = append(valid, spec)
+		}
+		if len(valid) == 0 {
+			fmt.Fprintln(os.Stderr, "No valid genres in -genre values")
+			return 2
+		}
+		specs = valid
+	}
+	genreDesc := genreListLabel(specs) // used in warnings and output
+
+	if *showNames {
+		if *output != "url" && *output != "long" {
+			fmt.Fprintln(os.Stderr, "-show-names can't be used with -output="+*output)
+			return 2
+		}
+		*output = "long"
+	}
+	if _, ok := outputFormats[*output]; !ok {
+		fmt.Fprintln(os.Stderr, "-output must be one of:", strings.Join(sortedKeys(outputFormats), ", "))
+		return 2
+	}
+	if !contains(outputEncodings, *outputEnc) {
+		fmt.Fprintln(os.Stderr, "-output-encoding must be one of:", strings.Join(outputEncodings, ", "))
+		return 2
+	}
+	var maxPrice price
+	if *maxPriceFlag != "" {
+		if maxPrice, err = parsePrice(*maxPriceFlag); err != nil {
+			fmt.Fprintln(os.Stderr, "Bad -max-price value:", err)
+			return 2
+		}
+		*details = true
+	}
+	*details = *details || *nyp || *free
+	if *withTracks && !*details {
+		fmt.Fprintln(os.Stderr, "-tracks requires -details")
+		return 2
+	}
+	if *columns != "" && defaultColumns[*output] == "" {
+		fmt.Fprintln(os.Stderr, "-columns requires -output=tsv or -output=csv")
+		return 2
+	}
+	var cols []string
+	if *columns == "" {
+		if *columns = defaultColumns[*output]; *details && *columns != "" {
+			*columns += "," + detailColumns
+			if *withTracks {
+				*columns += "," + trackColumns
+			}
+		}
+	}
+	if *columns != "" {
+		if cols, err = parseColumns(*columns); err != nil {
+			fmt.Fprintln(os.Stderr, "Bad -columns value:", err)
+			return 2
+		}
+	}
+	var tmpl *template.Template
+	if *tmplText != "" {
+		if tmpl, err = template.New("result").Parse(*tmplText); err != nil {
+			fmt.Fprintln(os.Stderr, "Bad -template value:", err)
+			return 2
+		}
+	}
+	if *showRemoved && *showNewOnly == "" {
+		fmt.Fprintln(os.Stderr, "-removed requires -show-new-only")
+		return 2
+	}
+	if *seenDBPath == "" && *newOnly {
+		*seenDBPath = defaultSeenDB()
+	}
+	var seen *seenDB
+	if *seenDBPath != "" {
+		if seen, err = openSeenDB(*seenDBPath); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed reading seen database:", err)
+			return 1
+		}
+	} else if *newOnly {
+		fmt.Fprintln(os.Stderr, "-new-only requires -seen-db")
+		return 2
+	}
+	if *openCount < 0 {
+		fmt.Fprintln(os.Stderr, "-open must be non-negative")
+		return 2
+	}
+	if *watch < 0 {
+		fmt.Fprintln(os.Stderr, "-watch must be non-negative")
+		return 2
+	} else if *watch > 0 {
+		if *dryRun || *countByFormat || *interactive {
+			fmt.Fprintln(os.Stderr, "-watch can't be used with -dry-run, -count-by-format, or -interactive")
+			return 2
+		}
+		*newOnly = true
+		if seen == nil {
+			seen = newMemorySeenDB() // only skip results printed by this process
+		}
+		capCacheTTL(client, *watch)
+	}
+	var notifiers []notifier
+	if *webhook != "" {
+		if err := checkWebhookURL(*webhook); err != nil {
+			fmt.Fprintln(os.Stderr, "Bad -webhook value:", err)
+			return 2
+		}
+		notifiers = append(notifiers, &webhookNotifier{client.HTTPClient, *webhook, *webhookBatch})
+	}
+	if *discordWebhook != "" {
+		if err := checkWebhookURL(*discordWebhook); err != nil {
+			fmt.Fprintln(os.Stderr, "Bad -discord-webhook value:", err)
+			return 2
+		}
+		notifiers = append(notifiers, &discordNotifier{client.HTTPClient, *discordWebhook})
+	}
+	if *slackWebhook != "" {
+		if err := checkWebhookURL(*slackWebhook); err != nil {
+			fmt.Fprintln(os.Stderr, "Bad -slack-webhook value:", err)
+			return 2
+		}
+		notifiers = append(notifiers, &slackNotifier{client.HTTPClient, *slackWebhook})
+	}
+	if *emailTo != "" {
+		n, err := newEmailNotifier(*smtpServer, *smtpUser, *smtpPass, *emailFrom, *emailTo, *emailHTML)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Bad email settings:", err)
+			return 2
+		}
+		notifiers = append(notifiers, n)
+	}
+	if *telegramToken != "" || *telegramChat != "" {
+		if *telegramToken == "" || *telegramChat == "" {
+			fmt.Fprintln(os.Stderr, "-telegram-token and -telegram-chat must be used together")
+			return 2
+		}
+		notifiers = append(notifiers, &telegramNotifier{client.HTTPClient, defaultTelegramAPI,
+			*telegramToken, *telegramChat})
+	}
+	if len(notifiers) > 0 && !*newOnly {
+		fmt.Fprintln(os.Stderr, "Notifications require -new-only or -watch")
+		return 2
+	}
+	if *stream {
+		if tmpl == nil && !contains(streamFormats, *output) {
+			fmt.Fprintln(os.Stderr, "-stream requires -template or -output of", strings.Join(streamFormats, ", "))
+			return 2
+		}
+		if *stable || *expand || *validate || *liveOnly || *details || *showNewOnly != "" || *checksum ||
+			*interactive || *artDir != "" || *openCount > 0 || *watch > 0 || len(notifiers) > 0 {
+			fmt.Fprintln(os.Stderr, "-stream can't be used with flags that need all results "+
+				"(e.g. -stable, -details, -watch, or notifications)")
+			return 2
+		}
+	}
+	var baseline []discover.Result
+	if *showNewOnly != "" {
+		if baseline, err = readResultsFile(*showNewOnly); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed reading baseline:", err)
+			return 2
+		}
+	}
+	query := discover.Query{Genre: specs[0].genre, Subgenre: specs[0].subgenre, Ranking: *ranking, Format: *format,
+		Type: *itemType, Location: location.ID, Week: week, StrictItemType: *onlyItemType}
+	if *pages < 1 || *startPage < 0 {
+		fmt.Fprintln(os.Stderr, "-pages must be positive and -start-page must be non-negative")
+		return 2
+	}
+	query.Page, query.Pages = *startPage, *pages
+	if *limit < 0 {
+		fmt.Fprintln(os.Stderr, "-limit must be non-negative")
+		return 2
+	}
+	if !*stable && !*newOnly && !*details {
+		// With -stable, all results need to be fetched so they can be sorted
+		// before the limit is applied. Similarly, results need to be filtered
+		// by -new-only and by -details-based flags before they're counted.
+		query.Limit = *limit
+	}
+	if *allPages {
+		query.Pages = discover.AllPages
+	}
+
+	if *countByFormat {
+		if len(specs) > 1 {
+			fmt.Fprintln(os.Stderr, "-count-by-format requires a single genre")
+			return 2
+		}
+		counts, err := getFormatCounts(ctx, client, query, *concurrency)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed getting counts:", err)
+			return fetchErrorStatus(err)
+		}
+		printFormatCounts(os.Stdout, counts)
+		return 0
+	}
+
+	// fetchAndPrint fetches and prints results and returns the exit status.
+	// It is called repeatedly by -watch.
+	fetchAndPrint := func() int {
+		start := time.Now()
+
+		// Build a list of queries to run, with one per genre and sampled page.
+		var sampled []int // sampled pages for -sample
+		if *sample > 0 {
+			sampled = samplePages(rand.New(rand.NewSource(*seed)), *sample, maxSamplePage)
+		}
+		var queries []discover.Query
+		var labels []string // used to identify queries in errors
+		for _, spec := range specs {
+			q := query
+			q.Genre, q.Subgenre = spec.genre, spec.subgenre
+			if sampled == nil {
+				queries = append(queries, q)
+				labels = append(labels, spec.String())
+				continue
+			}
+			for _, p := range sampled {
+				q.Page, q.Pages = p, 1
+				queries = append(queries, q)
+				labels = append(labels, fmt.Sprintf("%v page %d", spec, p))
+			}
+		}
+
+		if *dryRun {
+			for _, q := range queries {
+				n := q.Pages
+				if n == discover.AllPages {
+					n = 1 // the number of pages isn't known in advance
+				}
+				for p := q.Page; p < q.Page+n; p++ {
+					u, err := client.QueryURL(q, p)
+					if err != nil {
+						fmt.Fprintln(os.Stderr, "Failed getting URL:", err)
+						return 2
+					}
+					fmt.Println(u)
+				}
+			}
+			return 0
+		}
+
+		if *stream {
+			opts := &outputOptions{columns: cols, noHeader: *noHeader}
+			if !*quiet {
+				opts.warnings = os.Stderr
+			}
+			return streamQueries(ctx, client, queries, labels, *failFast, streamWriter(streamConfig{
+				dedup:   newDeduper(dedupKey),
+				seen:    seen,
+				newOnly: *newOnly,
+				limit:   *limit,
+				exp:     exp,
+				tmpl:    tmpl,
+				format:  *output,
+				opts:    opts,
+				enc:     *outputEnc,
+			}))
+		}
+
+		var results []discover.Result
+		var status int // nonzero if some queries failed with -keep-going
+		if len(queries) > 1 {
+			fetched, errs := fetchAll(ctx, client, queries, *concurrency, *failFast)
+			if interrupted(ctx) {
+				return interruptedStatus
+			}
+			if status = checkFetchErrors(errs, labels, *failFast); status != 0 && *failFast {
+				return status
+			}
+			for _, res := range fetched {
+				results = append(results, res...)
+			}
+		} else {
+			if results, err = client.Fetch(ctx, queries[0]); err != nil {
+				if interrupted(ctx) {
+					return interruptedStatus
+				}
+				fmt.Fprintln(os.Stderr, "Failed getting URLs:", err)
+				return fetchErrorStatus(err)
+			}
+		}
+		if !*quiet && status == 0 {
+			warnFewResults(genreDesc, len(results), *minResults)
+		}
+		numFetched := len(results)
+		dd := newDeduper(dedupKey)
+		results = filterResults(results, dd.keep, exp, "already seen")
+
+		if *expand {
+			more, errs := expandArtists(ctx, client, results, *concurrency)
+			if !*quiet {
+				for _, err := range errs {
+					fmt.Fprintln(os.Stderr, "Warning: failed expanding artist:", err)
+				}
+			}
+			results = append(results, filterResults(more, dd.keep, exp, "already seen")...)
+		}
+
+		if *validate || *liveOnly {
+			statuses := validateResults(ctx, client, results, *concurrency)
+			if *verbose {
+				printValidationSummary(os.Stderr, statuses)
+			}
+			if *liveOnly {
+				results = liveResults(results, statuses, exp)
+			}
+		}
+
+		if *newOnly {
+			results = seen.filterNew(results, exp)
+		}
+
+		if *details {
+			df := detailFilter{nyp: *nyp, free: *free, withTracks: *withTracks,
+				concurrency: *concurrency, quiet: *quiet}
+			if *maxPriceFlag != "" {
+				df.maxPrice = &maxPrice
+			}
+			results = filterDetails(ctx, client, results, df, exp)
+		}
+
+		if *stable {
+			sortResults(results)
+		}
+		if *limit > 0 && len(results) > *limit {
+			results = results[:*limit]
+		}
+
+		if *checksum {
+			urls := make([]string, len(results))
+			for i, r := range results {
+				urls[i] = r.URL
+			}
+			sum, n := hashURLs(urls)
+			fmt.Println(sum)
+			if *verbose {
+				fmt.Fprintf(os.Stderr, "Hashed %d unique URL(s)\n", n)
+			}
+			return status
+		}
+
+		title := fmt.Sprintf("Bandcamp Discover: %v (%v, %v)", genreDesc, query.Ranking, query.Format)
+
+		if *showNewOnly != "" {
+			added, removed := diffResults(baseline, results)
+			if *showRemoved {
+				results = removed
+			} else {
+				addedURLs := make(map[string]struct{}, len(added))
+				for _, r := range added {
+					addedURLs[r.URL] = struct{}{}
+				}
+				results = filterResults(results, func(r *discover.Result) bool {
+					_, ok := addedURLs[r.URL]
+					return ok
+				}, exp, "present in baseline")
+			}
+		}
+		exp.keep(results)
+
+		// Don't print partial results if expanding or validating was interrupted.
+		if interrupted(ctx) {
+			return interruptedStatus
+		}
+
+		if *interactive && len(results) > 0 {
+			// Use the terminal directly so stdout can still be redirected.
+			tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Failed opening terminal:", err)
+				return 1
+			}
+			results, err = selectResults(tty, tty, results)
+			tty.Close()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Failed reading selection:", err)
+				return 1
+			}
+		}
+
+		if *artDir != "" {
+			n, errs := downloadArt(ctx, client, results, *artDir, *concurrency)
+			if !*quiet {
+				for _, err := range errs {
+					fmt.Fprintln(os.Stderr, "Warning: failed downloading art:", err)
+				}
+			}
+			if *verbose {
+				fmt.Fprintf(os.Stderr, "Saved %d cover image(s) to %v\n", n, *artDir)
+			}
+			if interrupted(ctx) {
+				return interruptedStatus
+			}
+		}
+
+		opts := outputOptions{title: title, columns: cols, noHeader: *noHeader}
+		if !*quiet {
+			opts.warnings = os.Stderr
+		}
+		if seen != nil {
+			opts.firstSeen = seen.firstSeen
+		}
+		if contains(trackFormats, *output) {
+			var errs []error
+			opts.tracks, errs = resolveTracks(ctx, client, results, *concurrency)
+			if !*quiet {
+				for _, err := range errs {
+					fmt.Fprintln(os.Stderr, "Warning: failed getting tracks:", err)
+				}
+			}
+		}
+		var b bytes.Buffer
+		if tmpl != nil {
+			err = writeTemplate(&b, tmpl, results)
+		} else {
+			err = writeResults(&b, *output, results, &opts)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed writing output:", err)
+			return 1
+		}
+		out := b.Bytes()
+		if tmpl != nil || (*output != "json" && *output != "jsonl") { // JSON must be UTF-8 (RFC 8259)
+			if out, err = encodeOutput(out, *outputEnc); err != nil {
+				fmt.Fprintln(os.Stderr, "Failed encoding output:", err)
+				return 1
+			}
+		}
+		if _, err := os.Stdout.Write(out); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed writing output:", err)
+			return 1
+		}
+		for i := 0; i < *openCount && i < len(results); i++ {
+			if err := openURL(results[i].URL); err != nil {
+				fmt.Fprintln(os.Stderr, "Failed opening browser:", err)
+				status = 1
+				break
+			}
+		}
+		// Only record the results that were delivered by all notifiers as seen,
+		// so the others will be retried.
+		delivered, errs := notifyAll(ctx, notifiers, results)
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, "Failed sending notification:", err)
+		}
+		if seen != nil {
+			if _, err := seen.add(results[:delivered], time.Now()); err != nil {
+				fmt.Fprintln(os.Stderr, "Failed updating seen database:", err)
+				return 1
+			}
+		}
+		if len(errs) > 0 {
+			return 1
+		}
+		if *summary && !*quiet {
+			fmt.Fprintln(os.Stderr, formatSummary(genreDesc, query, numFetched, len(results), time.Since(start)))
+		}
+		return status
 	}
 
-	var subgenre string
-	if parts := strings.Split(*genre, "/"); len(parts) == 2 {
-		*genre, subgenre = parts[0], parts[1]
-	} else if len(parts) != 1 {
-		fmt.Fprintln(os.Stderr, "-genre value should contain genre or genre/subgenre")
-		os.Exit(2)
+	if *watch == 0 {
+		return fetchAndPrint()
+	}
+	for {
+		if st := fetchAndPrint(); st == interruptedStatus {
+			return st
+		}
+		if *verbose {
+			fmt.Fprintf(os.Stderr, "Checking again at %v\n", time.Now().Add(*watch).Format("15:04:05"))
+		}
+		select {
+		case <-ctx.Done():
+			return 0 // clean shutdown, e.g. via SIGTERM from systemd
+		case <-time.After(*watch):
+		}
 	}
-	// TODO: Print a warning if the genre or subgenre are unknown?
-	// The API looks like it just ignores invalid parameters.
+}
+
+// maxSamplePage is the highest page number that -sample will request.
+const maxSamplePage = 49
+
+// samplePages uses r to choose n distinct page numbers in [0, max].
+// The returned pages are sorted.
+func samplePages(r *rand.Rand, n, max int) []int {
+	pages := r.Perm(max + 1)
+	if n < len(pages) {
+		pages = pages[:n]
+	}
+	sort.Ints(pages)
+	return pages
+}
+
+// fetchErrorStatus returns the exit status to use for err, returned while
+// fetching results.
+func fetchErrorStatus(err error) int {
+	var ite *discover.ItemTypeError
+	if errors.As(err, &ite) {
+		return 2
+	}
+	return 1
+}
+
+// defaultSeenDB returns the seen database path used by -new-only if -seen-db
+// is empty.
+func defaultSeenDB() string {
+	if dir := defaultCacheDir(); dir != "" {
+		return filepath.Join(dir, seenFileName)
+	}
+	return ""
+}
 
-	urls, err := getURLs(*genre, subgenre, *ranking, *format)
+// defaultCacheDir returns the default value for the -cache-dir flag.
+func defaultCacheDir() string {
+	dir, err := discover.DefaultCacheDir()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Failed getting URLs:", err)
-		os.Exit(1)
+		return ""
 	}
+	return dir
+}
 
-	for _, u := range urls {
-		fmt.Println(u)
+// newTransport returns a new HTTP transport based on http.DefaultTransport that
+// keeps up to maxConns idle connections per host open for idleTimeout.
+// If proxy is non-nil, it is used for all requests instead of the proxy
+// specified by environment variables.
+func newTransport(maxConns int, idleTimeout time.Duration, proxy *url.URL) *http.Transport {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.MaxIdleConnsPerHost = maxConns
+	tr.IdleConnTimeout = idleTimeout
+	if proxy != nil {
+		tr.Proxy = http.ProxyURL(proxy)
 	}
+	return tr
 }
 
-func getURLs(genre, subgenre, ranking, format string) ([]string, error) {
-	u := "https://bandcamp.com/api/discover/3/get_web?" +
-		"g=" + genre + "&s=" + ranking + "&f=" + format + "&p=0&gn=0&w=0"
-	if subgenre != "" {
-		u += "&t=" + subgenre
+// parseWeek parses s, the value of -week, into a week offset relative to the
+// week containing now. s may be either an offset like "-1" or a date like
+// "2023-01-15".
+func parseWeek(s string, now time.Time) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n > 0 {
+			return 0, fmt.Errorf("%d is in the future", n)
+		}
+		return n, nil
 	}
-	resp, err := http.Get(u)
+	t, err := time.ParseInLocation("2006-01-02", s, now.Location())
+	if err != nil {
+		return 0, fmt.Errorf("%q is neither a number nor a YYYY-MM-DD date", s)
+	}
+	// Compare the starts of the weeks (Sundays) containing t and now.
+	startOfWeek := func(t time.Time) time.Time {
+		y, m, d := t.Date()
+		return time.Date(y, m, d-int(t.Weekday()), 12, 0, 0, 0, time.UTC)
+	}
+	weeks := int(math.Round(startOfWeek(t).Sub(startOfWeek(now)).Hours() / (7 * 24)))
+	if weeks > 0 {
+		return 0, fmt.Errorf("%v is in the future", s)
+	}
+	return weeks, nil
+}
+
+// defaultUserAgent returns the default value of -user-agent, which includes the
+// program's version if it is known.
+func defaultUserAgent() string {
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		return "bandcamp-discover/" + bi.Main.Version + " (+https://codeberg.org/derat/bandcamp-discover)"
+	}
+	return discover.DefaultUserAgent
+}
+
+// proxySchemes lists the proxy URL schemes supported by http.Transport.
+var proxySchemes = []string{"http", "https", "socks5"}
+
+// parseProxyURL parses s as a proxy URL like "socks5://localhost:1080".
+func parseProxyURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
 	if err != nil {
-		return nil, fmt.Errorf("%v: %v", u, err)
-	}
-	defer resp.Body.Close()
-
-	var data struct {
-		Items []struct {
-			PrimaryText   string `json:"primary_text"`   // album
-			SecondaryText string `json:"secondary_text"` // artist
-			URLHints      struct {
-				Subdomain string `json:"subdomain"` // <subdomain>.bandcamp.com
-				Slug      string `json:"slug"`      // /album/<slug>
-				ItemType  string `json:"item_type"` // "a" for album
-			} `json:"url_hints"`
-		} `json:"items"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
 		return nil, err
 	}
+	if !contains(proxySchemes, u.Scheme) {
+		return nil, fmt.Errorf("scheme must be one of: %v", strings.Join(proxySchemes, ", "))
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%q has no host", s)
+	}
+	return u, nil
+}
 
-	var urls []string
-	for _, item := range data.Items {
-		// TODO: Do tracks use "t"?
-		uh := &item.URLHints
-		if uh.ItemType != "a" {
+// sortResults sorts rs by URL.
+func sortResults(rs []discover.Result) {
+	sort.SliceStable(rs, func(i, j int) bool { return rs[i].URL < rs[j].URL })
+}
+
+// hashURLs returns a hex-encoded SHA-256 hash of the sorted and deduplicated
+// list of URLs, along with the number of unique URLs. The hash does not depend
+// on the order of urls.
+func hashURLs(urls []string) (sum string, n int) {
+	sorted := append([]string(nil), urls...)
+	sort.Strings(sorted)
+	h := sha256.New()
+	for i, u := range sorted {
+		if i > 0 && u == sorted[i-1] {
 			continue
 		}
-		// TODO: Probably need to handle custom domains too.
-		urls = append(urls, fmt.Sprintf("https://%v.bandcamp.com/album/%v", uh.Subdomain, uh.Slug))
+		io.WriteString(h, u+"\n")
+		n++
 	}
-	return urls, nil
+	return hex.EncodeToString(h.Sum(nil)), n
 }
 
-// printGenres prints genres (followed by indented subgenres) to w.
-func printGenres(w io.Writer) {
-	genres := make([]string, 0, len(allGenres))
-	for g := range allGenres {
-		genres = append(genres, g)
+// contains returns true if vals contains v.
+func contains(vals []string, v string) bool {
+	for _, s := range vals {
+		if s == v {
+			return true
+		}
 	}
-	sort.Strings(genres)
+	return false
+}
 
-	for _, g := range genres {
-		fmt.Fprintln(w, g)
-		for _, s := range allGenres[g] {
-			fmt.Fprintln(w, "  "+s)
+// getFormatCounts runs q for each of discover.Formats and returns the number
+// of results returned for each one, in the same order as discover.Formats. At most
+// concurrency requests are issued simultaneously.
+func getFormatCounts(ctx context.Context, client *discover.Client, q discover.Query,
+	concurrency int) ([]int, error) {
+	queries := make([]discover.Query, len(discover.Formats))
+	for i, f := range discover.Formats {
+		queries[i] = q
+		queries[i].Format = f
+	}
+	results, errs := fetchAll(ctx, client, queries, concurrency, true)
+	counts := make([]int, len(discover.Formats))
+	for i, res := range results {
+		if errs[i] != nil {
+			return nil, errs[i]
 		}
+		counts[i] = len(res)
+	}
+	return counts, nil
+}
+
+// fetchAll runs queries with at most concurrency requests issued
+// simultaneously. Each query's results and error are returned in the same
+// order as queries. If failFast is true, the remaining queries are cancelled
+// after the first failure.
+func fetchAll(ctx context.Context, client *discover.Client, queries []discover.Query,
+	concurrency int, failFast bool) ([][]discover.Result, []error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([][]discover.Result, len(queries))
+	errs := make([]error, len(queries))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		wg.Add(1)
+		go func(i int, q discover.Query) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			if results[i], errs[i] = client.Fetch(ctx, q); errs[i] != nil && failFast {
+				cancel()
+			}
+		}(i, q)
+	}
+	wg.Wait()
+	return results, errs
+}
+
+// formatSummary returns a one-line summary of a run of q for -summary.
+// genres describes the queried genres.
+func formatSummary(genres string, q discover.Query, fetched, kept int, elapsed time.Duration) string {
+	return fmt.Sprintf("genre=%v ranking=%v format=%v fetched=%d kept=%d elapsed=%v",
+		genres, q.Ranking, q.Format, fetched, kept, elapsed.Round(time.Millisecond))
+}
+
+// genreLabel returns "genre/subgenre", or just "genre" if subgenre is empty.
+func genreLabel(genre, subgenre string) string {
+	if subgenre == "" {
+		return genre
+	}
+	return genre + "/" + subgenre
+}
+
+// warnFewResults prints a warning to stderr if n is less than min.
+// label describes the query, e.g. "electronic/techno".
+func warnFewResults(label string, n, min int) {
+	if n < min {
+		fmt.Fprintf(os.Stderr, "Warning: %v returned only %d result(s)\n", label, n)
 	}
 }
 
-// allGenres maps from genres to subgenres.
-// The map contents were generated by running the following in the
-// JS console after loading https://bandcamp.com/#discover:
-//
-// el = document.getElementById('pagedata');
-// data = JSON.parse(el.getAttribute('data-blob')).discover_2015.options.t;
-// Object.entries(data).map(([g, subs]) => {
-// 	 const s = subs.map(s => `"${s.value}",`).join("\n");
-// 	 return `"${g}": []string{\n${s}\n},`
-// }).join("\n");
-var allGenres = map[string][]string{
-	"acoustic": []string{
-		"all-acoustic",
-		"folk",
-		"singer-songwriter",
-		"rock",
-		"pop",
-		"guitar",
-		"americana",
-		"electro-acoustic",
-		"instrumental",
-		"piano",
-		"bluegrass",
-		"roots",
-	},
-	"alternative": []string{
-		"all-alternative",
-		"indie-rock",
-		"industrial",
-		"shoegaze",
-		"grunge",
-		"goth",
-		"dream-pop",
-		"emo",
-		"math-rock",
-		"britpop",
-		"jangle-pop",
-	},
-	"ambient": []string{
-		"all-ambient",
-		"chill-out",
-		"drone",
-		"dark-ambient",
-		"electronic",
-		"soundscapes",
-		"field-recordings",
-		"atmospheric",
-		"meditation",
-		"noise",
-		"new-age",
-		"idm",
-		"industrial",
-	},
-	"blues": []string{
-		"all-blues",
-		"rhythm-blues",
-		"blues-rock",
-		"country-blues",
-		"boogie-woogie",
-		"delta-blues",
-		"americana",
-		"electric-blues",
-		"gospel",
-		"bluegrass",
-	},
-	"classical": []string{
-		"all-classical",
-		"orchestral",
-		"neo-classical",
-		"chamber-music",
-		"classical-piano",
-		"contemporary-classical",
-		"baroque",
-		"opera",
-		"choral",
-		"modern-classical",
-		"avant-garde",
-	},
-	"comedy": []string{
-		"all-comedy",
-		"improv",
-		"stand-up",
-	},
-	"country": []string{
-		"all-country",
-		"bluegrass",
-		"country-rock",
-		"americana",
-		"country-folk",
-		"alt-country",
-		"country-blues",
-		"western",
-		"singer-songwriter",
-		"outlaw",
-		"honky-tonk",
-		"roots",
-		"hillbilly",
-	},
-	"devotional": []string{
-		"all-devotional",
-		"christian",
-		"gospel",
-		"meditation",
-		"spiritual",
-		"worship",
-		"inspirational",
-	},
-	"electronic": []string{
-		"all-electronic",
-		"house",
-		"electronica",
-		"downtempo",
-		"techno",
-		"electro",
-		"dubstep",
-		"beats",
-		"dance",
-		"idm",
-		"drum-bass",
-		"breaks",
-		"trance",
-		"glitch",
-		"chiptune",
-		"chillwave",
-		"dub",
-		"edm",
-		"instrumental",
-		"witch-house",
-		"garage",
-		"juke",
-		"footwork",
-		"vaporwave",
-		"synthwave",
-	},
-	"experimental": []string{
-		"all-experimental",
-		"noise",
-		"drone",
-		"avant-garde",
-		"experimental-rock",
-		"improvisation",
-		"sound-art",
-		"musique-concrete",
-	},
-	"folk": []string{
-		"all-folk",
-		"singer-songwriter",
-		"folk-rock",
-		"indie-folk",
-		"pop-folk",
-		"traditional",
-		"experimental-folk",
-		"roots",
-	},
-	"funk": []string{
-		"all-funk",
-		"funk-jam",
-		"deep-funk",
-		"funk-rock",
-		"jazz-funk",
-		"boogie",
-		"g-funk",
-		"rare-groove",
-		"electro",
-		"go-go",
-	},
-	"hip-hop-rap": []string{
-		"all-hip-hop-rap",
-		"rap",
-		"underground-hip-hop",
-		"instrumental-hip-hop",
-		"trap",
-		"conscious-hip-hop",
-		"boom-bap",
-		"beat-tape",
-		"hardcore",
-		"grime",
-	},
-	"jazz": []string{
-		"all-jazz",
-		"fusion",
-		"big-band",
-		"nu-jazz",
-		"modern-jazz",
-		"swing",
-		"free-jazz",
-		"soul-jazz",
-		"latin-jazz",
-		"vocal-jazz",
-		"bebop",
-		"spiritual-jazz",
-	},
-	"kids": []string{
-		"all-kids",
-		"family-music",
-		"educational",
-		"music-therapy",
-		"lullaby",
-		"baby",
-	},
-	"latin": []string{
-		"all-latin",
-		"brazilian",
-		"cumbia",
-		"tango",
-		"latin-rock",
-		"flamenco",
-		"salsa",
-		"reggaeton",
-		"merengue",
-		"bolero",
-		"méxico-d.f.",
-		"bachata",
-	},
-	"metal": []string{
-		"all-metal",
-		"hardcore",
-		"black-metal",
-		"death-metal",
-		"thrash-metal",
-		"grindcore",
-		"doom",
-		"post-hardcore",
-		"progressive-metal",
-		"metalcore",
-		"sludge-metal",
-		"heavy-metal",
-		"deathcore",
-		"noise",
-	},
-	"pop": []string{
-		"all-pop",
-		"indie-pop",
-		"synth-pop",
-		"power-pop",
-		"new-wave",
-		"dream-pop",
-		"noise-pop",
-		"experimental-pop",
-		"electro-pop",
-		"adult-contemporary",
-		"jangle-pop",
-		"j-pop",
-	},
-	"punk": []string{
-		"all-punk",
-		"hardcore-punk",
-		"garage",
-		"pop-punk",
-		"punk-rock",
-		"post-punk",
-		"post-hardcore",
-		"thrash",
-		"crust-punk",
-		"folk-punk",
-		"emo",
-		"ska",
-		"no-wave",
-	},
-	"r-b-soul": []string{
-		"all-r-b-soul",
-		"soul",
-		"r-b",
-		"neo-soul",
-		"gospel",
-		"contemporary-r-b",
-		"motown",
-		"urban",
-	},
-	"reggae": []string{
-		"all-reggae",
-		"dub",
-		"ska",
-		"roots",
-		"dancehall",
-		"rocksteady",
-		"ragga",
-		"lovers-rock",
-	},
-	"rock": []string{
-		"all-rock",
-		"indie",
-		"prog-rock",
-		"post-rock",
-		"rock-roll",
-		"psychedelic-rock",
-		"hard-rock",
-		"garage-rock",
-		"surf-rock",
-		"instrumental",
-		"math-rock",
-		"rockabilly",
-	},
-	"soundtrack": []string{
-		"all-soundtrack",
-		"film-music",
-		"video-game-music",
-	},
-	"spoken-word": []string{
-		"all-spoken-word",
-		"poetry",
-		"inspirational",
-		"storytelling",
-		"self-help",
-	},
-	"world": []string{
-		"all-world",
-		"latin",
-		"roots",
-		"african",
-		"tropical",
-		"tribal",
-		"brazilian",
-		"celtic",
-		"world-fusion",
-		"cumbia",
-		"gypsy",
-		"new-age",
-		"balkan",
-		"reggaeton",
-	},
+// partialFailureStatus is the exit status used when some (but not
+// necessarily all) queries in a multi-query run failed with -keep-going.
+const partialFailureStatus = 3
+
+// interruptedStatus is the exit status used when the run is interrupted by a signal.
+const interruptedStatus = 130
+
+// interrupted prints a message to stderr and returns true if ctx (created by
+// signal.NotifyContext) is done.
+func interrupted(ctx context.Context) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	fmt.Fprintln(os.Stderr, "Interrupted")
+	return true
+}
+
+// checkFetchErrors logs the non-nil errors in errs (as returned by fetchAll)
+// to stderr, using the corresponding entries in labels to identify the
+// queries. It returns 0 if there were no errors. If failFast is true, only the
+// error that caused the run to be aborted is logged and its exit status is
+// returned. Otherwise, partialFailureStatus is returned.
+func checkFetchErrors(errs []error, labels []string, failFast bool) int {
+	var first error // first error that wasn't caused by cancellation
+	var firstLabel string
+	failed := false
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		failed = true
+		if !failFast {
+			fmt.Fprintf(os.Stderr, "Failed getting URLs for %v: %v\n", labels[i], err)
+		} else if first == nil && !errors.Is(err, context.Canceled) {
+			first, firstLabel = err, labels[i]
+		}
+	}
+	switch {
+	case !failed:
+		return 0
+	case !failFast:
+		return partialFailureStatus
+	case first == nil: // everything was cancelled
+		fmt.Fprintln(os.Stderr, "Failed getting URLs:", context.Canceled)
+		return 1
+	default:
+		fmt.Fprintf(os.Stderr, "Failed getting URLs for %v: %v\n", firstLabel, first)
+		return fetchErrorStatus(first)
+	}
+}
+
+// printFormatCounts prints a table of counts from getFormatCounts to w.
+func printFormatCounts(w io.Writer, counts []int) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "FORMAT\tCOUNT")
+	for i, f := range discover.Formats {
+		fmt.Fprintf(tw, "%v\t%d\n", f, counts[i])
+	}
+	tw.Flush()
+}
+
+// genreListFormats lists the formats supported by -list-genres and the
+// "genres" command. "text" produces indented text.
+var genreListFormats = []string{"text", "json", "csv", "tsv"}
+
+// printGenres prints genres and subgenres to w in format (from genreListFormats).
+func printGenres(w io.Writer, format string) error {
+	genres := sortedKeys(discover.Genres)
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(discover.Genres) // keys are sorted
+	case "csv", "tsv":
+		rows := [][]string{{"genre", "subgenre"}}
+		for _, g := range genres {
+			for _, s := range discover.Genres[g] {
+				rows = append(rows, []string{g, s})
+			}
+		}
+		if format == "csv" {
+			cw := csv.NewWriter(w)
+			cw.WriteAll(rows)
+			return cw.Error()
+		}
+		for _, row := range rows {
+			if _, err := io.WriteString(w, strings.Join(row, "\t")+"\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		for _, g := range genres {
+			if _, err := fmt.Fprintln(w, g); err != nil {
+				return err
+			}
+			for _, s := range discover.Genres[g] {
+				if _, err := fmt.Fprintln(w, "  "+s); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// flattenGenres returns a sorted list of "genre/subgenre" strings describing
+// all pairs in discover.Genres.
+func flattenGenres() []string {
+	var pairs []string
+	for g, subs := range discover.Genres {
+		for _, s := range subs {
+			pairs = append(pairs, g+"/"+s)
+		}
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// sampleGenrePairs uses r to choose n distinct "genre/subgenre" pairs from
+// discover.Genres. Fewer than n pairs are returned if not enough are
+// available.
+func sampleGenrePairs(r *rand.Rand, n int) []string {
+	pairs := flattenGenres()
+	r.Shuffle(len(pairs), func(i, j int) { pairs[i], pairs[j] = pairs[j], pairs[i] })
+	if n < len(pairs) {
+		pairs = pairs[:n]
+	}
+	return pairs
 }
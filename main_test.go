@@ -0,0 +1,455 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// apiPageFunc returns the slugs of the albums in the get_web response for the
+// query described by vals, along with the total number of items. If err is
+// non-nil, a 500 error is returned instead.
+type apiPageFunc func(vals url.Values) (slugs []string, total int, err error)
+
+// newAPIServer returns a test server that handles get_web requests using fn.
+func newAPIServer(t *testing.T, fn apiPageFunc) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slugs, total, err := fn(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		type urlHints struct {
+			Subdomain string `json:"subdomain"`
+			Slug      string `json:"slug"`
+			ItemType  string `json:"item_type"`
+		}
+		type item struct {
+			PrimaryText   string   `json:"primary_text"`
+			SecondaryText string   `json:"secondary_text"`
+			ID            int64    `json:"id"`
+			URLHints      urlHints `json:"url_hints"`
+		}
+		data := struct {
+			Items      []item `json:"items"`
+			TotalCount int    `json:"total_count"`
+		}{Items: []item{}, TotalCount: total}
+		for i, s := range slugs {
+			data.Items = append(data.Items, item{"Album " + s, "Artist " + s, int64(i + 1), urlHints{s, s, "a"}})
+		}
+		if err := json.NewEncoder(w).Encode(data); err != nil {
+			t.Error("Failed writing page:", err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// testAlbumURL returns the URL of results for slug from newAPIServer.
+func testAlbumURL(slug string) string {
+	return "https://" + slug + ".bandcamp.com/album/" + slug
+}
+
+// runDiscoverTest runs the discover command against srv with the supplied
+// additional arguments and returns its exit status and output.
+func runDiscoverTest(t *testing.T, srv *httptest.Server, args ...string) (status int, stdout, stderr string) {
+	t.Helper()
+	args = append([]string{"-config", "", "-api-base", srv.URL, "-rate", "0",
+		"-cache-dir", t.TempDir(), "-seen-db", ""}, args...)
+	stdout, stderr = captureOutput(t, func() { status = runDiscover(args) })
+	return status, stdout, stderr
+}
+
+func TestHashURLs(t *testing.T) {
+	urls := []string{"https://b.bandcamp.com/album/b", "https://a.bandcamp.com/album/a", "https://c.bandcamp.com/track/c"}
+	sum, n := hashURLs(urls)
+	if n != len(urls) {
+		t.Errorf("hashURLs(%q) counted %d URL(s); want %d", urls, n, len(urls))
+	}
+
+	// The hash covers the sorted URLs, each followed by a newline.
+	want := sha256.Sum256([]byte("https://a.bandcamp.com/album/a\n" +
+		"https://b.bandcamp.com/album/b\n" +
+		"https://c.bandcamp.com/track/c\n"))
+	if sum != hex.EncodeToString(want[:]) {
+		t.Errorf("hashURLs(%q) = %v; want %v", urls, sum, hex.EncodeToString(want[:]))
+	}
+	if again, _ := hashURLs(urls); again != sum {
+		t.Errorf("hashURLs(%q) returned %v and then %v", urls, sum, again)
+	}
+
+	// Order and duplicates shouldn't matter.
+	reordered := []string{urls[2], urls[0], urls[1], urls[0]}
+	if got, n := hashURLs(reordered); got != sum || n != len(urls) {
+		t.Errorf("hashURLs(%q) = %v, %d; want %v, %d", reordered, got, n, sum, len(urls))
+	}
+	if got, _ := hashURLs(urls[:2]); got == sum {
+		t.Errorf("hashURLs(%q) unexpectedly matched hash of %q", urls[:2], urls)
+	}
+
+	// The input shouldn't be modified.
+	if urls[0] != "https://b.bandcamp.com/album/b" {
+		t.Errorf("hashURLs reordered its input to %q", urls)
+	}
+}
+
+func TestFormatSummary(t *testing.T) {
+	for _, tc := range []struct {
+		genres        string
+		q             discover.Query
+		fetched, kept int
+		elapsed       time.Duration
+		want          string
+	}{
+		{
+			"electronic/techno", discover.Query{Ranking: "top", Format: "vinyl"}, 60, 42, 1234567 * time.Microsecond,
+			"genre=electronic/techno ranking=top format=vinyl fetched=60 kept=42 elapsed=1.235s",
+		},
+		{
+			"rock,jazz", discover.Query{Ranking: "new", Format: "all"}, 0, 0, 0,
+			"genre=rock,jazz ranking=new format=all fetched=0 kept=0 elapsed=0s",
+		},
+	} {
+		if got := formatSummary(tc.genres, tc.q, tc.fetched, tc.kept, tc.elapsed); got != tc.want {
+			t.Errorf("formatSummary(%q, %+v, %d, %d, %v) = %q; want %q",
+				tc.genres, tc.q, tc.fetched, tc.kept, tc.elapsed, got, tc.want)
+		}
+	}
+}
+
+func TestFormatCounts(t *testing.T) {
+	want := map[string]int{"digital": 3, "vinyl": 2, "cd": 1, "cassette": 0}
+	srv := newAPIServer(t, func(vals url.Values) ([]string, int, error) {
+		f := vals.Get("f")
+		n, ok := want[f]
+		if !ok {
+			t.Errorf("Got request for unexpected format %q", f)
+		}
+		var slugs []string
+		for i := 0; i < n; i++ {
+			slugs = append(slugs, f+strconv.Itoa(i))
+		}
+		return slugs, n, nil
+	})
+
+	client := &discover.Client{HTTPClient: srv.Client(), BaseURL: srv.URL}
+	q := discover.Query{Genre: "rock", Ranking: "top", Format: "all", Pages: discover.AllPages}
+	counts, err := getFormatCounts(context.Background(), client, q, 2)
+	if err != nil {
+		t.Fatal("getFormatCounts failed:", err)
+	}
+	if exp := []int{3, 2, 1, 0}; !reflect.DeepEqual(counts, exp) {
+		t.Errorf("getFormatCounts returned %v; want %v", counts, exp)
+	}
+
+	var b bytes.Buffer
+	printFormatCounts(&b, counts)
+	const table = "FORMAT    COUNT\n" +
+		"digital   3\n" +
+		"vinyl     2\n" +
+		"cd        1\n" +
+		"cassette  0\n"
+	if got := b.String(); got != table {
+		t.Errorf("printFormatCounts wrote:\n%s\nwant:\n%s", got, table)
+	}
+}
+
+func TestFormatCounts_Error(t *testing.T) {
+	srv := newAPIServer(t, func(vals url.Values) ([]string, int, error) {
+		if vals.Get("f") == "vinyl" {
+			return nil, 0, errors.New("broken")
+		}
+		return []string{"a"}, 1, nil
+	})
+	client := &discover.Client{HTTPClient: srv.Client(), BaseURL: srv.URL}
+	q := discover.Query{Genre: "rock", Ranking: "top", Format: "all"}
+	if counts, err := getFormatCounts(context.Background(), client, q, 1); err == nil {
+		t.Errorf("getFormatCounts with failing format returned %v", counts)
+	}
+}
+
+func TestSamplePages(t *testing.T) {
+	for _, tc := range []struct {
+		seed   int64
+		n, max int
+		want   []int
+	}{
+		{42, 4, maxSamplePage, []int{5, 14, 23, 46}},
+		{7, 5, 9, []int{0, 1, 2, 3, 5}},
+		{7, 20, 4, []int{0, 1, 2, 3, 4}}, // capped at max+1 pages
+	} {
+		got := samplePages(rand.New(rand.NewSource(tc.seed)), tc.n, tc.max)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("samplePages(seed %d, %d, %d) = %v; want %v", tc.seed, tc.n, tc.max, got, tc.want)
+		}
+		seen := make(map[int]bool)
+		for _, p := range got {
+			if seen[p] {
+				t.Errorf("samplePages(seed %d, %d, %d) repeated page %d", tc.seed, tc.n, tc.max, p)
+			}
+			seen[p] = true
+		}
+	}
+}
+
+func TestSample_FetchedPages(t *testing.T) {
+	var mu sync.Mutex
+	var fetched []int
+	srv := newAPIServer(t, func(vals url.Values) ([]string, int, error) {
+		p, err := strconv.Atoi(vals.Get("p"))
+		if err != nil {
+			t.Errorf("Bad page %q", vals.Get("p"))
+		}
+		mu.Lock()
+		fetched = append(fetched, p)
+		mu.Unlock()
+		return []string{"p" + strconv.Itoa(p)}, 1000, nil
+	})
+
+	status, stdout, stderr := runDiscoverTest(t, srv, "-sample", "4", "-seed", "42")
+	if status != 0 {
+		t.Fatalf("runDiscover failed with status %d: %s", status, stderr)
+	}
+	sort.Ints(fetched)
+	if want := []int{5, 14, 23, 46}; !reflect.DeepEqual(fetched, want) {
+		t.Errorf("-sample 4 -seed 42 fetched pages %v; want %v", fetched, want)
+	}
+	var want string
+	for _, p := range []int{5, 14, 23, 46} {
+		want += testAlbumURL("p"+strconv.Itoa(p)) + "\n"
+	}
+	if stdout != want {
+		t.Errorf("-sample 4 -seed 42 printed %q; want %q", stdout, want)
+	}
+}
+
+func TestFailFastKeepGoing(t *testing.T) {
+	srv := newAPIServer(t, func(vals url.Values) ([]string, int, error) {
+		g := vals.Get("g")
+		if g == "jazz" {
+			return nil, 0, errors.New("broken")
+		}
+		return []string{g + "1", g + "2"}, 2, nil
+	})
+
+	for _, tc := range []struct {
+		flag       string
+		wantStatus int
+		wantOut    string
+	}{
+		{"-keep-going", partialFailureStatus, testAlbumURL("rock1") + "\n" + testAlbumURL("rock2") + "\n"},
+		{"-fail-fast", 1, ""},
+	} {
+		status, stdout, stderr := runDiscoverTest(t, srv, tc.flag, "-genre", "rock", "-genre", "jazz")
+		if status != tc.wantStatus {
+			t.Errorf("%v exited with %d; want %d", tc.flag, status, tc.wantStatus)
+		}
+		if stdout != tc.wantOut {
+			t.Errorf("%v printed %q; want %q", tc.flag, stdout, tc.wantOut)
+		}
+		if !strings.Contains(stderr, "Failed getting URLs for jazz") {
+			t.Errorf("%v didn't report jazz failure: %q", tc.flag, stderr)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	srv := newAPIServer(t, func(vals url.Values) ([]string, int, error) {
+		t.Errorf("Got request with -dry-run: %v", vals)
+		return nil, 0, nil
+	})
+	status, stdout, stderr := runDiscoverTest(t, srv, "-dry-run", "-discover-version", "2",
+		"-genre", "rock", "-pages", "2")
+	if status != 0 {
+		t.Fatalf("runDiscover exited with %d: %s", status, stderr)
+	}
+	want := srv.URL + "/api/discover/2/get_web?f=all&g=rock&gn=0&p=0&s=top&w=0\n" +
+		srv.URL + "/api/discover/2/get_web?f=all&g=rock&gn=0&p=1&s=top&w=0\n"
+	if stdout != want {
+		t.Errorf("-dry-run printed:\n%s\nwant:\n%s", stdout, want)
+	}
+}
+
+func TestStable(t *testing.T) {
+	genres := []string{"rock", "jazz", "metal"}
+	var reverse int32 // nonzero to reverse API ordering and delays
+	srv := newAPIServer(t, func(vals url.Values) ([]string, int, error) {
+		g, p := vals.Get("g"), vals.Get("p")
+		var idx int
+		for i, s := range genres {
+			if s == g {
+				idx = i
+			}
+		}
+		rev := atomic.LoadInt32(&reverse) != 0
+		if rev {
+			idx = len(genres) - 1 - idx
+		}
+		// Make the queries complete in different orders across runs.
+		time.Sleep(time.Duration(idx) * 20 * time.Millisecond)
+		slugs := []string{g + p + "a", g + p + "b", g + p + "c"}
+		if rev {
+			slugs[0], slugs[2] = slugs[2], slugs[0]
+		}
+		return slugs, 6, nil
+	})
+
+	args := []string{"-stable", "-concurrency", "3", "-pages", "2", "-limit", "10",
+		"-genre", "rock", "-genre", "jazz", "-genre", "metal"}
+	status, first, stderr := runDiscoverTest(t, srv, args...)
+	if status != 0 {
+		t.Fatalf("First run exited with %d: %s", status, stderr)
+	}
+	atomic.StoreInt32(&reverse, 1)
+	status, second, stderr := runDiscoverTest(t, srv, args...)
+	if status != 0 {
+		t.Fatalf("Second run exited with %d: %s", status, stderr)
+	}
+	if first != second {
+		t.Errorf("Runs printed different output:\n%s\nand:\n%s", first, second)
+	}
+
+	// Results should be sorted by URL before the limit is applied.
+	var want string
+	for _, s := range []string{"jazz0a", "jazz0b", "jazz0c", "jazz1a", "jazz1b", "jazz1c",
+		"metal0a", "metal0b", "metal0c", "metal1a"} {
+		want += testAlbumURL(s) + "\n"
+	}
+	if first != want {
+		t.Errorf("-stable printed:\n%s\nwant:\n%s", first, want)
+	}
+}
+
+func TestAllPages_DuplicatePage(t *testing.T) {
+	pages := [][]string{{"a", "b"}, {"b", "a"}, {"c"}, {}}
+	srv := newAPIServer(t, func(vals url.Values) ([]string, int, error) {
+		p, _ := strconv.Atoi(vals.Get("p"))
+		if p >= len(pages) {
+			t.Errorf("Got request for page %d after empty page", p)
+			return nil, 0, nil
+		}
+		return pages[p], 0, nil
+	})
+	status, stdout, stderr := runDiscoverTest(t, srv, "-all-pages")
+	if status != 0 {
+		t.Fatalf("runDiscover exited with %d: %s", status, stderr)
+	}
+	// The page of duplicates shouldn't stop paging before "c" is fetched.
+	if want := testAlbumURL("a") + "\n" + testAlbumURL("b") + "\n" + testAlbumURL("c") + "\n"; stdout != want {
+		t.Errorf("-all-pages printed %q; want %q", stdout, want)
+	}
+}
+
+func TestDefaultCacheTTL(t *testing.T) {
+	var reqs int32
+	srv := newAPIServer(t, func(vals url.Values) ([]string, int, error) {
+		atomic.AddInt32(&reqs, 1)
+		return []string{"a"}, 1, nil
+	})
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		if status, _, stderr := runDiscoverTest(t, srv, "-cache-dir", dir); status != 0 {
+			t.Fatalf("Run %d exited with %d: %s", i, status, stderr)
+		}
+	}
+	// The second run should use the cached response by default.
+	if n := atomic.LoadInt32(&reqs); n != 1 {
+		t.Errorf("Server got %d request(s); want 1", n)
+	}
+
+	// Disabling caching should send a new request.
+	if status, _, stderr := runDiscoverTest(t, srv, "-cache-dir", dir, "-cache-ttl", "0"); status != 0 {
+		t.Fatalf("Run with -cache-ttl=0 exited with %d: %s", status, stderr)
+	}
+	if n := atomic.LoadInt32(&reqs); n != 2 {
+		t.Errorf("Server got %d request(s) after -cache-ttl=0; want 2", n)
+	}
+}
+
+func TestCapCacheTTL(t *testing.T) {
+	for _, tc := range []struct {
+		ttl, interval, want time.Duration
+	}{
+		{time.Hour, 10 * time.Minute, 5 * time.Minute},
+		{time.Hour, time.Hour, 30 * time.Minute},
+		{time.Minute, time.Hour, time.Minute},
+	} {
+		client := &discover.Client{Cache: &discover.Cache{TTL: tc.ttl}}
+		if capCacheTTL(client, tc.interval); client.Cache.TTL != tc.want {
+			t.Errorf("capCacheTTL with TTL %v and interval %v set TTL to %v; want %v",
+				tc.ttl, tc.interval, client.Cache.TTL, tc.want)
+		}
+	}
+	capCacheTTL(&discover.Client{}, time.Minute) // shouldn't crash without a cache
+}
+
+func TestSampleGenres(t *testing.T) {
+	var mu sync.Mutex
+	var queried []string
+	srv := newAPIServer(t, func(vals url.Values) ([]string, int, error) {
+		label := genreLabel(vals.Get("g"), vals.Get("t"))
+		mu.Lock()
+		queried = append(queried, label)
+		mu.Unlock()
+		return []string{strings.ReplaceAll(label, "/", "-"), "shared"}, 2, nil
+	})
+
+	pairs := sampleGenrePairs(rand.New(rand.NewSource(5)), 3)
+	if len(pairs) != 3 {
+		t.Fatalf("sampleGenrePairs returned %q; want 3 pairs", pairs)
+	}
+	seen := make(map[string]bool)
+	for _, p := range pairs {
+		if seen[p] {
+			t.Errorf("sampleGenrePairs repeated %q", p)
+		}
+		seen[p] = true
+	}
+
+	// Sampled pairs should be printed using the requested output format and limit.
+	status, stdout, stderr := runDiscoverTest(t, srv, "-sample-genres", "3", "-seed", "5",
+		"-output", "csv", "-columns", "genre,subgenre,url", "-no-header", "-limit", "3")
+	if status != 0 {
+		t.Fatalf("runDiscover exited with %d: %s", status, stderr)
+	}
+	sorted := append([]string(nil), pairs...)
+	sort.Strings(sorted)
+	sort.Strings(queried)
+	if !reflect.DeepEqual(queried, sorted) {
+		t.Errorf("Server received queries %q; want %q", queried, sorted)
+	}
+	row := func(pair, slug string) string {
+		genre, subgenre, _ := strings.Cut(pair, "/")
+		return genre + "," + subgenre + "," + testAlbumURL(slug) + "\n"
+	}
+	// "shared" is only listed for the first pair.
+	want := row(pairs[0], strings.ReplaceAll(pairs[0], "/", "-")) + row(pairs[0], "shared") +
+		row(pairs[1], strings.ReplaceAll(pairs[1], "/", "-"))
+	if stdout != want {
+		t.Errorf("-sample-genres printed:\n%s\nwant:\n%s", stdout, want)
+	}
+
+	if status, _, _ := runDiscoverTest(t, srv, "-sample-genres", "3", "-genre", "rock"); status != 2 {
+		t.Errorf("-sample-genres with -genre exited with %d; want 2", status)
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// metricsPath is the path at which the "serve" command exports metrics.
+const metricsPath = "/metrics"
+
+// metricPrefix is prepended to the names of exported metrics.
+const metricPrefix = "bandcamp_discover_"
+
+// durationBuckets contains the upper bounds in seconds of histogram buckets
+// used for request durations.
+var durationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// metrics collects statistics about the "serve" command and exports them in
+// Prometheus's text format.
+type metrics struct {
+	client *discover.Client // used for cache stats
+
+	mu               sync.Mutex
+	upstreamRequests map[string]int64    // keyed by status code or "error"
+	upstreamDuration *histogram          // seconds
+	requests         map[[2]string]int64 // keyed by handler name and status code
+	requestDuration  map[string]*histogram
+	errors           map[string]int64 // keyed by source ("upstream" or handler name)
+}
+
+func newMetrics(client *discover.Client) *metrics {
+	return &metrics{
+		client:           client,
+		upstreamRequests: make(map[string]int64),
+		upstreamDuration: newHistogram(durationBuckets),
+		requests:         make(map[[2]string]int64),
+		requestDuration:  make(map[string]*histogram),
+		errors:           make(map[string]int64),
+	}
+}
+
+// instrumentTransport returns an http.RoundTripper that records requests
+// sent via rt. If rt is nil, http.DefaultTransport is used.
+func (m *metrics) instrumentTransport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := rt.RoundTrip(req)
+		elapsed := time.Since(start)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.upstreamDuration.observe(elapsed.Seconds())
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		m.upstreamRequests[code]++
+		if err != nil || resp.StatusCode >= 400 {
+			m.errors["upstream"]++
+		}
+		return resp, err
+	})
+}
+
+// roundTripperFunc adapts a function to the http.RoundTripper interface.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// instrumentHandler returns an http.Handler that records requests served by h
+// under the supplied name.
+func (m *metrics) instrumentHandler(name string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, req)
+		elapsed := time.Since(start)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.requests[[2]string{name, strconv.Itoa(sw.status)}]++
+		hist := m.requestDuration[name]
+		if hist == nil {
+			hist = newHistogram(durationBuckets)
+			m.requestDuration[name] = hist
+		}
+		hist.observe(elapsed.Seconds())
+		if sw.status >= 500 {
+			m.errors[name]++
+		}
+	})
+}
+
+// statusWriter wraps an http.ResponseWriter to record the response's status.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	sw.status = status
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+// write writes all metrics to w in Prometheus's text exposition format.
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeMetricHeader(w, "upstream_requests_total", "counter", "HTTP requests sent to Bandcamp by status code")
+	for _, code := range sortedKeys(m.upstreamRequests) {
+		fmt.Fprintf(w, "%vupstream_requests_total{code=%q} %d\n", metricPrefix, code, m.upstreamRequests[code])
+	}
+	writeMetricHeader(w, "upstream_request_duration_seconds", "histogram", "Duration of HTTP requests sent to Bandcamp")
+	m.upstreamDuration.write(w, "upstream_request_duration_seconds", "")
+
+	hits, misses, revalidated := m.client.CacheStats()
+	writeMetricHeader(w, "cache_hits_total", "counter", "Bandcamp responses read from the cache")
+	fmt.Fprintf(w, "%vcache_hits_total %d\n", metricPrefix, hits)
+	writeMetricHeader(w, "cache_misses_total", "counter", "Bandcamp responses not found in the cache")
+	fmt.Fprintf(w, "%vcache_misses_total %d\n", metricPrefix, misses)
+	writeMetricHeader(w, "cache_revalidations_total", "counter",
+		"Expired cached responses that Bandcamp reported as unchanged")
+	fmt.Fprintf(w, "%vcache_revalidations_total %d\n", metricPrefix, revalidated)
+
+	writeMetricHeader(w, "requests_total", "counter", "HTTP requests served by handler and status code")
+	keys := make([][2]string, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || (keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1])
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "%vrequests_total{handler=%q,code=%q} %d\n", metricPrefix, k[0], k[1], m.requests[k])
+	}
+	writeMetricHeader(w, "request_duration_seconds", "histogram", "Duration of HTTP requests served by handler")
+	for _, name := range sortedKeys(m.requestDuration) {
+		m.requestDuration[name].write(w, "request_duration_seconds", fmt.Sprintf("handler=%q", name))
+	}
+
+	writeMetricHeader(w, "errors_total", "counter",
+		`Failed requests to Bandcamp ("upstream") and server errors by handler`)
+	for _, src := range sortedKeys(m.errors) {
+		fmt.Fprintf(w, "%verrors_total{source=%q} %d\n", metricPrefix, src, m.errors[src])
+	}
+}
+
+// writeMetricHeader writes HELP and TYPE lines for the named metric.
+func writeMetricHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %v%v %v\n# TYPE %v%v %v\n", metricPrefix, name, help, metricPrefix, name, typ)
+}
+
+// histogram counts observations in cumulative buckets.
+type histogram struct {
+	bounds []float64 // upper bounds, ascending
+	counts []int64   // non-cumulative counts for each bound
+	count  int64     // total observations, including ones above all bounds
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]int64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	if i := sort.SearchFloat64s(h.bounds, v); i < len(h.bounds) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// write writes h's series for the named metric. labels contains
+// comma-separated additional labels, e.g. `handler="api"`.
+func (h *histogram) write(w io.Writer, name, labels string) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	var cum int64
+	for i, b := range h.bounds {
+		cum += h.counts[i]
+		le := strconv.FormatFloat(b, 'g', -1, 64)
+		fmt.Fprintf(w, "%v%v_bucket{%v%vle=%q} %d\n", metricPrefix, name, labels, sep, le, cum)
+	}
+	fmt.Fprintf(w, "%v%v_bucket{%v%vle=\"+Inf\"} %d\n", metricPrefix, name, labels, sep, h.count)
+	suffix := ""
+	if labels != "" {
+		suffix = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%v%v_sum%v %v\n", metricPrefix, name, suffix, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%v%v_count%v %d\n", metricPrefix, name, suffix, h.count)
+}
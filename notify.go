@@ -0,0 +1,273 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// notifier sends notifications about new results.
+type notifier interface {
+	// notify sends results in order. sent is the number of leading results
+	// that were delivered before err occurred (len(results) on success).
+	notify(ctx context.Context, results []discover.Result) (sent int, err error)
+}
+
+// notifyAll sends results to each of notifiers and returns any errors.
+// delivered is the number of leading results that were sent by all notifiers.
+// Nothing is sent if results is empty.
+func notifyAll(ctx context.Context, notifiers []notifier, results []discover.Result) (delivered int, errs []error) {
+	delivered = len(results)
+	if len(results) == 0 {
+		return 0, nil
+	}
+	for _, n := range notifiers {
+		sent, err := n.notify(ctx, results)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if sent < delivered {
+			delivered = sent
+		}
+	}
+	return delivered, errs
+}
+
+// webhookNotifier POSTs results as JSON to a URL.
+type webhookNotifier struct {
+	client *http.Client
+	url    string
+	batch  bool // send an array of all results instead of one request per result
+}
+
+func (n *webhookNotifier) notify(ctx context.Context, results []discover.Result) (int, error) {
+	if n.batch {
+		if err := postJSON(ctx, n.client, n.url, results); err != nil {
+			return 0, err
+		}
+		return len(results), nil
+	}
+	for i := range results {
+		if err := postJSON(ctx, n.client, n.url, &results[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(results), nil
+}
+
+// checkWebhookURL returns an error if s isn't an HTTP or HTTPS URL.
+func checkWebhookURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q isn't an HTTP or HTTPS URL", s)
+	}
+	return nil
+}
+
+// postJSON sends v as JSON to u in a POST request using hc.
+// An error is returned if the server doesn't reply with a 2xx status.
+func postJSON(ctx context.Context, hc *http.Client, u string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// Drop partial UTF-8 sequences that were cut off by the limit.
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyLen))
+		return fmt.Errorf("%v: got %v: %q", u, resp.Status, strings.ToValidUTF8(strings.TrimSpace(string(body)), ""))
+	}
+	return nil
+}
+
+// maxErrorBodyLen is the maximum number of bytes of response bodies that are
+// included in notification errors.
+const maxErrorBodyLen = 200
+
+// maxDiscordEmbeds is the maximum number of embeds in a Discord message.
+const maxDiscordEmbeds = 10
+
+// discordNotifier posts results as rich embeds to a Discord webhook.
+type discordNotifier struct {
+	client *http.Client
+	url    string
+}
+
+// discordEmbed is an embed object in a Discord webhook message.
+// See https://discord.com/developers/docs/resources/channel#embed-object.
+type discordEmbed struct {
+	Title  string `json:"title"`
+	URL    string `json:"url"`
+	Author struct {
+		Name string `json:"name"`
+	} `json:"author"`
+	Thumbnail *discordImage  `json:"thumbnail,omitempty"`
+	Fields    []discordField `json:"fields,omitempty"`
+}
+
+type discordImage struct {
+	URL string `json:"url"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+func (n *discordNotifier) notify(ctx context.Context, results []discover.Result) (int, error) {
+	var embeds []discordEmbed
+	for i := range results {
+		r := &results[i]
+		e := discordEmbed{Title: r.Album, URL: r.URL}
+		e.Author.Name = r.Artist
+		if u := r.ArtURL(); u != "" {
+			e.Thumbnail = &discordImage{u}
+		}
+		if r.Genre != "" {
+			e.Fields = append(e.Fields, discordField{"Genre", genreLabel(r.Genre, r.Subgenre), true})
+		}
+		embeds = append(embeds, e)
+	}
+	for sent := 0; sent < len(embeds); {
+		cnt := len(embeds) - sent
+		if cnt > maxDiscordEmbeds {
+			cnt = maxDiscordEmbeds
+		}
+		msg := struct {
+			Embeds []discordEmbed `json:"embeds"`
+		}{embeds[sent : sent+cnt]}
+		if err := postJSON(ctx, n.client, n.url, msg); err != nil {
+			return sent, err
+		}
+		sent += cnt
+	}
+	return len(results), nil
+}
+
+// maxSlackBlocks is the maximum number of blocks in a Slack message.
+const maxSlackBlocks = 50
+
+// slackNotifier posts results to a Slack incoming webhook using Block Kit.
+type slackNotifier struct {
+	client *http.Client
+	url    string
+}
+
+// slackBlock is a Block Kit section block.
+// See https://api.slack.com/reference/block-kit/blocks#section.
+type slackBlock struct {
+	Type      string      `json:"type"`
+	Text      slackText   `json:"text"`
+	Accessory *slackImage `json:"accessory,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackImage struct {
+	Type     string `json:"type"`
+	ImageURL string `json:"image_url"`
+	AltText  string `json:"alt_text"`
+}
+
+// slackEscaper escapes the characters that Slack treats as control characters
+// in mrkdwn text.
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func (n *slackNotifier) notify(ctx context.Context, results []discover.Result) (int, error) {
+	var blocks []slackBlock
+	for i := range results {
+		r := &results[i]
+		text := fmt.Sprintf("*<%v|%v>*\n%v", r.URL, slackEscaper.Replace(r.Album), slackEscaper.Replace(r.Artist))
+		if r.Genre != "" {
+			text += "\n_" + genreLabel(r.Genre, r.Subgenre) + "_"
+		}
+		b := slackBlock{Type: "section", Text: slackText{"mrkdwn", text}}
+		if u := r.ArtURL(); u != "" {
+			b.Accessory = &slackImage{"image", u, r.Album + " cover"}
+		}
+		blocks = append(blocks, b)
+	}
+	for sent := 0; sent < len(blocks); {
+		cnt := len(blocks) - sent
+		if cnt > maxSlackBlocks {
+			cnt = maxSlackBlocks
+		}
+		msg := struct {
+			Text   string       `json:"text"` // used in notifications
+			Blocks []slackBlock `json:"blocks"`
+		}{fmt.Sprintf("%d new Bandcamp release(s)", cnt), blocks[sent : sent+cnt]}
+		if err := postJSON(ctx, n.client, n.url, msg); err != nil {
+			return sent, err
+		}
+		sent += cnt
+	}
+	return len(results), nil
+}
+
+// defaultTelegramAPI is the base URL of Telegram's Bot API.
+const defaultTelegramAPI = "https://api.telegram.org"
+
+// telegramNotifier sends each result as a message from a Telegram bot.
+type telegramNotifier struct {
+	client *http.Client
+	api    string // defaultTelegramAPI
+	token  string // bot token from @BotFather
+	chat   string // chat ID or "@channelname"
+}
+
+func (n *telegramNotifier) notify(ctx context.Context, results []discover.Result) (int, error) {
+	type button struct {
+		Text string `json:"text"`
+		URL  string `json:"url"`
+	}
+	type markup struct {
+		InlineKeyboard [][]button `json:"inline_keyboard"`
+	}
+	u := n.api + "/bot" + n.token + "/sendMessage"
+	for i := range results {
+		r := &results[i]
+		text := fmt.Sprintf("<b>%v</b>\n%v", html.EscapeString(r.Album), html.EscapeString(r.Artist))
+		if r.Genre != "" {
+			text += "\n<i>" + html.EscapeString(genreLabel(r.Genre, r.Subgenre)) + "</i>"
+		}
+		msg := struct {
+			ChatID      string `json:"chat_id"`
+			Text        string `json:"text"`
+			ParseMode   string `json:"parse_mode"`
+			ReplyMarkup markup `json:"reply_markup"`
+		}{n.chat, text, "HTML", markup{[][]button{{{"Open on Bandcamp", r.URL}}}}}
+		if err := postJSON(ctx, n.client, u, msg); err != nil {
+			// Keep the bot token out of error messages.
+			return i, errors.New(strings.ReplaceAll(err.Error(), n.token, "<token>"))
+		}
+	}
+	return len(results), nil
+}
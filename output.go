@@ -0,0 +1,314 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// outputOptions contains options used by writeResults.
+type outputOptions struct {
+	title    string    // used by feeds, html, and xspf
+	columns  []string  // used by tsv and csv; keys from outputColumns
+	noHeader bool      // omit header row from tsv and csv
+	warnings io.Writer // used to report skipped results; may be nil
+
+	// tracks contains album tracks keyed by album URL. It is used by m3u and xspf.
+	tracks map[string][]discover.Track
+	// firstSeen is used by feeds to get results' publication times. If nil
+	// or if a result wasn't seen before, the current time is used.
+	firstSeen firstSeenFunc
+}
+
+// outputColumns maps from column names accepted by -columns to functions
+// returning the corresponding values for results.
+var outputColumns = map[string]func(r *discover.Result) string{
+	"artist":   func(r *discover.Result) string { return r.Artist },
+	"album":    func(r *discover.Result) string { return r.Album },
+	"url":      func(r *discover.Result) string { return r.URL },
+	"art":      func(r *discover.Result) string { return r.ArtURL() },
+	"band_id":  func(r *discover.Result) string { return formatID(r.BandID) },
+	"item_id":  func(r *discover.Result) string { return formatID(r.ItemID) },
+	"type":     func(r *discover.Result) string { return r.Type },
+	"genre":    func(r *discover.Result) string { return r.Genre },
+	"subgenre": func(r *discover.Result) string { return r.Subgenre },
+	"ranking":  func(r *discover.Result) string { return r.Ranking },
+	"rank":     func(r *discover.Result) string { return formatID(int64(r.Rank)) },
+
+	// These are only set with -details.
+	"release_date": detailColumn(func(d *discover.AlbumDetails) string { return d.ReleaseDate }),
+	"label":        detailColumn(func(d *discover.AlbumDetails) string { return d.Label }),
+	"tags":         detailColumn(func(d *discover.AlbumDetails) string { return strings.Join(d.Tags, ", ") }),
+	"price": detailColumn(func(d *discover.AlbumDetails) string {
+		return strconv.FormatFloat(d.Price, 'f', 2, 64)
+	}),
+	"currency":    detailColumn(func(d *discover.AlbumDetails) string { return d.Currency }),
+	"nyp":         detailColumn(func(d *discover.AlbumDetails) string { return strconv.FormatBool(d.NameYourPrice) }),
+	"free":        detailColumn(func(d *discover.AlbumDetails) string { return strconv.FormatBool(d.Free) }),
+	"track_count": detailColumn(func(d *discover.AlbumDetails) string { return formatID(int64(d.TrackCount)) }),
+
+	// These are only set with -details and -tracks.
+	"tracks": detailColumn(func(d *discover.AlbumDetails) string {
+		titles := make([]string, len(d.Tracks))
+		for i, t := range d.Tracks {
+			titles[i] = fmt.Sprintf("%v (%v)", t.Title, formatSeconds(t.Duration))
+		}
+		return strings.Join(titles, "; ")
+	}),
+	"duration": detailColumn(func(d *discover.AlbumDetails) string {
+		if len(d.Tracks) == 0 {
+			return ""
+		}
+		var total float64
+		for _, t := range d.Tracks {
+			total += t.Duration
+		}
+		return formatSeconds(total)
+	}),
+}
+
+// formatSeconds formats a duration in seconds like "4:05" or "1:02:03".
+func formatSeconds(sec float64) string {
+	s := int(math.Round(sec))
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// detailColumn returns an outputColumns function that calls fn with a result's
+// details, or returns an empty string if the result doesn't have details.
+func detailColumn(fn func(d *discover.AlbumDetails) string) func(r *discover.Result) string {
+	return func(r *discover.Result) string {
+		if r.Details == nil {
+			return ""
+		}
+		return fn(r.Details)
+	}
+}
+
+// formatID formats id as a decimal string, or returns an empty string if id is 0.
+func formatID(id int64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+// defaultColumns maps from -output values to the columns that are used if
+// -columns is empty.
+var defaultColumns = map[string]string{
+	"csv": "artist,album,url,genre,subgenre,ranking",
+	"tsv": "artist,album,url",
+}
+
+// parseColumns parses a comma-separated list of column names.
+func parseColumns(s string) ([]string, error) {
+	var cols []string
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if _, ok := outputColumns[c]; !ok {
+			return nil, fmt.Errorf("unknown column %q (valid: %v)", c, strings.Join(sortedKeys(outputColumns), ", "))
+		}
+		cols = append(cols, c)
+	}
+	return cols, nil
+}
+
+// outputWriter writes results to w.
+type outputWriter func(w io.Writer, results []discover.Result, opts *outputOptions) error
+
+// outputFormats maps from -output values to the corresponding writers.
+var outputFormats = map[string]outputWriter{
+	"url": func(w io.Writer, results []discover.Result, opts *outputOptions) error {
+		return writeLines(w, results, func(r *discover.Result) string { return r.URL })
+	},
+	"long": func(w io.Writer, results []discover.Result, opts *outputOptions) error {
+		return writeLines(w, results, func(r *discover.Result) string {
+			return fmt.Sprintf("%v – %v <%v>", r.Artist, r.Album, r.URL)
+		})
+	},
+	"markdown": func(w io.Writer, results []discover.Result, opts *outputOptions) error {
+		return writeLines(w, results, func(r *discover.Result) string {
+			return fmt.Sprintf("- [%v – %v](%v)", escapeMarkdown(r.Artist), escapeMarkdown(r.Album), r.URL)
+		})
+	},
+	"json": func(w io.Writer, results []discover.Result, opts *outputOptions) error {
+		if results == nil {
+			results = []discover.Result{} // write "[]" rather than "null"
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	},
+	"jsonl": func(w io.Writer, results []discover.Result, opts *outputOptions) error {
+		enc := json.NewEncoder(w)
+		for i := range results {
+			if err := enc.Encode(&results[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	"tsv": func(w io.Writer, results []discover.Result, opts *outputOptions) error {
+		return writeTable(w, "tsv", results, opts.columns, !opts.noHeader)
+	},
+	"csv": func(w io.Writer, results []discover.Result, opts *outputOptions) error {
+		return writeTable(w, "csv", results, opts.columns, !opts.noHeader)
+	},
+	"ids": writeIDs,
+	"m3u": writeM3U,
+	"rss": func(w io.Writer, results []discover.Result, opts *outputOptions) error {
+		return writeRSS(w, opts.title, results, opts.firstSeen, time.Now())
+	},
+	"atom": func(w io.Writer, results []discover.Result, opts *outputOptions) error {
+		return writeAtom(w, opts.title, results, opts.firstSeen, time.Now())
+	},
+	"html": func(w io.Writer, results []discover.Result, opts *outputOptions) error {
+		return writeHTML(w, opts.title, results)
+	},
+	"xspf": func(w io.Writer, results []discover.Result, opts *outputOptions) error {
+		return writeXSPF(w, opts.title, results, opts.tracks)
+	},
+}
+
+// writeResults writes results to w in the specified format (a key from outputFormats).
+func writeResults(w io.Writer, format string, results []discover.Result, opts *outputOptions) error {
+	fn, ok := outputFormats[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q (valid: %v)", format, strings.Join(sortedKeys(outputFormats), ", "))
+	}
+	return fn(w, results, opts)
+}
+
+// writeLines writes a line to w for each result using fn.
+func writeLines(w io.Writer, results []discover.Result, fn func(r *discover.Result) string) error {
+	for i := range results {
+		if _, err := fmt.Fprintln(w, fn(&results[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownEscaper escapes characters that have special meaning in Markdown link text.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "[", `\[`, "]", `\]`, "*", `\*`, "_", `\_`, "`", "\\`", "<", `\<`)
+
+// escapeMarkdown escapes s for use as Markdown link text.
+func escapeMarkdown(s string) string { return markdownEscaper.Replace(s) }
+
+// writeIDs writes a "band_id:item_id" line to w for each result.
+// Results missing IDs are skipped and reported to opts.warnings.
+func writeIDs(w io.Writer, results []discover.Result, opts *outputOptions) error {
+	for i := range results {
+		r := &results[i]
+		if r.BandID == 0 || r.ItemID == 0 {
+			if opts.warnings != nil {
+				fmt.Fprintf(opts.warnings, "Warning: skipping %v without IDs\n", r.URL)
+			}
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%d:%d\n", r.BandID, r.ItemID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeM3U writes results to w as an extended M3U playlist. Streamable tracks
+// from opts.tracks are listed; album URLs are used for results without tracks.
+func writeM3U(w io.Writer, results []discover.Result, opts *outputOptions) error {
+	if _, err := io.WriteString(w, "#EXTM3U\n"); err != nil {
+		return err
+	}
+	for _, r := range results {
+		tracks, ok := opts.tracks[r.URL]
+		if !ok {
+			if _, err := fmt.Fprintf(w, "#EXTINF:-1,%v - %v\n%v\n", r.Artist, r.Album, r.URL); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, t := range tracks {
+			if t.StreamURL == "" {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "#EXTINF:%d,%v - %v\n%v\n",
+				int(math.Round(t.Duration)), t.Artist, t.Title, t.StreamURL); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeTemplate executes tmpl for each result and writes the output to w.
+// A newline is written after each result.
+func writeTemplate(w io.Writer, tmpl *template.Template, results []discover.Result) error {
+	for i := range results {
+		if err := tmpl.Execute(w, &results[i]); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in ascending order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeTable writes the specified columns of results to w in format ("csv" or
+// "tsv"). If header is true, a header row containing column names is written
+// first.
+func writeTable(w io.Writer, format string, results []discover.Result, columns []string, header bool) error {
+	var rows [][]string
+	if header {
+		rows = append(rows, columns)
+	}
+	for i := range results {
+		row := make([]string, len(columns))
+		for j, c := range columns {
+			row[j] = outputColumns[c](&results[i])
+		}
+		rows = append(rows, row)
+	}
+
+	if format == "csv" {
+		cw := csv.NewWriter(w)
+		cw.WriteAll(rows)
+		return cw.Error()
+	}
+	// Tabs and newlines can't be escaped in TSV, so replace them with spaces.
+	repl := strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+	for _, row := range rows {
+		for j := range row {
+			row[j] = repl.Replace(row[j])
+		}
+		if _, err := io.WriteString(w, strings.Join(row, "\t")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
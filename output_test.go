@@ -0,0 +1,211 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+var updateGolden = flag.Bool("update", false, "Update golden files in testdata")
+
+// testResults is used by output tests.
+var testResults = []discover.Result{
+	{
+		Artist: "Artist A", Album: "Album A", URL: "https://a.bandcamp.com/album/a",
+		Type: "album", BandID: 10, ItemID: 11, Genre: "rock", Ranking: "top", Rank: 1,
+	},
+	{
+		Artist: "Artist B", Album: "Album B", URL: "https://b.bandcamp.com/track/b",
+		Type: "track", BandID: 20, ItemID: 21, Genre: "rock", Subgenre: "indie", Ranking: "top", Rank: 2,
+	},
+}
+
+// formatResults returns the output of writeResults for the supplied arguments.
+func formatResults(t *testing.T, format string, results []discover.Result, opts *outputOptions) string {
+	t.Helper()
+	var b bytes.Buffer
+	if err := writeResults(&b, format, results, opts); err != nil {
+		t.Fatalf("writeResults(%q) failed: %v", format, err)
+	}
+	return b.String()
+}
+
+func TestParseColumns(t *testing.T) {
+	const s = "artist, url,band_id"
+	want := []string{"artist", "url", "band_id"}
+	if got, err := parseColumns(s); err != nil {
+		t.Errorf("parseColumns(%q) failed: %v", s, err)
+	} else if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseColumns(%q) = %q; want %q", s, got, want)
+	}
+
+	for _, s := range []string{"artist,bogus", "", "artist,,url", "URL"} {
+		if got, err := parseColumns(s); err == nil {
+			t.Errorf("parseColumns(%q) = %q; want error", s, got)
+		}
+	}
+	if _, err := parseColumns("artist,bogus"); err == nil || !strings.Contains(err.Error(), `"bogus"`) {
+		t.Errorf(`parseColumns("artist,bogus") returned %v; want error mentioning "bogus"`, err)
+	}
+}
+
+func TestWriteResults_Header(t *testing.T) {
+	cols := []string{"artist", "url"}
+	for _, tc := range []struct {
+		format   string
+		noHeader bool
+		want     string
+	}{
+		{"tsv", false, "artist\turl\n" +
+			"Artist A\thttps://a.bandcamp.com/album/a\n" +
+			"Artist B\thttps://b.bandcamp.com/track/b\n"},
+		{"tsv", true, "Artist A\thttps://a.bandcamp.com/album/a\n" +
+			"Artist B\thttps://b.bandcamp.com/track/b\n"},
+		{"csv", false, "artist,url\n" +
+			"Artist A,https://a.bandcamp.com/album/a\n" +
+			"Artist B,https://b.bandcamp.com/track/b\n"},
+		{"csv", true, "Artist A,https://a.bandcamp.com/album/a\n" +
+			"Artist B,https://b.bandcamp.com/track/b\n"},
+	} {
+		opts := outputOptions{columns: cols, noHeader: tc.noHeader}
+		if got := formatResults(t, tc.format, testResults, &opts); got != tc.want {
+			t.Errorf("%v with noHeader=%v wrote:\n%s\nwant:\n%s", tc.format, tc.noHeader, got, tc.want)
+		}
+	}
+
+	// Only the header should be written if there are no results.
+	opts := outputOptions{columns: cols}
+	if got, want := formatResults(t, "tsv", nil, &opts), "artist\turl\n"; got != want {
+		t.Errorf("tsv without results wrote %q; want %q", got, want)
+	}
+	opts.noHeader = true
+	if got := formatResults(t, "tsv", nil, &opts); got != "" {
+		t.Errorf("tsv without results or header wrote %q; want nothing", got)
+	}
+}
+
+// checkGolden compares got against the contents of testdata/name.
+// If -update was passed, the file is overwritten instead.
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	p := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(p, []byte(got), 0644); err != nil {
+			t.Fatal("Failed updating golden file:", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal("Failed reading golden file:", err)
+	}
+	if got != string(want) {
+		t.Errorf("Output doesn't match %v:\n%s\nwant:\n%s", p, got, want)
+	}
+}
+
+func TestWriteResults_JSON(t *testing.T) {
+	results := append([]discover.Result(nil), testResults...)
+	results[0].ArtID = 123
+	results[0].Details = &discover.AlbumDetails{
+		ReleaseDate: "2023-01-02",
+		Label:       "Label",
+		Tags:        []string{"rock", "indie"},
+		Price:       7,
+		Currency:    "USD",
+		TrackCount:  2,
+		Tracks: []discover.Track{
+			{Title: "One", Duration: 61.5},
+			{Title: "Two", Duration: 120},
+		},
+	}
+	for _, format := range []string{"json", "jsonl"} {
+		checkGolden(t, "results."+format, formatResults(t, format, results, &outputOptions{}))
+	}
+
+	// JSON output should be an empty array rather than null, while JSONL
+	// output should be empty.
+	if got, want := formatResults(t, "json", nil, &outputOptions{}), "[]\n"; got != want {
+		t.Errorf("json without results wrote %q; want %q", got, want)
+	}
+	if got := formatResults(t, "jsonl", nil, &outputOptions{}); got != "" {
+		t.Errorf("jsonl without results wrote %q; want nothing", got)
+	}
+}
+
+func TestWriteResults_TableQuoting(t *testing.T) {
+	results := []discover.Result{
+		{Artist: `Smith, "Jr."`, Album: "Line\nBreak", URL: "https://a.bandcamp.com/album/a"},
+		{Artist: "Tab\tSeparated", Album: "Carriage\r\nReturn", URL: "https://b.bandcamp.com/album/b"},
+		{Artist: " Spaces ", Album: "", URL: "https://c.bandcamp.com/album/c"},
+	}
+	opts := outputOptions{columns: []string{"artist", "album", "url"}, noHeader: true}
+
+	// CSV fields should be quoted as needed (including for leading spaces).
+	if got, want := formatResults(t, "csv", results, &opts),
+		`"Smith, ""Jr.""","Line`+"\n"+`Break",https://a.bandcamp.com/album/a`+"\n"+
+			"Tab\tSeparated,\"Carriage\r\nReturn\",https://b.bandcamp.com/album/b\n"+
+			"\" Spaces \",,https://c.bandcamp.com/album/c\n"; got != want {
+		t.Errorf("csv wrote %q; want %q", got, want)
+	}
+
+	// Tabs and newlines can't be escaped in TSV, so they should be replaced.
+	if got, want := formatResults(t, "tsv", results, &opts),
+		`Smith, "Jr."`+"\tLine Break\thttps://a.bandcamp.com/album/a\n"+
+			"Tab Separated\tCarriage  Return\thttps://b.bandcamp.com/album/b\n"+
+			" Spaces \t\thttps://c.bandcamp.com/album/c\n"; got != want {
+		t.Errorf("tsv wrote %q; want %q", got, want)
+	}
+}
+
+func TestWriteIDs(t *testing.T) {
+	results := append([]discover.Result(nil), testResults...)
+	results = append(results,
+		discover.Result{URL: "https://c.bandcamp.com/album/no-ids"},
+		discover.Result{URL: "https://d.bandcamp.com/album/no-item", BandID: 40})
+	var warnings bytes.Buffer
+	opts := outputOptions{warnings: &warnings}
+	if got, want := formatResults(t, "ids", results, &opts), "10:11\n20:21\n"; got != want {
+		t.Errorf("ids wrote %q; want %q", got, want)
+	}
+	if got, want := warnings.String(),
+		"Warning: skipping https://c.bandcamp.com/album/no-ids without IDs\n"+
+			"Warning: skipping https://d.bandcamp.com/album/no-item without IDs\n"; got != want {
+		t.Errorf("ids warned %q; want %q", got, want)
+	}
+
+	// Warnings are optional.
+	if got, want := formatResults(t, "ids", results[2:], &outputOptions{}), ""; got != want {
+		t.Errorf("ids without warnings wrote %q; want %q", got, want)
+	}
+}
+
+func TestWriteM3U(t *testing.T) {
+	opts := outputOptions{tracks: map[string][]discover.Track{
+		testResults[0].URL: {
+			{Num: 1, Title: "One", Artist: "Artist A", Duration: 61.4, StreamURL: "https://t4.bcbits.com/stream/1"},
+			{Num: 2, Title: "Unstreamable", Artist: "Artist A", Duration: 30},
+			{Num: 3, Title: "Three", Artist: "Guest", Duration: 179.6, StreamURL: "https://t4.bcbits.com/stream/3"},
+		},
+	}}
+	// Results without tracks should be listed by URL.
+	const want = "#EXTM3U\n" +
+		"#EXTINF:61,Artist A - One\nhttps://t4.bcbits.com/stream/1\n" +
+		"#EXTINF:180,Guest - Three\nhttps://t4.bcbits.com/stream/3\n" +
+		"#EXTINF:-1,Artist B - Album B\nhttps://b.bandcamp.com/track/b\n"
+	if got := formatResults(t, "m3u", testResults, &opts); got != want {
+		t.Errorf("m3u wrote:\n%s\nwant:\n%s", got, want)
+	}
+	if got, want := formatResults(t, "m3u", nil, &outputOptions{}), "#EXTM3U\n"; got != want {
+		t.Errorf("m3u without results wrote %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// tralbumRegexp matches the data-tralbum attribute in album pages.
+var tralbumRegexp = regexp.MustCompile(`data-tralbum="([^"]*)"`)
+
+// ldJSONRegexp matches the JSON-LD script element in album pages.
+// The first submatch contains the JSON.
+var ldJSONRegexp = regexp.MustCompile(`(?s)<script type="application/ld\+json">(.*?)</script>`)
+
+// nypRegexp matches the "name your price" label in album pages' digital
+// purchase sections.
+var nypRegexp = regexp.MustCompile(`class="[^"]*\bbuyItemNyp\b`)
+
+// Track describes a track on an album page.
+type Track struct {
+	Num       int     `json:"num,omitempty"` // 1-based; 0 if unknown
+	Title     string  `json:"title"`
+	Artist    string  `json:"artist"`
+	Duration  float64 `json:"duration,omitempty"`   // seconds
+	StreamURL string  `json:"stream_url,omitempty"` // empty if not streamable
+}
+
+// AlbumTracks fetches the album page at albumURL and returns the album's
+// tracks. Stream URLs are only valid for a limited time.
+func (c *Client) AlbumTracks(ctx context.Context, albumURL string) ([]Track, error) {
+	b, err := c.getAlbumPage(ctx, albumURL)
+	if err != nil {
+		return nil, err
+	}
+	tracks, err := parseAlbumTracks(b)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", albumURL, err)
+	}
+	return tracks, nil
+}
+
+// AlbumDetails contains metadata from an album or track page.
+type AlbumDetails struct {
+	ReleaseDate string   `json:"release_date,omitempty"` // YYYY-MM-DD
+	Label       string   `json:"label,omitempty"`        // empty if self-released
+	Tags        []string `json:"tags,omitempty"`
+	Price       float64  `json:"price"` // minimum digital price
+	Currency    string   `json:"currency,omitempty"`
+	// NameYourPrice is true if buyers can choose how much to pay (at least Price).
+	NameYourPrice bool `json:"name_your_price,omitempty"`
+	// Free is true if the album can be downloaded without paying, either via a
+	// free download page or because it's name-your-price with no minimum.
+	Free       bool    `json:"free,omitempty"`
+	TrackCount int     `json:"track_count,omitempty"`
+	Tracks     []Track `json:"tracks,omitempty"`
+}
+
+// AlbumDetails fetches the album page at albumURL and returns its metadata.
+func (c *Client) AlbumDetails(ctx context.Context, albumURL string) (*AlbumDetails, error) {
+	b, err := c.getAlbumPage(ctx, albumURL)
+	if err != nil {
+		return nil, err
+	}
+	det, err := parseAlbumDetails(b)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", albumURL, err)
+	}
+	return det, nil
+}
+
+// getAlbumPage fetches and returns the album page at albumURL.
+func (c *Client) getAlbumPage(ctx context.Context, albumURL string) ([]byte, error) {
+	resp, err := c.get(ctx, albumURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(albumURL, resp); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// pageDateLayout is the layout of dates in album pages' embedded data.
+const pageDateLayout = "02 Jan 2006 15:04:05 MST"
+
+// parseAlbumDetails returns the metadata in page's data-tralbum attribute and
+// JSON-LD script.
+func parseAlbumDetails(page []byte) (*AlbumDetails, error) {
+	m := tralbumRegexp.FindSubmatch(page)
+	if m == nil {
+		return nil, errors.New("didn't find album data")
+	}
+	var tralbum struct {
+		AlbumReleaseDate string `json:"album_release_date"`
+		FreeDownloadPage string `json:"freeDownloadPage"` // null unless free
+		Current          struct {
+			ReleaseDate  string  `json:"release_date"`
+			MinimumPrice float64 `json:"minimum_price"`
+		} `json:"current"`
+	}
+	if err := json.Unmarshal([]byte(html.UnescapeString(string(m[1]))), &tralbum); err != nil {
+		return nil, err
+	}
+	tracks, err := parseAlbumTracks(page)
+	if err != nil {
+		return nil, err
+	}
+	det := &AlbumDetails{
+		Price:         tralbum.Current.MinimumPrice,
+		NameYourPrice: nypRegexp.Match(page),
+		Free:          tralbum.FreeDownloadPage != "",
+		TrackCount:    len(tracks),
+		Tracks:        tracks,
+	}
+	if det.NameYourPrice && det.Price == 0 {
+		det.Free = true
+	}
+	for _, s := range []string{tralbum.AlbumReleaseDate, tralbum.Current.ReleaseDate} {
+		if t, err := time.Parse(pageDateLayout, s); err == nil {
+			det.ReleaseDate = t.Format("2006-01-02")
+			break
+		}
+	}
+
+	// The label, tags, and currency are only in the JSON-LD data.
+	if m := ldJSONRegexp.FindSubmatch(page); m != nil {
+		type offer struct {
+			PriceCurrency string `json:"priceCurrency"`
+		}
+		var ld struct {
+			ByArtist struct {
+				Name string `json:"name"`
+			} `json:"byArtist"`
+			Publisher struct {
+				Name string `json:"name"`
+			} `json:"publisher"`
+			Keywords     json.RawMessage `json:"keywords"` // array or comma-separated string
+			Offers       *offer          `json:"offers"`   // used by track pages
+			AlbumRelease []struct {
+				Offers *offer `json:"offers"`
+			} `json:"albumRelease"`
+		}
+		if err := json.Unmarshal(m[1], &ld); err != nil {
+			return nil, fmt.Errorf("bad JSON-LD: %v", err)
+		}
+		if ld.Publisher.Name != ld.ByArtist.Name {
+			det.Label = ld.Publisher.Name
+		}
+		det.Tags = parseKeywords(ld.Keywords)
+		if ld.Offers != nil {
+			det.Currency = ld.Offers.PriceCurrency
+		}
+		for _, rel := range ld.AlbumRelease {
+			if det.Currency == "" && rel.Offers != nil {
+				det.Currency = rel.Offers.PriceCurrency
+			}
+		}
+	}
+	return det, nil
+}
+
+// parseKeywords parses a JSON-LD keywords value, which may be either an array
+// or a comma-separated string.
+func parseKeywords(b json.RawMessage) []string {
+	var tags []string
+	if err := json.Unmarshal(b, &tags); err == nil {
+		return tags
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil || s == "" {
+		return nil
+	}
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// parseAlbumTracks returns the tracks listed in page's data-tralbum attribute.
+func parseAlbumTracks(page []byte) ([]Track, error) {
+	m := tralbumRegexp.FindSubmatch(page)
+	if m == nil {
+		return nil, errors.New("didn't find album data")
+	}
+	var data struct {
+		Artist    string `json:"artist"`
+		TrackInfo []struct {
+			Title    string            `json:"title"`
+			Artist   string            `json:"artist"` // only set for compilations
+			TrackNum int               `json:"track_num"`
+			Duration float64           `json:"duration"`
+			File     map[string]string `json:"file"` // e.g. "mp3-128" to URL
+		} `json:"trackinfo"`
+	}
+	if err := json.Unmarshal([]byte(html.UnescapeString(string(m[1]))), &data); err != nil {
+		return nil, err
+	}
+	tracks := make([]Track, 0, len(data.TrackInfo))
+	for _, ti := range data.TrackInfo {
+		t := Track{
+			Num:       ti.TrackNum,
+			Title:     ti.Title,
+			Artist:    ti.Artist,
+			Duration:  ti.Duration,
+			StreamURL: ti.File["mp3-128"],
+		}
+		if t.Artist == "" {
+			t.Artist = data.Artist
+		}
+		tracks = append(tracks, t)
+	}
+	return tracks, nil
+}
@@ -0,0 +1,28 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// WriteArt fetches r's cover art (see Result.ArtURL) and copies it to w.
+func (c *Client) WriteArt(ctx context.Context, r *Result, w io.Writer) error {
+	u := r.ArtURL()
+	if u == "" {
+		return errors.New("result has no art")
+	}
+	resp, err := c.get(ctx, u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(u, resp); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
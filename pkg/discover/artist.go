@@ -0,0 +1,213 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// albumPathRegexp matches the paths of album pages.
+var albumPathRegexp = regexp.MustCompile(`^/album/[-_a-zA-Z0-9]+$`)
+
+// releasePathRegexp matches the paths of album and track pages.
+var releasePathRegexp = regexp.MustCompile(`^/(?:album|track)/[-_a-zA-Z0-9]+$`)
+
+// gridLinkRegexp matches links to releases in the music grid of an artist's
+// music page. The first submatch contains the escaped href.
+var gridLinkRegexp = regexp.MustCompile(`<li\s[^>]*class="music-grid-item[^"]*"[^>]*>\s*<a\s+href="([^"]*)"`)
+
+// clientItemsRegexp matches the music grid's data-client-items attribute,
+// which lists releases that aren't included in the grid's HTML. The first
+// submatch contains the escaped JSON.
+var clientItemsRegexp = regexp.MustCompile(`\sdata-client-items="([^"]*)"`)
+
+// ArtistAlbums fetches the music page of the artist at artistURL (e.g.
+// "https://artist.bandcamp.com") and returns the URLs of the artist's albums.
+func (c *Client) ArtistAlbums(ctx context.Context, artistURL string) ([]string, error) {
+	page, base, err := c.getMusicPage(ctx, artistURL)
+	if err != nil {
+		return nil, err
+	}
+	return parseArtistURLs(page, base, albumPathRegexp)
+}
+
+// ArtistDiscography fetches the music page of the artist at artistURL and the
+// page of each album and track listed there, with at most concurrency release
+// pages fetched simultaneously. Results describing the releases (with Details
+// set) are returned in descending order by release date. Releases whose pages
+// can't be loaded are reported to c.SkipFunc.
+func (c *Client) ArtistDiscography(ctx context.Context, artistURL string, concurrency int) ([]Result, error) {
+	page, base, err := c.getMusicPage(ctx, artistURL)
+	if err != nil {
+		return nil, err
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	urls, err := parseArtistURLs(page, base, releasePathRegexp)
+	if err != nil {
+		return nil, err
+	}
+	rels := make([]Result, len(urls))
+	errs := make([]error, len(urls))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			rels[i], errs[i] = c.release(ctx, u)
+		}(i, u)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var res []Result
+	for i, u := range urls {
+		if err := errs[i]; err != nil {
+			if c.SkipFunc != nil {
+				c.SkipFunc(u, strings.TrimPrefix(err.Error(), u+": "))
+			}
+			continue
+		}
+		res = append(res, rels[i])
+	}
+	// Dates are formatted as YYYY-MM-DD, so they sort lexically (with
+	// unknown dates last).
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Details.ReleaseDate > res[j].Details.ReleaseDate })
+	for i := range res {
+		res[i].Rank = i + 1
+	}
+	return res, nil
+}
+
+// getMusicPage fetches the music page of the artist at artistURL. The page's
+// URL is also returned.
+func (c *Client) getMusicPage(ctx context.Context, artistURL string) ([]byte, *url.URL, error) {
+	base, err := url.Parse(strings.TrimSuffix(artistURL, "/") + "/music")
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := c.get(ctx, base.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(base.String(), resp); err != nil {
+		return nil, nil, err
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, base, nil
+}
+
+// release fetches the album or track page at u and returns a result
+// describing it.
+func (c *Client) release(ctx context.Context, u string) (Result, error) {
+	b, err := c.getAlbumPage(ctx, u)
+	if err != nil {
+		return Result{}, err
+	}
+	r, err := parseRelease(b)
+	if err != nil {
+		return Result{}, fmt.Errorf("%v: %v", u, err)
+	}
+	if r.Details, err = parseAlbumDetails(b); err != nil {
+		return Result{}, fmt.Errorf("%v: %v", u, err)
+	}
+	r.URL = u
+	return r, nil
+}
+
+// parseRelease returns a result containing the artist, title, type, and IDs
+// from page's data-tralbum attribute.
+func parseRelease(page []byte) (Result, error) {
+	m := tralbumRegexp.FindSubmatch(page)
+	if m == nil {
+		return Result{}, errors.New("didn't find album data")
+	}
+	var tralbum struct {
+		ID       int64  `json:"id"`
+		ItemType string `json:"item_type"` // "album" or "track"
+		Artist   string `json:"artist"`
+		ArtID    int64  `json:"art_id"`
+		Current  struct {
+			Title  string `json:"title"`
+			BandID int64  `json:"band_id"`
+		} `json:"current"`
+	}
+	if err := json.Unmarshal([]byte(html.UnescapeString(string(m[1]))), &tralbum); err != nil {
+		return Result{}, err
+	}
+	if !contains(Types, tralbum.ItemType) {
+		return Result{}, fmt.Errorf("unsupported item type %q", tralbum.ItemType)
+	}
+	return Result{
+		Artist: tralbum.Artist,
+		Album:  tralbum.Current.Title,
+		Type:   tralbum.ItemType,
+		ArtID:  tralbum.ArtID,
+		BandID: tralbum.Current.BandID,
+		ItemID: tralbum.ID,
+	}, nil
+}
+
+// parseArtistURLs returns the unique URLs of releases in the music grid of
+// page, an artist's music page fetched from base. Only URLs on base's host
+// with paths matched by re are returned.
+func parseArtistURLs(page []byte, base *url.URL, re *regexp.Regexp) ([]string, error) {
+	var refs []string
+	for _, m := range gridLinkRegexp.FindAllSubmatch(page, -1) {
+		refs = append(refs, html.UnescapeString(string(m[1])))
+	}
+	if m := clientItemsRegexp.FindSubmatch(page); m != nil {
+		var items []struct {
+			PageURL string `json:"page_url"`
+		}
+		if err := json.Unmarshal([]byte(html.UnescapeString(string(m[1]))), &items); err != nil {
+			return nil, fmt.Errorf("%v: bad client items: %v", base, err)
+		}
+		for _, it := range items {
+			refs = append(refs, it.PageURL)
+		}
+	}
+
+	var urls []string
+	seen := make(map[string]struct{})
+	for _, ref := range refs {
+		u, err := base.Parse(ref)
+		if err != nil || !strings.EqualFold(u.Host, base.Host) || !re.MatchString(u.Path) {
+			continue
+		}
+		// Links sometimes include parameters like "?label=123&tab=music".
+		u.RawQuery, u.Fragment = "", ""
+		s := u.String()
+		if _, ok := seen[s]; !ok {
+			seen[s] = struct{}{}
+			urls = append(urls, s)
+		}
+	}
+	return urls, nil
+}
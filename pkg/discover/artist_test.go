@@ -0,0 +1,88 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// musicPage is an abbreviated artist music page. The first releases are
+// listed in the grid's HTML and the rest in its data-client-items attribute.
+const musicPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta property="og:url" content="https://artist.bandcamp.com/album/og-only">
+</head>
+<body>
+<div id="pagedata" data-blob="{&quot;url&quot;:&quot;https:\/\/artist.bandcamp.com\/album\/blob-only&quot;}"></div>
+<div id="sidebar">
+  <a href="/album/sidebar-only">Sidebar</a>
+  <a href="https://other.bandcamp.com/album/recommended">Recommended</a>
+</div>
+<ol id="music-grid" class="editable-grid music-grid columns-4 public" data-edit-callback="/music_reorder"
+    data-client-items="[{&quot;id&quot;:3,&quot;type&quot;:&quot;album&quot;,&quot;page_url&quot;:&quot;/album/third&quot;},{&quot;id&quot;:4,&quot;type&quot;:&quot;track&quot;,&quot;page_url&quot;:&quot;/track/fourth&quot;},{&quot;id&quot;:5,&quot;type&quot;:&quot;album&quot;,&quot;page_url&quot;:&quot;https://other.bandcamp.com/album/split?label=1&amp;tab=music&quot;},{&quot;id&quot;:1,&quot;type&quot;:&quot;album&quot;,&quot;page_url&quot;:&quot;/album/first&quot;}]">
+  <li data-item-id="album-1" data-band-id="10" class="music-grid-item square first-four">
+    <a href="/album/first">
+      <div class="art"><img src="https://f4.bcbits.com/img/a1_2.jpg" alt=""></div>
+      <p class="title">First</p>
+    </a>
+  </li>
+  <li data-item-id="album-2" data-band-id="10" class="music-grid-item square">
+    <a href="https://artist.bandcamp.com/album/second?label=10&amp;tab=music">
+      <p class="title">Second</p>
+    </a>
+  </li>
+  <li data-item-id="track-6" data-band-id="10" class="music-grid-item square">
+    <a href="/track/sixth">
+      <p class="title">Sixth</p>
+    </a>
+  </li>
+</ol>
+</body>
+</html>
+`
+
+func TestParseArtistURLs(t *testing.T) {
+	base, err := url.Parse("https://artist.bandcamp.com/music")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		page string
+		re   string // "album" or "release"
+		want []string
+	}{
+		{"albums", musicPage, "album", []string{
+			"https://artist.bandcamp.com/album/first",
+			"https://artist.bandcamp.com/album/second",
+			"https://artist.bandcamp.com/album/third",
+		}},
+		{"releases", musicPage, "release", []string{
+			"https://artist.bandcamp.com/album/first",
+			"https://artist.bandcamp.com/album/second",
+			"https://artist.bandcamp.com/track/sixth",
+			"https://artist.bandcamp.com/album/third",
+			"https://artist.bandcamp.com/track/fourth",
+		}},
+		{"empty", `<ol id="music-grid"></ol>`, "release", nil},
+	} {
+		re := albumPathRegexp
+		if tc.re == "release" {
+			re = releasePathRegexp
+		}
+		if got, err := parseArtistURLs([]byte(tc.page), base, re); err != nil {
+			t.Errorf("parseArtistURLs(%v) failed: %v", tc.name, err)
+		} else if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseArtistURLs(%v) = %q; want %q", tc.name, got, tc.want)
+		}
+	}
+
+	bad := `<ol id="music-grid" data-client-items="[{&quot;page_url&quot;:"></ol>`
+	if got, err := parseArtistURLs([]byte(bad), base, releasePathRegexp); err == nil {
+		t.Errorf("parseArtistURLs with bad client items = %q; want error", got)
+	}
+}
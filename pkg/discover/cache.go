@@ -0,0 +1,172 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cacheExt is the extension used for files in a Cache's directory.
+const cacheExt = ".cache"
+
+// cacheMetaExt is the extension used for files containing the validators
+// of cached responses.
+const cacheMetaExt = ".meta"
+
+// Cache stores API responses on disk.
+type Cache struct {
+	// Dir is the directory where responses are stored.
+	// It is created if it doesn't already exist.
+	Dir string
+	// TTL is the maximum age of responses that will be used.
+	TTL time.Duration
+}
+
+// DefaultCacheDir returns the default directory for a Cache, e.g.
+// ~/.cache/bandcamp-discover on Linux.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "bandcamp-discover"), nil
+}
+
+// path returns the path of the file used to cache the response for key.
+func (c *Cache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:])+cacheExt)
+}
+
+// metaPath returns the path of the file containing the validators of the
+// response cached for key.
+func (c *Cache) metaPath(key string) string {
+	return strings.TrimSuffix(c.path(key), cacheExt) + cacheMetaExt
+}
+
+// validators contains headers from a cached response that can be used to send
+// a conditional request for the same URL.
+type validators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func (v *validators) empty() bool { return v.ETag == "" && v.LastModified == "" }
+
+// get returns the cached data for key if it is present and younger than c.TTL.
+func (c *Cache) get(key string, now time.Time) ([]byte, bool) {
+	p := c.path(key)
+	fi, err := os.Stat(p)
+	if err != nil || now.Sub(fi.ModTime()) > c.TTL {
+		return nil, false
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// getStale returns the cached data for key regardless of its age, along with
+// the response's validators. false is returned if data isn't cached or if the
+// response didn't include validators.
+func (c *Cache) getStale(key string) ([]byte, validators, bool) {
+	var v validators
+	mb, err := os.ReadFile(c.metaPath(key))
+	if err != nil || json.Unmarshal(mb, &v) != nil || v.empty() {
+		return nil, v, false
+	}
+	b, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, v, false
+	}
+	return b, v, true
+}
+
+// touch marks the response cached for key as fresh as of now, e.g. after the
+// server has reported that it hasn't changed.
+func (c *Cache) touch(key string, now time.Time) error {
+	if err := os.Chtimes(c.metaPath(key), now, now); err != nil {
+		return err
+	}
+	return os.Chtimes(c.path(key), now, now)
+}
+
+// put saves data as the response for key along with its validators.
+func (c *Cache) put(key string, data []byte, v validators) error {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+	// Remove old validators first so they're never paired with newer data.
+	if err := os.Remove(c.metaPath(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := c.writeFile(c.path(key), data); err != nil {
+		return err
+	}
+	if v.empty() {
+		return nil
+	}
+	mb, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writeFile(c.metaPath(key), mb)
+}
+
+// writeFile atomically writes data to p within c.Dir.
+func (c *Cache) writeFile(p string, data []byte) error {
+	// Write to a temp file and rename it to avoid leaving partial files.
+	f, err := os.CreateTemp(c.Dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// Clean deletes cached responses in c.Dir that are older than c.TTL.
+// It returns the number of deleted files and the number of bytes freed.
+func (c *Cache) Clean(now time.Time) (removed int, freed int64, err error) {
+	err = filepath.WalkDir(c.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == c.Dir {
+				return filepath.SkipDir // nothing has been cached
+			}
+			return err
+		}
+		if d.IsDir() || !(strings.HasSuffix(p, cacheExt) || strings.HasSuffix(p, cacheMetaExt)) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if now.Sub(fi.ModTime()) <= c.TTL {
+			return nil
+		}
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+		removed++
+		freed += fi.Size()
+		return nil
+	})
+	return removed, freed, err
+}
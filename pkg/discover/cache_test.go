@@ -0,0 +1,202 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache_GetPut(t *testing.T) {
+	const ttl = time.Hour
+	c := Cache{Dir: filepath.Join(t.TempDir(), "cache"), TTL: ttl} // created by put
+
+	const key = "https://example.org/a"
+	if b, ok := c.get(key, time.Now()); ok {
+		t.Errorf("get(%q) on empty cache = %q", key, b)
+	}
+	if err := c.put(key, []byte("first"), validators{}); err != nil {
+		t.Fatalf("put(%q) failed: %v", key, err)
+	}
+	if err := c.put(key, []byte("second"), validators{}); err != nil {
+		t.Fatalf("put(%q) failed: %v", key, err)
+	}
+	const other = "https://example.org/b"
+	if err := c.put(other, []byte("other"), validators{}); err != nil {
+		t.Fatalf("put(%q) failed: %v", other, err)
+	}
+
+	now := time.Now()
+	for _, tc := range []struct {
+		key  string
+		now  time.Time
+		want string // empty if not cached
+	}{
+		{key, now, "second"},
+		{other, now, "other"},
+		{key, now.Add(ttl - time.Minute), "second"},
+		{key, now.Add(ttl + time.Minute), ""}, // expired
+		{"https://example.org/c", now, ""},
+	} {
+		b, ok := c.get(tc.key, tc.now)
+		if tc.want == "" && ok {
+			t.Errorf("get(%q, %v) = %q; want miss", tc.key, tc.now, b)
+		} else if tc.want != "" && (!ok || string(b) != tc.want) {
+			t.Errorf("get(%q, %v) = %q, %v; want %q", tc.key, tc.now, b, ok, tc.want)
+		}
+	}
+
+	// Responses without validators can't be revalidated.
+	if b, _, ok := c.getStale(key); ok {
+		t.Errorf("getStale(%q) = %q for response without validators", key, b)
+	}
+}
+
+func TestClient_CacheRevalidate(t *testing.T) {
+	const (
+		etag    = `"v1"`
+		lastMod = "Mon, 02 Jan 2023 03:04:05 GMT"
+	)
+	var reqs, notModified int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&reqs, 1)
+		if r.Header.Get("If-None-Match") == etag && r.Header.Get("If-Modified-Since") == lastMod {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastMod)
+		writePage(t, w, 1, "a")
+	}))
+	defer srv.Close()
+
+	const ttl = time.Hour
+	client := newTestClient(srv)
+	client.Cache = &Cache{Dir: t.TempDir(), TTL: ttl}
+	want := []string{testURL("a")}
+	fetch := func() {
+		t.Helper()
+		if got, err := client.Fetch(context.Background(), testQuery); err != nil {
+			t.Fatal("Fetch failed:", err)
+		} else if urls := resultURLs(got); !reflect.DeepEqual(urls, want) {
+			t.Fatalf("Fetch returned %q; want %q", urls, want)
+		}
+	}
+
+	fetch() // populate the cache
+	key := client.getWebURL(testQuery, 0)
+	if _, v, ok := client.Cache.getStale(key); !ok || v.ETag != etag || v.LastModified != lastMod {
+		t.Fatalf("getStale(%q) returned validators %+v, %v", key, v, ok)
+	}
+
+	// Expire the cached response.
+	old := time.Now().Add(-2 * ttl)
+	for _, p := range []string{client.Cache.path(key), client.Cache.metaPath(key)} {
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fetch() // the stale body should be returned after a 304 response
+	if n := atomic.LoadInt32(&notModified); n != 1 {
+		t.Errorf("Server sent %d 304 response(s); want 1", n)
+	}
+	if hits, misses, reval := client.CacheStats(); hits != 0 || misses != 2 || reval != 1 {
+		t.Errorf("CacheStats() = %d, %d, %d; want 0, 2, 1", hits, misses, reval)
+	}
+
+	// The revalidated entry should be fresh again.
+	if _, ok := client.Cache.get(key, time.Now()); !ok {
+		t.Errorf("get(%q) missed after revalidation", key)
+	}
+	fetch()
+	if n := atomic.LoadInt32(&reqs); n != 2 {
+		t.Errorf("Server received %d requests; want 2", n)
+	}
+	if hits, _, _ := client.CacheStats(); hits != 1 {
+		t.Errorf("CacheStats() reported %d hit(s); want 1", hits)
+	}
+}
+
+func TestCache_Clean(t *testing.T) {
+	const ttl = time.Hour
+	c := Cache{Dir: t.TempDir(), TTL: ttl}
+	now := time.Now()
+	old := now.Add(-2 * ttl)
+
+	// setAge sets the modification times of the files for key to mtime.
+	setAge := func(key string, mtime time.Time) {
+		for _, p := range []string{c.path(key), c.metaPath(key)} {
+			if err := os.Chtimes(p, mtime, mtime); err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, e := range []struct {
+		key   string
+		data  string
+		v     validators
+		mtime time.Time
+	}{
+		{"old", "12345", validators{}, old},
+		{"old-meta", "1234567890", validators{ETag: `"x"`}, old},
+		{"new", "abc", validators{ETag: `"y"`}, now},
+	} {
+		if err := c.put(e.key, []byte(e.data), e.v); err != nil {
+			t.Fatalf("put(%q) failed: %v", e.key, err)
+		}
+		setAge(e.key, e.mtime)
+	}
+	// Unrelated files should be left alone.
+	other := filepath.Join(c.Dir, "genres.json")
+	if err := os.WriteFile(other, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(other, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	metaSize := func(key string) int64 {
+		fi, err := os.Stat(c.metaPath(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Size()
+	}
+	wantFreed := 5 + 10 + metaSize("old-meta")
+	removed, freed, err := c.Clean(now)
+	if err != nil {
+		t.Fatal("Clean failed:", err)
+	}
+	if removed != 3 || freed != wantFreed {
+		t.Errorf("Clean(now) = %d, %d; want 3, %d", removed, freed, wantFreed)
+	}
+	for _, key := range []string{"old", "old-meta"} {
+		if _, err := os.Stat(c.path(key)); !os.IsNotExist(err) {
+			t.Errorf("%q still cached after Clean", key)
+		}
+	}
+	if b, ok := c.get("new", now); !ok || string(b) != "abc" {
+		t.Errorf(`get("new") after Clean = %q, %v; want "abc", true`, b, ok)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Error("Unrelated file removed by Clean:", err)
+	}
+
+	// Cleaning again or cleaning a nonexistent dir should be a no-op.
+	if removed, freed, err := c.Clean(now); err != nil || removed != 0 || freed != 0 {
+		t.Errorf("Second Clean(now) = %d, %d, %v; want 0, 0, nil", removed, freed, err)
+	}
+	missing := Cache{Dir: filepath.Join(c.Dir, "missing"), TTL: ttl}
+	if removed, freed, err := missing.Clean(now); err != nil || removed != 0 || freed != 0 {
+		t.Errorf("Clean(now) on missing dir = %d, %d, %v; want 0, 0, nil", removed, freed, err)
+	}
+}
@@ -0,0 +1,573 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+// Package discover queries the Bandcamp Discover API.
+//
+// A minimal program that prints the URLs of the top electronic albums looks
+// like this:
+//
+//	var client discover.Client
+//	results, err := client.Fetch(ctx, discover.Query{
+//		Genre:   "electronic",
+//		Ranking: "top",
+//		Format:  "all",
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	for _, r := range results {
+//		fmt.Println(r.URL)
+//	}
+//
+// Known genres and subgenres are listed in Genres.
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBaseURL is the default value of Client.BaseURL.
+	DefaultBaseURL = "https://bandcamp.com"
+	// DefaultAPIVersion is the default value of Client.APIVersion.
+	DefaultAPIVersion = 3
+	// DefaultUserAgent is the default value of Client.UserAgent.
+	DefaultUserAgent = "bandcamp-discover (+https://codeberg.org/derat/bandcamp-discover)"
+)
+
+// Query describes a Discover API query.
+type Query struct {
+	Genre    string // e.g. "electronic", or "all"
+	Subgenre string // e.g. "techno", or empty for all subgenres
+	Ranking  string // "top", "new", or "rec"
+	Format   string // "all", "digital", "vinyl", "cd", or "cassette"
+	Page     int    // first page to fetch, starting at 0
+	Pages    int    // number of pages to fetch; 0 is treated as 1 and AllPages fetches all
+	Limit    int    // maximum number of results to return, or 0 for no limit
+	Type     string // "album", "track", or "all"; empty is treated as "album"
+	Location int64  // GeoNames ID from SearchLocations, or 0 for anywhere
+	Week     int    // week relative to the current one, e.g. -1 for last week
+
+	// StrictItemType, if non-empty, causes an *ItemTypeError to be returned
+	// if the API returns any items with a different type (e.g. "a" for album).
+	// By default, items that aren't albums are silently skipped.
+	StrictItemType string
+}
+
+// Validate returns an error if q's fields contain invalid values.
+// Genres aren't checked against Genres since the list may be out of date.
+func (q *Query) Validate() error {
+	switch {
+	case q.Genre == "":
+		return errors.New("empty genre")
+	case !contains(Rankings, q.Ranking):
+		return fmt.Errorf("invalid ranking %q (valid: %v)", q.Ranking, strings.Join(Rankings, ", "))
+	case q.Format != "all" && !contains(Formats, q.Format):
+		return fmt.Errorf("invalid format %q (valid: all, %v)", q.Format, strings.Join(Formats, ", "))
+	case q.Page < 0:
+		return fmt.Errorf("invalid page %d", q.Page)
+	case q.Pages < 0 && q.Pages != AllPages:
+		return fmt.Errorf("invalid page count %d", q.Pages)
+	case q.Location < 0:
+		return fmt.Errorf("invalid location %d", q.Location)
+	case q.Week > 0:
+		return fmt.Errorf("invalid week %d (must be 0 or negative)", q.Week)
+	case q.Limit < 0:
+		return fmt.Errorf("invalid limit %d", q.Limit)
+	case q.Type != "" && q.Type != "all" && !contains(Types, q.Type):
+		return fmt.Errorf("invalid type %q (valid: all, %v)", q.Type, strings.Join(Types, ", "))
+	}
+	return nil
+}
+
+// Types lists the specific result types accepted by Query.Type.
+var Types = []string{"album", "track"}
+
+// itemTypes maps from item_type values in API responses to result types.
+var itemTypes = map[string]string{"a": "album", "t": "track"}
+
+// AllPages can be used as Query.Pages to fetch pages until no items remain.
+const AllPages = -1
+
+// ItemTypeError is returned if Query.StrictItemType is set and the API
+// returns items with other types.
+type ItemTypeError struct {
+	Want string   // expected type
+	Got  []string // sorted unexpected types
+}
+
+func (e *ItemTypeError) Error() string {
+	return fmt.Sprintf("got unexpected item type(s) %q; want %q", e.Got, e.Want)
+}
+
+// Result describes an album or track returned by the API.
+type Result struct {
+	Artist string `json:"artist"`
+	Album  string `json:"album"` // album or track title
+	URL    string `json:"url"`
+	Type   string `json:"type,omitempty"` // "album" or "track"
+	ArtID  int64  `json:"art_id,omitempty"`
+	BandID int64  `json:"band_id,omitempty"`
+	ItemID int64  `json:"item_id,omitempty"` // album or track (tralbum) ID
+
+	// Genre, Subgenre, and Ranking are copied from the Query that produced the result.
+	// For TagQuery results, Genre contains the comma-separated tags and Ranking
+	// contains the sort order.
+	Genre    string `json:"genre,omitempty"`
+	Subgenre string `json:"subgenre,omitempty"`
+	Ranking  string `json:"ranking,omitempty"`
+	// Rank is the 1-based position of the result within the query's results.
+	// Skipped items are not counted.
+	Rank int `json:"rank,omitempty"`
+
+	// Details is nil unless filled by the caller via Client.AlbumDetails.
+	Details *AlbumDetails `json:"details,omitempty"`
+}
+
+// ArtURL returns the URL of r's cover art, or an empty string if r has no art.
+func (r *Result) ArtURL() string {
+	if r.ArtID == 0 {
+		return ""
+	}
+	// "_10" selects the full-size image; "_16" would be 700x700.
+	return fmt.Sprintf("https://f4.bcbits.com/img/a%010d_10.jpg", r.ArtID)
+}
+
+// MarshalJSON encodes r as JSON, adding an "art_url" property with the URL
+// returned by ArtURL.
+func (r Result) MarshalJSON() ([]byte, error) {
+	type result Result // avoid recursing into MarshalJSON
+	return json.Marshal(struct {
+		result
+		ArtURL string `json:"art_url,omitempty"`
+	}{result(r), r.ArtURL()})
+}
+
+// Client sends queries to the Discover API and fetches related Bandcamp pages.
+// The zero value is ready for use. A Client's methods may be called
+// concurrently, but its exported fields should not be modified after its first
+// use.
+type Client struct {
+	// HTTPClient is used to send requests. If nil, http.DefaultClient is used.
+	// Callers can supply their own client to set a timeout or use a custom
+	// transport. Note that http.DefaultClient has no timeout.
+	HTTPClient *http.Client
+	// BaseURL contains the scheme and host to which requests are sent,
+	// e.g. "https://bandcamp.com". If empty, DefaultBaseURL is used.
+	BaseURL string
+	// API is the Discover API to use, either GetWebAPI or DiscoverWebAPI.
+	// If empty, GetWebAPI is used.
+	API string
+	// APIVersion is the version of the Discover API to use, as it appears
+	// in "/api/discover/<version>/get_web". If 0, DefaultAPIVersion is used.
+	// It is ignored for DiscoverWebAPI.
+	APIVersion int
+	// UserAgent is sent in the User-Agent header of requests.
+	// If empty, DefaultUserAgent is used.
+	UserAgent string
+	// Limiter is used to pace requests. If nil, requests are not limited.
+	Limiter *Limiter
+	// Retries is the maximum number of times that a request will be retried
+	// after a transient failure. If the server responds with 429 Too Many
+	// Requests, its Retry-After header is honored, and a *RateLimitError is
+	// returned if no retries remain. Server (5xx) and network errors are
+	// retried with exponential backoff as described by RetryBackoff.
+	Retries int
+	// RetryBackoff is the approximate delay before the first retry after a
+	// server or network error. The delay doubles with each subsequent retry and
+	// is randomly reduced by up to half. If 0, DefaultRetryBackoff is used.
+	RetryBackoff time.Duration
+	// RetryBudget, if positive, limits the total time that the Client will
+	// spend waiting to retry requests. Once the budget would be exceeded,
+	// errors are returned immediately instead of being retried.
+	RetryBudget time.Duration
+	// SkipFunc, if non-nil, is called with a description of each item in
+	// the API's responses that is skipped and the reason it was skipped.
+	// It may be called concurrently.
+	SkipFunc func(item, reason string)
+	// Cache, if non-nil, is used to store API responses.
+	Cache *Cache
+	// Concurrency is the maximum number of Discover API pages that will be
+	// fetched simultaneously across all queries. Pages of a multi-page query
+	// are prefetched while earlier pages are being returned. If 0 or 1, pages
+	// are fetched one at a time.
+	Concurrency int
+
+	mu          sync.Mutex
+	pageSem     chan struct{} // limits simultaneous fetchPage calls; created by acquirePage
+	retryWait   time.Duration // total time spent waiting to retry requests
+	invalid     int           // number of skipped invalid items
+	cacheHits   int           // responses read from Cache
+	cacheMisses int           // responses not found in Cache
+
+	cacheRevalidated int // expired responses in Cache that were unchanged
+}
+
+// InvalidItems returns the number of items that c has skipped because they
+// were missing required fields.
+func (c *Client) InvalidItems() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.invalid
+}
+
+// RetryWait returns the total time that c has spent waiting to retry requests.
+func (c *Client) RetryWait() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.retryWait
+}
+
+// CacheStats returns the number of times that c found and didn't find
+// unexpired responses in c.Cache. revalidated is the number of misses for
+// which the server reported that the expired response was unchanged.
+func (c *Client) CacheStats() (hits, misses, revalidated int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cacheHits, c.cacheMisses, c.cacheRevalidated
+}
+
+// reserveRetryWait attempts to reserve d from c.RetryBudget and returns false
+// if the budget would be exceeded. Negative durations are treated as 0.
+func (c *Client) reserveRetryWait(d time.Duration) bool {
+	if d < 0 {
+		d = 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.RetryBudget > 0 && c.retryWait+d > c.RetryBudget {
+		return false
+	}
+	c.retryWait += d
+	return true
+}
+
+// httpClient returns c.HTTPClient if non-nil or http.DefaultClient otherwise.
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Fetch runs q and returns all of its results.
+func (c *Client) Fetch(ctx context.Context, q Query) ([]Result, error) {
+	rch, ech := c.Stream(ctx, q)
+	var res []Result
+	for r := range rch {
+		res = append(res, r)
+	}
+	return res, <-ech
+}
+
+// Stream runs q and sends its results to the returned Result channel as each
+// page is received. The Result channel is closed after all pages have been
+// fetched, an error has occurred, or ctx has been cancelled. A single value
+// (nil on success) is then sent to the error channel. Callers must drain the
+// Result channel or cancel ctx.
+func (c *Client) Stream(ctx context.Context, q Query) (<-chan Result, <-chan error) {
+	rch := make(chan Result)
+	ech := make(chan error, 1)
+	go func() {
+		defer close(ech)
+		ech <- c.stream(ctx, q, rch)
+	}()
+	return rch, ech
+}
+
+// stream implements Stream, sending results to rch and closing it when done.
+func (c *Client) stream(ctx context.Context, q Query, rch chan<- Result) error {
+	defer close(rch)
+	if err := q.Validate(); err != nil {
+		return err
+	}
+	switch c.API {
+	case "", GetWebAPI:
+	case DiscoverWebAPI:
+		return c.streamDiscoverWeb(ctx, q, rch)
+	default:
+		return fmt.Errorf("unknown API %q", c.API)
+	}
+	pages := q.Pages
+	if pages == 0 {
+		pages = 1
+	}
+	conc := c.Concurrency
+	if conc < 1 {
+		conc = 1
+	}
+	// Outstanding requests for later pages are cancelled on return.
+	pctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type pageResult struct {
+		res  []Result
+		info pageInfo
+		err  error
+	}
+	var pending []chan pageResult // fetches for pages following p, in order
+	next := q.Page                // next page to request
+
+	var perPage int // max items seen in a page
+	var total int   // total items reported by the API, or 0 if unknown
+	var sent int    // number of results sent to rch
+	for p := q.Page; pages == AllPages || p < q.Page+pages; p++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for len(pending) < conc && (pages == AllPages || next < q.Page+pages) &&
+			(total == 0 || perPage == 0 || next*perPage < total) {
+			ch := make(chan pageResult, 1)
+			go func(page int) {
+				var pr pageResult
+				pr.res, pr.info, pr.err = c.fetchPageLimited(pctx, q, page)
+				ch <- pr
+			}(next)
+			pending = append(pending, ch)
+			next++
+		}
+		pr := <-pending[0]
+		pending = pending[1:]
+		res, info, err := pr.res, pr.info, pr.err
+		if err != nil {
+			return err
+		}
+		if info.total > 0 {
+			total = info.total
+		}
+		if info.items > perPage {
+			perPage = info.items
+		}
+		for _, r := range res {
+			sent++
+			r.Rank = sent
+			select {
+			case rch <- r:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if q.Limit > 0 && sent >= q.Limit {
+				return nil // don't fetch additional pages
+			}
+		}
+		// Check the raw number of items in the response rather than the
+		// number of results: a page containing only skipped items (or items
+		// that the caller will discard as duplicates) doesn't mean that
+		// there are no more pages.
+		if info.items == 0 {
+			break // no more pages
+		}
+		// The API doesn't return a pagination cursor; pages are selected via
+		// the "p" parameter. Responses may report the total number of items,
+		// though, which lets us avoid requesting a trailing empty page.
+		if info.total > 0 && (p+1)*perPage >= info.total {
+			break
+		}
+	}
+	return nil
+}
+
+// baseURL returns c.BaseURL if non-empty or DefaultBaseURL otherwise.
+func (c *Client) baseURL() string {
+	if c.BaseURL != "" {
+		return strings.TrimSuffix(c.BaseURL, "/")
+	}
+	return DefaultBaseURL
+}
+
+// QueryURL returns the API URL used to fetch the specified page of q's
+// results. An error is returned for DiscoverWebAPI, which uses POST requests
+// with cursors from earlier pages rather than GET requests with page numbers.
+func (c *Client) QueryURL(q Query, page int) (string, error) {
+	if c.API == DiscoverWebAPI {
+		return "", errors.New("query URLs aren't supported by " + DiscoverWebAPI)
+	}
+	return c.getWebURL(q, page), nil
+}
+
+// getWebURL returns the get_web URL used to fetch the specified page of q's
+// results.
+func (c *Client) getWebURL(q Query, page int) string {
+	ver := c.APIVersion
+	if ver == 0 {
+		ver = DefaultAPIVersion
+	}
+	vals := url.Values{
+		"g":  {q.Genre},
+		"s":  {q.Ranking},
+		"f":  {q.Format},
+		"p":  {strconv.Itoa(page)},
+		"gn": {strconv.FormatInt(q.Location, 10)},
+		"w":  {strconv.Itoa(q.Week)},
+	}
+	if q.Subgenre != "" {
+		vals.Set("t", q.Subgenre)
+	}
+	return c.baseURL() + "/api/discover/" + strconv.Itoa(ver) + "/get_web?" + vals.Encode()
+}
+
+// pageInfo contains information about a page of API results.
+type pageInfo struct {
+	items int // number of items in the page, including skipped ones
+	total int // total number of items across all pages, or 0 if unknown
+}
+
+// fetchPageLimited calls fetchPage after waiting until fewer than
+// c.Concurrency other calls are in progress.
+func (c *Client) fetchPageLimited(ctx context.Context, q Query, page int) ([]Result, pageInfo, error) {
+	c.mu.Lock()
+	if c.pageSem == nil {
+		n := c.Concurrency
+		if n < 1 {
+			n = 1
+		}
+		c.pageSem = make(chan struct{}, n)
+	}
+	sem := c.pageSem
+	c.mu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		defer func() { <-sem }()
+	case <-ctx.Done():
+		return nil, pageInfo{}, ctx.Err()
+	}
+	return c.fetchPage(ctx, q, page)
+}
+
+// fetchPage fetches the specified page of q's results.
+func (c *Client) fetchPage(ctx context.Context, q Query, page int) (res []Result, info pageInfo, err error) {
+	u := c.getWebURL(q, page)
+	b, err := c.getCached(ctx, u)
+	if err != nil {
+		return nil, info, err
+	}
+
+	var data struct {
+		Items      []apiItem `json:"items"`
+		TotalCount int       `json:"total_count"`
+	}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, info, fmt.Errorf("%v: bad JSON (%v): %q", u, err, snippet(b))
+	}
+
+	want := q.Type
+	if want == "" {
+		want = "album"
+	}
+	var badTypes []string
+	var invalid int
+	for _, item := range data.Items {
+		if !item.valid() {
+			invalid++
+			c.skip(&item, "missing required fields")
+			continue
+		}
+		uh := item.URLHints
+		if q.StrictItemType != "" && uh.ItemType != q.StrictItemType {
+			if !contains(badTypes, uh.ItemType) {
+				badTypes = append(badTypes, uh.ItemType)
+			}
+			continue
+		}
+		typ, ok := itemTypes[uh.ItemType]
+		if !ok {
+			c.skip(&item, fmt.Sprintf("unsupported item type %q", uh.ItemType))
+			continue
+		}
+		if typ != want && want != "all" {
+			c.skip(&item, typ+" excluded by query type")
+			continue
+		}
+		res = append(res, Result{
+			Artist:   item.SecondaryText,
+			Album:    item.PrimaryText,
+			URL:      fmt.Sprintf("https://%v/%v/%v", uh.host(), typ, uh.Slug),
+			Type:     typ,
+			ArtID:    item.ArtID,
+			BandID:   item.BandID,
+			ItemID:   item.itemID(),
+			Genre:    q.Genre,
+			Subgenre: q.Subgenre,
+			Ranking:  q.Ranking,
+		})
+	}
+	c.mu.Lock()
+	c.invalid += invalid
+	c.mu.Unlock()
+
+	if len(badTypes) > 0 {
+		sort.Strings(badTypes)
+		return nil, info, &ItemTypeError{Want: q.StrictItemType, Got: badTypes}
+	}
+	return res, pageInfo{items: len(data.Items), total: data.TotalCount}, nil
+}
+
+// skip calls c.SkipFunc (if non-nil) for item.
+func (c *Client) skip(item *apiItem, reason string) {
+	if c.SkipFunc != nil {
+		c.SkipFunc(fmt.Sprintf("%q by %q", item.PrimaryText, item.SecondaryText), reason)
+	}
+}
+
+// apiItem is an item in a Discover API response.
+type apiItem struct {
+	PrimaryText   string    `json:"primary_text"`   // album
+	SecondaryText string    `json:"secondary_text"` // artist
+	ArtID         int64     `json:"art_id"`
+	BandID        int64     `json:"band_id"`
+	ID            int64     `json:"id"`
+	TralbumID     int64     `json:"tralbum_id"` // not always present; ID is used instead
+	URLHints      *urlHints `json:"url_hints"`
+}
+
+// urlHints contains an apiItem's URL components.
+type urlHints struct {
+	Subdomain    string `json:"subdomain"`     // <subdomain>.bandcamp.com
+	CustomDomain string `json:"custom_domain"` // used instead of Subdomain if non-empty
+	Slug         string `json:"slug"`          // /album/<slug> or /track/<slug>
+	ItemType     string `json:"item_type"`     // "a" for album, "t" for track
+}
+
+// host returns the hostname of the artist's site.
+func (uh *urlHints) host() string {
+	if uh.CustomDomain != "" {
+		return uh.CustomDomain
+	}
+	return uh.Subdomain + ".bandcamp.com"
+}
+
+// itemID returns item's tralbum ID.
+func (item *apiItem) itemID() int64 {
+	if item.TralbumID != 0 {
+		return item.TralbumID
+	}
+	return item.ID
+}
+
+// valid returns true if item has the fields needed to construct a Result.
+func (item *apiItem) valid() bool {
+	uh := item.URLHints
+	return item.PrimaryText != "" && uh != nil &&
+		(uh.Subdomain != "" || uh.CustomDomain != "") && uh.Slug != ""
+}
+
+// contains returns true if vals contains v.
+func contains(vals []string, v string) bool {
+	for _, s := range vals {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
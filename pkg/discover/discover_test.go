@@ -0,0 +1,561 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testItem returns an apiItem describing an album with the supplied slug.
+func testItem(slug string) apiItem {
+	return apiItem{
+		PrimaryText:   "Album " + slug,
+		SecondaryText: "Artist " + slug,
+		ID:            1,
+		URLHints:      &urlHints{Subdomain: "artist", Slug: slug, ItemType: "a"},
+	}
+}
+
+// testURL returns the URL of the Result created from testItem(slug).
+func testURL(slug string) string {
+	return "https://artist.bandcamp.com/album/" + slug
+}
+
+// writePage writes a get_web response containing albums with the supplied
+// slugs to w.
+func writePage(t *testing.T, w http.ResponseWriter, total int, slugs ...string) {
+	data := struct {
+		Items      []apiItem `json:"items"`
+		TotalCount int       `json:"total_count"`
+	}{Items: []apiItem{}, TotalCount: total}
+	for _, s := range slugs {
+		data.Items = append(data.Items, testItem(s))
+	}
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		t.Error("Failed writing page:", err)
+	}
+}
+
+// pageSlugs returns the slugs of the albums returned in the specified page
+// by servers that return perPage albums per page.
+func pageSlugs(page, perPage int) []string {
+	var slugs []string
+	for i := 0; i < perPage; i++ {
+		slugs = append(slugs, fmt.Sprintf("p%d-%d", page, i))
+	}
+	return slugs
+}
+
+// pageNum returns the page number requested by r.
+func pageNum(t *testing.T, r *http.Request) int {
+	p, err := strconv.Atoi(r.URL.Query().Get("p"))
+	if err != nil {
+		t.Errorf("Bad page in %v: %v", r.URL, err)
+	}
+	return p
+}
+
+// newTestClient returns a Client that sends requests to srv.
+func newTestClient(srv *httptest.Server) *Client {
+	return &Client{HTTPClient: srv.Client(), BaseURL: srv.URL}
+}
+
+// resultURLs returns the URLs of rs.
+func resultURLs(rs []Result) []string {
+	var urls []string
+	for _, r := range rs {
+		urls = append(urls, r.URL)
+	}
+	return urls
+}
+
+var testQuery = Query{Genre: "all", Ranking: "top", Format: "all"}
+
+func TestStream_Order(t *testing.T) {
+	const (
+		pages   = 3
+		perPage = 2
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writePage(t, w, pages*perPage, pageSlugs(pageNum(t, r), perPage)...)
+	}))
+	defer srv.Close()
+
+	q := testQuery
+	q.Pages = AllPages
+	rch, ech := newTestClient(srv).Stream(context.Background(), q)
+	var got []Result
+	for r := range rch {
+		got = append(got, r)
+	}
+	if err := <-ech; err != nil {
+		t.Fatal("Stream failed:", err)
+	}
+	if _, ok := <-ech; ok {
+		t.Error("Error channel not closed after sending error")
+	}
+
+	var want []string
+	for p := 0; p < pages; p++ {
+		for _, s := range pageSlugs(p, perPage) {
+			want = append(want, testURL(s))
+		}
+	}
+	if urls := resultURLs(got); !reflect.DeepEqual(urls, want) {
+		t.Errorf("Stream returned %q; want %q", urls, want)
+	}
+	for i, r := range got {
+		if r.Rank != i+1 {
+			t.Errorf("Result %d (%v) has rank %d", i, r.URL, r.Rank)
+		}
+	}
+}
+
+func TestStream_Limit(t *testing.T) {
+	var reqs int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&reqs, 1)
+		writePage(t, w, 0, pageSlugs(pageNum(t, r), 2)...)
+	}))
+	defer srv.Close()
+
+	q := testQuery
+	q.Pages = AllPages
+	q.Limit = 3
+	got, err := newTestClient(srv).Fetch(context.Background(), q)
+	if err != nil {
+		t.Fatal("Fetch failed:", err)
+	}
+	want := []string{testURL("p0-0"), testURL("p0-1"), testURL("p1-0")}
+	if urls := resultURLs(got); !reflect.DeepEqual(urls, want) {
+		t.Errorf("Fetch returned %q; want %q", urls, want)
+	}
+	if n := atomic.LoadInt32(&reqs); n != 2 {
+		t.Errorf("Fetch sent %d requests; want 2", n)
+	}
+}
+
+func TestStream_Cancel(t *testing.T) {
+	start := runtime.NumGoroutine()
+
+	// Return an endless series of pages.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writePage(t, w, 0, pageSlugs(pageNum(t, r), 2)...)
+	}))
+	client := newTestClient(srv)
+	client.HTTPClient = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	client.Concurrency = 3
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q := testQuery
+	q.Pages = AllPages
+	rch, ech := client.Stream(ctx, q)
+	if _, ok := <-rch; !ok {
+		t.Fatal("Result channel closed before first result")
+	}
+
+	// Stop reading results. Stream should notice the cancellation while it's
+	// blocked sending the next result.
+	cancel()
+	select {
+	case err := <-ech:
+		if err != context.Canceled {
+			t.Errorf("Stream returned %v; want %v", err, context.Canceled)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Stream didn't return after cancellation")
+	}
+	if _, ok := <-rch; ok {
+		t.Error("Result channel not closed after cancellation")
+	}
+
+	// All of the goroutines started by Stream should exit.
+	srv.Close()
+	deadline := time.Now().Add(10 * time.Second)
+	for runtime.NumGoroutine() > start {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			t.Fatalf("Have %d goroutine(s) after cancellation; want at most %d:\n%s",
+				runtime.NumGoroutine(), start, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStream_PrefetchOrder(t *testing.T) {
+	const (
+		pages   = 5
+		perPage = 2
+		conc    = 3
+	)
+	var inFlight, maxInFlight int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		// Make earlier pages slower so that responses arrive out of order.
+		p := pageNum(t, r)
+		time.Sleep(time.Duration(pages-p) * 20 * time.Millisecond)
+		writePage(t, w, pages*perPage, pageSlugs(p, perPage)...)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(srv)
+	client.Concurrency = conc
+	q := testQuery
+	q.Pages = AllPages
+	got, err := client.Fetch(context.Background(), q)
+	if err != nil {
+		t.Fatal("Fetch failed:", err)
+	}
+	var want []string
+	for p := 0; p < pages; p++ {
+		for _, s := range pageSlugs(p, perPage) {
+			want = append(want, testURL(s))
+		}
+	}
+	if urls := resultURLs(got); !reflect.DeepEqual(urls, want) {
+		t.Errorf("Fetch returned %q; want %q", urls, want)
+	}
+	if n := atomic.LoadInt32(&maxInFlight); n < 2 || n > conc {
+		t.Errorf("Fetch sent up to %d simultaneous requests; want 2 to %d", n, conc)
+	}
+}
+
+func TestStream_PrefetchError(t *testing.T) {
+	const (
+		perPage = 2
+		badPage = 2
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := pageNum(t, r)
+		if p == badPage {
+			// Fail immediately, before the earlier pages have been returned.
+			http.Error(w, "broken", http.StatusNotFound)
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		writePage(t, w, 0, pageSlugs(p, perPage)...)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(srv)
+	client.Concurrency = 3
+	q := testQuery
+	q.Pages = AllPages
+	got, err := client.Fetch(context.Background(), q)
+	var se *StatusError
+	if !errors.As(err, &se) || se.Code != http.StatusNotFound {
+		t.Fatalf("Fetch returned error %v; want %v StatusError", err, http.StatusNotFound)
+	}
+	// The pages before the failed one should still be returned.
+	var want []string
+	for p := 0; p < badPage; p++ {
+		for _, s := range pageSlugs(p, perPage) {
+			want = append(want, testURL(s))
+		}
+	}
+	if urls := resultURLs(got); !reflect.DeepEqual(urls, want) {
+		t.Errorf("Fetch returned %q; want %q", urls, want)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+	for _, tc := range []struct {
+		val  string
+		want time.Time
+	}{
+		{"", time.Time{}},
+		{"0", now},
+		{"120", now.Add(2 * time.Minute)},
+		{" 5 ", now.Add(5 * time.Second)},
+		{"-1", time.Time{}},
+		{"1.5", time.Time{}},
+		{"Wed, 05 Apr 2023 06:10:00 GMT", time.Date(2023, 4, 5, 6, 10, 0, 0, time.UTC)},
+		{"Wednesday, 05-Apr-23 06:10:00 GMT", time.Date(2023, 4, 5, 6, 10, 0, 0, time.UTC)},
+		{"soon", time.Time{}},
+	} {
+		if got := parseRetryAfter(tc.val, now); !got.Equal(tc.want) {
+			t.Errorf("parseRetryAfter(%q) = %v; want %v", tc.val, got, tc.want)
+		}
+	}
+}
+
+func TestFetch_RetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		desc       string
+		retryAfter func() string
+		min, max   time.Duration // expected wait
+	}{
+		{"seconds", func() string { return "1" }, time.Second, time.Second},
+		{"date", func() string {
+			// HTTP dates have one-second granularity.
+			return time.Now().Add(2 * time.Second).UTC().Format(http.TimeFormat)
+		}, 500 * time.Millisecond, 2 * time.Second},
+		{"past date", func() string {
+			// This shouldn't reduce the time counted against RetryBudget.
+			return time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+		}, 0, 0},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var reqs int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&reqs, 1) == 1 {
+					w.Header().Set("Retry-After", tc.retryAfter())
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				writePage(t, w, 1, "a")
+			}))
+			defer srv.Close()
+
+			client := newTestClient(srv)
+			client.Retries = 1
+			start := time.Now()
+			got, err := client.Fetch(context.Background(), testQuery)
+			if err != nil {
+				t.Fatal("Fetch failed:", err)
+			}
+			if urls, want := resultURLs(got), []string{testURL("a")}; !reflect.DeepEqual(urls, want) {
+				t.Errorf("Fetch returned %q; want %q", urls, want)
+			}
+			if n := atomic.LoadInt32(&reqs); n != 2 {
+				t.Errorf("Fetch sent %d requests; want 2", n)
+			}
+			if wait := client.RetryWait(); wait < tc.min || wait > tc.max {
+				t.Errorf("RetryWait() = %v; want %v to %v", wait, tc.min, tc.max)
+			}
+			if elapsed := time.Since(start); elapsed < tc.min {
+				t.Errorf("Fetch took %v; want at least %v", elapsed, tc.min)
+			}
+		})
+	}
+}
+
+func TestFetch_RateLimitError(t *testing.T) {
+	for _, tc := range []struct {
+		retryAfter string
+		retries    int
+		zeroUntil  bool
+	}{
+		{"0", 2, false},
+		{"", 0, true}, // no retries, so the default delay isn't waited
+	} {
+		var reqs int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&reqs, 1)
+			if tc.retryAfter != "" {
+				w.Header().Set("Retry-After", tc.retryAfter)
+			}
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+
+		client := newTestClient(srv)
+		client.Retries = tc.retries
+		_, err := client.Fetch(context.Background(), testQuery)
+		var rle *RateLimitError
+		if !errors.As(err, &rle) {
+			t.Errorf("Fetch with Retry-After %q returned %v; want RateLimitError", tc.retryAfter, err)
+		} else {
+			if want := client.getWebURL(testQuery, 0); rle.URL != want {
+				t.Errorf("Fetch with Retry-After %q returned error for %v; want %v", tc.retryAfter, rle.URL, want)
+			}
+			if rle.Until.IsZero() != tc.zeroUntil {
+				t.Errorf("Fetch with Retry-After %q returned error with Until %v", tc.retryAfter, rle.Until)
+			}
+		}
+		if n, want := atomic.LoadInt32(&reqs), int32(tc.retries+1); n != want {
+			t.Errorf("Fetch with Retry-After %q sent %d requests; want %d", tc.retryAfter, n, want)
+		}
+		srv.Close()
+	}
+}
+
+// mixedItemsPage is a get_web response containing valid and invalid items.
+const mixedItemsPage = `{"items": [
+	{"primary_text": "Good", "secondary_text": "Artist", "id": 1,
+	 "url_hints": {"subdomain": "good", "slug": "good", "item_type": "a"}},
+	{"primary_text": "", "secondary_text": "Artist", "id": 2,
+	 "url_hints": {"subdomain": "notitle", "slug": "notitle", "item_type": "a"}},
+	{"primary_text": "No Hints", "secondary_text": "Artist", "id": 3},
+	{"primary_text": "No Host", "secondary_text": "Artist", "id": 4,
+	 "url_hints": {"slug": "nohost", "item_type": "a"}},
+	{"primary_text": "No Slug", "secondary_text": "Artist", "id": 5,
+	 "url_hints": {"subdomain": "noslug", "item_type": "a"}},
+	{"primary_text": "Custom", "secondary_text": "", "id": 6,
+	 "url_hints": {"custom_domain": "music.example.org", "slug": "custom", "item_type": "a"}}
+]}`
+
+func TestAPIItem_Valid(t *testing.T) {
+	var data struct {
+		Items []apiItem `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(mixedItemsPage), &data); err != nil {
+		t.Fatal(err)
+	}
+	want := []bool{true, false, false, false, false, true}
+	if len(data.Items) != len(want) {
+		t.Fatalf("Got %d items; want %d", len(data.Items), len(want))
+	}
+	for i, item := range data.Items {
+		if got := item.valid(); got != want[i] {
+			t.Errorf("Item %d (%q) valid() = %v; want %v", i, item.PrimaryText, got, want[i])
+		}
+	}
+}
+
+func TestFetch_InvalidItems(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, mixedItemsPage)
+	}))
+	defer srv.Close()
+
+	client := newTestClient(srv)
+	var skipped int32
+	client.SkipFunc = func(item, reason string) {
+		if reason == "missing required fields" {
+			atomic.AddInt32(&skipped, 1)
+		}
+	}
+	got, err := client.Fetch(context.Background(), testQuery)
+	if err != nil {
+		t.Fatal("Fetch failed:", err)
+	}
+	want := []string{"https://good.bandcamp.com/album/good", "https://music.example.org/album/custom"}
+	if urls := resultURLs(got); !reflect.DeepEqual(urls, want) {
+		t.Errorf("Fetch returned %q; want %q", urls, want)
+	}
+	if n := client.InvalidItems(); n != 4 {
+		t.Errorf("InvalidItems() = %d; want 4", n)
+	}
+	if n := atomic.LoadInt32(&skipped); n != 4 {
+		t.Errorf("SkipFunc reported %d invalid item(s); want 4", n)
+	}
+}
+
+func TestClient_QueryURL(t *testing.T) {
+	q := Query{Genre: "jazz", Subgenre: "fusion", Ranking: "new", Format: "vinyl", Week: -1}
+	for _, tc := range []struct {
+		ver  int
+		page int
+		want string
+	}{
+		{0, 0, "https://bandcamp.com/api/discover/3/get_web?f=vinyl&g=jazz&gn=0&p=0&s=new&t=fusion&w=-1"},
+		{2, 4, "https://bandcamp.com/api/discover/2/get_web?f=vinyl&g=jazz&gn=0&p=4&s=new&t=fusion&w=-1"},
+		{12, 1, "https://bandcamp.com/api/discover/12/get_web?f=vinyl&g=jazz&gn=0&p=1&s=new&t=fusion&w=-1"},
+	} {
+		c := Client{APIVersion: tc.ver}
+		if got, err := c.QueryURL(q, tc.page); err != nil {
+			t.Errorf("QueryURL(%+v, %d) with version %d failed: %v", q, tc.page, tc.ver, err)
+		} else if got != tc.want {
+			t.Errorf("QueryURL(%+v, %d) with version %d = %q; want %q", q, tc.page, tc.ver, got, tc.want)
+		}
+	}
+
+	c := Client{API: DiscoverWebAPI}
+	if got, err := c.QueryURL(q, 0); err == nil {
+		t.Errorf("QueryURL(%+v, 0) with %v API = %q; want error", q, DiscoverWebAPI, got)
+	}
+}
+
+func TestStream_DuplicatePage(t *testing.T) {
+	// The second page only repeats the first page's items, which callers will
+	// discard as duplicates. Paging should continue until an empty page is
+	// returned.
+	pages := [][]string{{"a", "b"}, {"a", "b"}, {"c"}, {}}
+	var mu sync.Mutex
+	var reqs []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := pageNum(t, r)
+		mu.Lock()
+		reqs = append(reqs, p)
+		mu.Unlock()
+		if p >= len(pages) {
+			t.Errorf("Got request for page %d after empty page", p)
+			writePage(t, w, 0)
+			return
+		}
+		writePage(t, w, 0, pages[p]...)
+	}))
+	defer srv.Close()
+
+	q := testQuery
+	q.Pages = AllPages
+	got, err := newTestClient(srv).Fetch(context.Background(), q)
+	if err != nil {
+		t.Fatal("Fetch failed:", err)
+	}
+	want := []string{testURL("a"), testURL("b"), testURL("a"), testURL("b"), testURL("c")}
+	if urls := resultURLs(got); !reflect.DeepEqual(urls, want) {
+		t.Errorf("Fetch returned %q; want %q", urls, want)
+	}
+	if want := []int{0, 1, 2, 3}; !reflect.DeepEqual(reqs, want) {
+		t.Errorf("Server got requests for pages %v; want %v", reqs, want)
+	}
+}
+
+func TestStream_TotalCount(t *testing.T) {
+	const perPage = 2
+	for _, tc := range []struct {
+		total, conc int
+	}{
+		{5, 1}, // last page is partial
+		{5, 2},
+		{6, 1}, // last page is full
+		{6, 2},
+	} {
+		pages := (tc.total + perPage - 1) / perPage
+		var reqs int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&reqs, 1)
+			p := pageNum(t, r)
+			if p >= pages {
+				t.Errorf("Total %d, concurrency %d: got request for page %d past end", tc.total, tc.conc, p)
+				http.Error(w, "past end", http.StatusInternalServerError)
+				return
+			}
+			slugs := pageSlugs(p, perPage)
+			if n := tc.total - p*perPage; n < len(slugs) {
+				slugs = slugs[:n]
+			}
+			writePage(t, w, tc.total, slugs...)
+		}))
+
+		c := newTestClient(srv)
+		c.Concurrency = tc.conc
+		q := testQuery
+		q.Pages = AllPages
+		got, err := c.Fetch(context.Background(), q)
+		srv.Close()
+		if err != nil {
+			t.Errorf("Total %d, concurrency %d: Fetch failed: %v", tc.total, tc.conc, err)
+			continue
+		}
+		if len(got) != tc.total {
+			t.Errorf("Total %d, concurrency %d: Fetch returned %d result(s)", tc.total, tc.conc, len(got))
+		}
+		if n := int(atomic.LoadInt32(&reqs)); n != pages {
+			t.Errorf("Total %d, concurrency %d: server got %d request(s); want %d", tc.total, tc.conc, n, pages)
+		}
+	}
+}
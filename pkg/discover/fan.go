@@ -0,0 +1,164 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// fanPageSize is the number of items requested in each fan collection API
+// request.
+const fanPageSize = 100
+
+// fanStartToken is passed as the initial older_than_token to the fan
+// collection API to start with the newest item. A fixed value is used rather
+// than the current time so that responses can be cached.
+const fanStartToken = "9999999999::a::"
+
+// FanCollection returns the albums and tracks in the public collection of the
+// Bandcamp fan with the supplied username (as in "https://bandcamp.com/username"),
+// newest first. If limit is positive, at most limit results are returned.
+func (c *Client) FanCollection(ctx context.Context, username string, limit int) ([]Result, error) {
+	fanID, err := c.fanID(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	return c.fetchFanItems(ctx, fanID, "collection_items", limit)
+}
+
+// FanWishlist is like FanCollection but returns the items in the fan's
+// public wishlist.
+func (c *Client) FanWishlist(ctx context.Context, username string, limit int) ([]Result, error) {
+	fanID, err := c.fanID(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	return c.fetchFanItems(ctx, fanID, "wishlist_items", limit)
+}
+
+// fanID fetches the fan page for username and returns the fan's numeric ID.
+func (c *Client) fanID(ctx context.Context, username string) (int64, error) {
+	if username == "" || strings.ContainsAny(username, "/?#") {
+		return 0, fmt.Errorf("invalid username %q", username)
+	}
+	u := c.baseURL() + "/" + url.PathEscape(username)
+	resp, err := c.get(ctx, u)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(u, resp); err != nil {
+		return 0, err
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	id, err := parseFanID(b)
+	if err != nil {
+		return 0, fmt.Errorf("%v: %v", u, err)
+	}
+	return id, nil
+}
+
+// parseFanID returns the fan ID from page's embedded page data.
+func parseFanID(page []byte) (int64, error) {
+	m := pagedataRegexp.FindSubmatch(page)
+	if m == nil {
+		return 0, errors.New("didn't find page data")
+	}
+	var data struct {
+		FanData struct {
+			FanID int64 `json:"fan_id"`
+		} `json:"fan_data"`
+	}
+	if err := json.Unmarshal([]byte(html.UnescapeString(string(m[1]))), &data); err != nil {
+		return 0, err
+	}
+	if data.FanData.FanID == 0 {
+		return 0, errors.New("didn't find fan ID")
+	}
+	return data.FanData.FanID, nil
+}
+
+// fanItem is an item in a fan collection API response.
+type fanItem struct {
+	BandName    string `json:"band_name"`
+	ItemTitle   string `json:"item_title"`
+	ItemURL     string `json:"item_url"`
+	ItemArtID   int64  `json:"item_art_id"`
+	BandID      int64  `json:"band_id"`
+	TralbumType string `json:"tralbum_type"` // "a" for album, "t" for track
+	TralbumID   int64  `json:"tralbum_id"`
+}
+
+// fetchFanItems pages through the fan collection API endpoint with the
+// supplied name (e.g. "collection_items" or "wishlist_items") for fanID.
+// If limit is positive, at most limit results are returned.
+func (c *Client) fetchFanItems(ctx context.Context, fanID int64, endpoint string, limit int) ([]Result, error) {
+	u := c.baseURL() + "/api/fancollection/1/" + endpoint
+	var res []Result
+	token := fanStartToken
+	for {
+		body, err := json.Marshal(struct {
+			FanID int64  `json:"fan_id"`
+			Token string `json:"older_than_token"`
+			Count int    `json:"count"`
+		}{fanID, token, fanPageSize})
+		if err != nil {
+			return nil, err
+		}
+		b, err := c.postCached(ctx, u, body)
+		if err != nil {
+			return nil, err
+		}
+		var data struct {
+			Error         bool      `json:"error"`
+			ErrorMessage  string    `json:"error_message"`
+			Items         []fanItem `json:"items"`
+			MoreAvailable bool      `json:"more_available"`
+			LastToken     string    `json:"last_token"`
+		}
+		if err := json.Unmarshal(b, &data); err != nil {
+			return nil, fmt.Errorf("%v: bad JSON (%v): %q", u, err, snippet(b))
+		}
+		if data.Error {
+			return nil, fmt.Errorf("%v: request failed: %v", u, data.ErrorMessage)
+		}
+		for _, item := range data.Items {
+			typ, ok := itemTypes[item.TralbumType]
+			if !ok || item.ItemURL == "" {
+				if c.SkipFunc != nil {
+					c.SkipFunc(fmt.Sprintf("%q by %q", item.ItemTitle, item.BandName),
+						fmt.Sprintf("unsupported item type %q or missing URL", item.TralbumType))
+				}
+				continue
+			}
+			res = append(res, Result{
+				Artist: item.BandName,
+				Album:  item.ItemTitle,
+				URL:    item.ItemURL,
+				Type:   typ,
+				ArtID:  item.ItemArtID,
+				BandID: item.BandID,
+				ItemID: item.TralbumID,
+				Rank:   len(res) + 1,
+			})
+			if limit > 0 && len(res) >= limit {
+				return res, nil
+			}
+		}
+		if !data.MoreAvailable || len(data.Items) == 0 || data.LastToken == "" || data.LastToken == token {
+			return res, nil
+		}
+		token = data.LastToken
+	}
+}
@@ -0,0 +1,329 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+// Genres maps from genres to subgenres, as accepted by the API's "g" and "t"
+// parameters. It may be out of date; see Client.FetchGenres.
+// The map contents were generated by running the following in the
+// JS console after loading https://bandcamp.com/#discover:
+//
+// el = document.getElementById('pagedata');
+// data = JSON.parse(el.getAttribute('data-blob')).discover_2015.options.t;
+//
+//	Object.entries(data).map(([g, subs]) => {
+//		 const s = subs.map(s => `"${s.value}",`).join("\n");
+//		 return `"${g}": []string{\n${s}\n},`
+//	}).join("\n");
+var Genres = map[string][]string{
+	"acoustic": []string{
+		"all-acoustic",
+		"folk",
+		"singer-songwriter",
+		"rock",
+		"pop",
+		"guitar",
+		"americana",
+		"electro-acoustic",
+		"instrumental",
+		"piano",
+		"bluegrass",
+		"roots",
+	},
+	"alternative": []string{
+		"all-alternative",
+		"indie-rock",
+		"industrial",
+		"shoegaze",
+		"grunge",
+		"goth",
+		"dream-pop",
+		"emo",
+		"math-rock",
+		"britpop",
+		"jangle-pop",
+	},
+	"ambient": []string{
+		"all-ambient",
+		"chill-out",
+		"drone",
+		"dark-ambient",
+		"electronic",
+		"soundscapes",
+		"field-recordings",
+		"atmospheric",
+		"meditation",
+		"noise",
+		"new-age",
+		"idm",
+		"industrial",
+	},
+	"blues": []string{
+		"all-blues",
+		"rhythm-blues",
+		"blues-rock",
+		"country-blues",
+		"boogie-woogie",
+		"delta-blues",
+		"americana",
+		"electric-blues",
+		"gospel",
+		"bluegrass",
+	},
+	"classical": []string{
+		"all-classical",
+		"orchestral",
+		"neo-classical",
+		"chamber-music",
+		"classical-piano",
+		"contemporary-classical",
+		"baroque",
+		"opera",
+		"choral",
+		"modern-classical",
+		"avant-garde",
+	},
+	"comedy": []string{
+		"all-comedy",
+		"improv",
+		"stand-up",
+	},
+	"country": []string{
+		"all-country",
+		"bluegrass",
+		"country-rock",
+		"americana",
+		"country-folk",
+		"alt-country",
+		"country-blues",
+		"western",
+		"singer-songwriter",
+		"outlaw",
+		"honky-tonk",
+		"roots",
+		"hillbilly",
+	},
+	"devotional": []string{
+		"all-devotional",
+		"christian",
+		"gospel",
+		"meditation",
+		"spiritual",
+		"worship",
+		"inspirational",
+	},
+	"electronic": []string{
+		"all-electronic",
+		"house",
+		"electronica",
+		"downtempo",
+		"techno",
+		"electro",
+		"dubstep",
+		"beats",
+		"dance",
+		"idm",
+		"drum-bass",
+		"breaks",
+		"trance",
+		"glitch",
+		"chiptune",
+		"chillwave",
+		"dub",
+		"edm",
+		"instrumental",
+		"witch-house",
+		"garage",
+		"juke",
+		"footwork",
+		"vaporwave",
+		"synthwave",
+	},
+	"experimental": []string{
+		"all-experimental",
+		"noise",
+		"drone",
+		"avant-garde",
+		"experimental-rock",
+		"improvisation",
+		"sound-art",
+		"musique-concrete",
+	},
+	"folk": []string{
+		"all-folk",
+		"singer-songwriter",
+		"folk-rock",
+		"indie-folk",
+		"pop-folk",
+		"traditional",
+		"experimental-folk",
+		"roots",
+	},
+	"funk": []string{
+		"all-funk",
+		"funk-jam",
+		"deep-funk",
+		"funk-rock",
+		"jazz-funk",
+		"boogie",
+		"g-funk",
+		"rare-groove",
+		"electro",
+		"go-go",
+	},
+	"hip-hop-rap": []string{
+		"all-hip-hop-rap",
+		"rap",
+		"underground-hip-hop",
+		"instrumental-hip-hop",
+		"trap",
+		"conscious-hip-hop",
+		"boom-bap",
+		"beat-tape",
+		"hardcore",
+		"grime",
+	},
+	"jazz": []string{
+		"all-jazz",
+		"fusion",
+		"big-band",
+		"nu-jazz",
+		"modern-jazz",
+		"swing",
+		"free-jazz",
+		"soul-jazz",
+		"latin-jazz",
+		"vocal-jazz",
+		"bebop",
+		"spiritual-jazz",
+	},
+	"kids": []string{
+		"all-kids",
+		"family-music",
+		"educational",
+		"music-therapy",
+		"lullaby",
+		"baby",
+	},
+	"latin": []string{
+		"all-latin",
+		"brazilian",
+		"cumbia",
+		"tango",
+		"latin-rock",
+		"flamenco",
+		"salsa",
+		"reggaeton",
+		"merengue",
+		"bolero",
+		"méxico-d.f.",
+		"bachata",
+	},
+	"metal": []string{
+		"all-metal",
+		"hardcore",
+		"black-metal",
+		"death-metal",
+		"thrash-metal",
+		"grindcore",
+		"doom",
+		"post-hardcore",
+		"progressive-metal",
+		"metalcore",
+		"sludge-metal",
+		"heavy-metal",
+		"deathcore",
+		"noise",
+	},
+	"pop": []string{
+		"all-pop",
+		"indie-pop",
+		"synth-pop",
+		"power-pop",
+		"new-wave",
+		"dream-pop",
+		"noise-pop",
+		"experimental-pop",
+		"electro-pop",
+		"adult-contemporary",
+		"jangle-pop",
+		"j-pop",
+	},
+	"punk": []string{
+		"all-punk",
+		"hardcore-punk",
+		"garage",
+		"pop-punk",
+		"punk-rock",
+		"post-punk",
+		"post-hardcore",
+		"thrash",
+		"crust-punk",
+		"folk-punk",
+		"emo",
+		"ska",
+		"no-wave",
+	},
+	"r-b-soul": []string{
+		"all-r-b-soul",
+		"soul",
+		"r-b",
+		"neo-soul",
+		"gospel",
+		"contemporary-r-b",
+		"motown",
+		"urban",
+	},
+	"reggae": []string{
+		"all-reggae",
+		"dub",
+		"ska",
+		"roots",
+		"dancehall",
+		"rocksteady",
+		"ragga",
+		"lovers-rock",
+	},
+	"rock": []string{
+		"all-rock",
+		"indie",
+		"prog-rock",
+		"post-rock",
+		"rock-roll",
+		"psychedelic-rock",
+		"hard-rock",
+		"garage-rock",
+		"surf-rock",
+		"instrumental",
+		"math-rock",
+		"rockabilly",
+	},
+	"soundtrack": []string{
+		"all-soundtrack",
+		"film-music",
+		"video-game-music",
+	},
+	"spoken-word": []string{
+		"all-spoken-word",
+		"poetry",
+		"inspirational",
+		"storytelling",
+		"self-help",
+	},
+	"world": []string{
+		"all-world",
+		"latin",
+		"roots",
+		"african",
+		"tropical",
+		"tribal",
+		"brazilian",
+		"celtic",
+		"world-fusion",
+		"cumbia",
+		"gypsy",
+		"new-age",
+		"balkan",
+		"reggaeton",
+	},
+}
@@ -0,0 +1,264 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// pagedataRegexp matches the element containing JSON page data in
+// Bandcamp's HTML. The first submatch contains the escaped JSON.
+var pagedataRegexp = regexp.MustCompile(`<div\s+id="pagedata"\s+data-blob="([^"]*)"`)
+
+// ParseGenreSpec parses a string like "electronic" or "electronic/techno" into
+// its genre and (possibly empty) subgenre. Whitespace is trimmed and the
+// returned values are lowercased.
+func ParseGenreSpec(spec string) (genre, subgenre string, err error) {
+	parts := strings.Split(spec, "/")
+	if len(parts) > 2 {
+		return "", "", fmt.Errorf("%q should contain genre or genre/subgenre", spec)
+	}
+	genre = strings.ToLower(strings.TrimSpace(parts[0]))
+	if genre == "" {
+		return "", "", fmt.Errorf("%q has empty genre", spec)
+	}
+	if len(parts) == 2 {
+		if subgenre = strings.ToLower(strings.TrimSpace(parts[1])); subgenre == "" {
+			return "", "", fmt.Errorf("%q has empty subgenre", spec)
+		}
+	}
+	return genre, subgenre, nil
+}
+
+// Formats lists the specific formats accepted by the API's "f" parameter.
+var Formats = []string{"digital", "vinyl", "cd", "cassette"}
+
+// Rankings lists the rankings accepted by the API's "s" parameter.
+var Rankings = []string{"top", "new", "rec"}
+
+// FetchGenres scrapes Bandcamp's home page and returns a map from genres to
+// subgenres as listed in the discover section.
+func (c *Client) FetchGenres(ctx context.Context) (map[string][]string, error) {
+	u := c.baseURL() + "/"
+	resp, err := c.get(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(u, resp); err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return parseGenres(b)
+}
+
+// parseGenres extracts the genre map from the supplied Bandcamp HTML page.
+func parseGenres(page []byte) (map[string][]string, error) {
+	m := pagedataRegexp.FindSubmatch(page)
+	if m == nil {
+		return nil, errors.New("didn't find page data")
+	}
+	var data struct {
+		Discover struct {
+			Options struct {
+				T map[string][]struct {
+					Value string `json:"value"`
+				} `json:"t"`
+			} `json:"options"`
+		} `json:"discover_2015"`
+	}
+	if err := json.Unmarshal([]byte(html.UnescapeString(string(m[1]))), &data); err != nil {
+		return nil, err
+	}
+	if len(data.Discover.Options.T) == 0 {
+		return nil, errors.New("didn't find genres in page data")
+	}
+	genres := make(map[string][]string, len(data.Discover.Options.T))
+	for g, subs := range data.Discover.Options.T {
+		for _, s := range subs {
+			genres[g] = append(genres[g], s.Value)
+		}
+	}
+	return genres, nil
+}
+
+// CheckGenre returns an error if genre (or subgenre, if non-empty) is unknown.
+func CheckGenre(genre, subgenre string) error {
+	if genre == "all" && subgenre == "" {
+		return nil
+	}
+	subs, ok := Genres[genre]
+	if !ok {
+		genres := make([]string, 0, len(Genres)+1)
+		genres = append(genres, "all")
+		for g := range Genres {
+			genres = append(genres, g)
+		}
+		return fmt.Errorf("unknown genre %q%v", genre, didYouMean(SuggestNames(genre, genres)))
+	}
+	if subgenre != "" && !contains(subs, subgenre) {
+		return fmt.Errorf("unknown subgenre %q for genre %q%v",
+			subgenre, genre, didYouMean(SuggestNames(subgenre, subs)))
+	}
+	return nil
+}
+
+// maxSuggestions is the maximum number of names returned by SuggestNames.
+const maxSuggestions = 3
+
+// SuggestNames returns up to a few of the names in cands that are similar to
+// name (e.g. "hip-hop-rap" for "hiphop"), with the closest first.
+// Punctuation and case are ignored.
+func SuggestNames(name string, cands []string) []string {
+	type match struct {
+		name string
+		dist int
+	}
+	norm := normalizeName(name)
+	var matches []match
+	for _, c := range cands {
+		nc := normalizeName(c)
+		dist := editDistance(norm, nc)
+		// Accept small typos, and also abbreviations like "hiphop" for "hip-hop-rap".
+		if dist <= 2 || (len(norm) >= 3 && strings.Contains(nc, norm)) {
+			matches = append(matches, match{c, dist})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].dist != matches[j].dist {
+			return matches[i].dist < matches[j].dist
+		}
+		return matches[i].name < matches[j].name
+	})
+	var names []string
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		names = append(names, matches[i].name)
+	}
+	return names
+}
+
+// didYouMean returns a suffix for error messages listing suggestions,
+// or an empty string if suggestions is empty.
+func didYouMean(suggestions []string) string {
+	if len(suggestions) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(suggestions))
+	for i, s := range suggestions {
+		quoted[i] = strconv.Quote(s)
+	}
+	return " (did you mean " + strings.Join(quoted, " or ") + "?)"
+}
+
+// normalizeName lowercases s and removes non-alphanumeric characters.
+func normalizeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	cur := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(br)]
+}
+
+// min3 returns the minimum of a, b, and c.
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// MergeGenres returns a new map from genres to subgenres containing the union
+// of a and b. Subgenres from a are listed first.
+func MergeGenres(a, b map[string][]string) map[string][]string {
+	merged := make(map[string][]string, len(a))
+	for _, m := range []map[string][]string{a, b} {
+		for g, subs := range m {
+			if _, ok := merged[g]; !ok {
+				merged[g] = []string{} // preserve genres without subgenres
+			}
+			for _, s := range subs {
+				if !contains(merged[g], s) {
+					merged[g] = append(merged[g], s)
+				}
+			}
+		}
+	}
+	return merged
+}
+
+// DiffGenres compares the old and cur maps from genres to subgenres and
+// returns a sorted list of differences. Added genres are described as "+genre",
+// removed genres as "-genre", and added and removed subgenres as
+// "+genre/subgenre" and "-genre/subgenre".
+func DiffGenres(old, cur map[string][]string) []string {
+	var diffs []string
+	// addDiffs appends entries in a but not b to diffs with the supplied prefix.
+	addDiffs := func(a, b map[string][]string, prefix string) {
+		for g, subs := range a {
+			bsubs, ok := b[g]
+			if !ok {
+				diffs = append(diffs, prefix+g)
+				continue
+			}
+			bset := make(map[string]struct{}, len(bsubs))
+			for _, s := range bsubs {
+				bset[s] = struct{}{}
+			}
+			for _, s := range subs {
+				if _, ok := bset[s]; !ok {
+					diffs = append(diffs, prefix+g+"/"+s)
+				}
+			}
+		}
+	}
+	addDiffs(cur, old, "+")
+	addDiffs(old, cur, "-")
+	sort.Slice(diffs, func(i, j int) bool {
+		// Sort by name, putting additions before removals.
+		if a, b := diffs[i][1:], diffs[j][1:]; a != b {
+			return a < b
+		}
+		return diffs[i][0] == '+' && diffs[j][0] == '-'
+	})
+	return diffs
+}
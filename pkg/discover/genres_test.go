@@ -0,0 +1,83 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffGenres(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		old, cur map[string][]string
+		want     []string
+	}{
+		{"empty", nil, nil, nil},
+		{
+			"unchanged",
+			map[string][]string{"rock": {"indie", "punk"}, "jazz": {}},
+			map[string][]string{"jazz": {}, "rock": {"punk", "indie"}},
+			nil,
+		},
+		{
+			"added",
+			map[string][]string{"rock": {"indie"}},
+			map[string][]string{"rock": {"indie", "punk"}, "jazz": {"bebop"}},
+			[]string{"+jazz", "+rock/punk"},
+		},
+		{
+			"removed",
+			map[string][]string{"rock": {"indie", "punk"}, "jazz": {"bebop"}},
+			map[string][]string{"rock": {"indie"}},
+			[]string{"-jazz", "-rock/punk"},
+		},
+		{
+			"added and removed",
+			map[string][]string{"rock": {"indie", "punk"}, "metal": {}},
+			map[string][]string{"rock": {"indie", "shoegaze"}, "jazz": {}},
+			[]string{"+jazz", "-metal", "-rock/punk", "+rock/shoegaze"},
+		},
+		{
+			"renamed",
+			map[string][]string{"hip-hop": {}},
+			map[string][]string{"hip-hop-rap": {}},
+			[]string{"-hip-hop", "+hip-hop-rap"},
+		},
+	} {
+		if got := DiffGenres(tc.old, tc.cur); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: DiffGenres(%v, %v) = %q; want %q", tc.desc, tc.old, tc.cur, got, tc.want)
+		}
+	}
+}
+
+func TestParseGenreSpec(t *testing.T) {
+	for _, tc := range []struct {
+		spec          string
+		genre, subgen string
+		ok            bool
+	}{
+		{"electronic", "electronic", "", true},
+		{"electronic/techno", "electronic", "techno", true},
+		{" Electronic / Techno ", "electronic", "techno", true},
+		{"hip-hop-rap/trap", "hip-hop-rap", "trap", true},
+		{"", "", "", false},
+		{"  ", "", "", false},
+		{"/techno", "", "", false},
+		{"electronic/", "", "", false},
+		{"electronic/ ", "", "", false},
+		{"electronic/techno/detroit", "", "", false},
+	} {
+		genre, subgen, err := ParseGenreSpec(tc.spec)
+		if !tc.ok {
+			if err == nil {
+				t.Errorf("ParseGenreSpec(%q) = %q, %q; want error", tc.spec, genre, subgen)
+			}
+		} else if err != nil {
+			t.Errorf("ParseGenreSpec(%q) failed: %v", tc.spec, err)
+		} else if genre != tc.genre || subgen != tc.subgen {
+			t.Errorf("ParseGenreSpec(%q) = %q, %q; want %q, %q", tc.spec, genre, subgen, tc.genre, tc.subgen)
+		}
+	}
+}
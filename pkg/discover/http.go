@@ -0,0 +1,301 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultRetryDelay is used when a rate-limited response doesn't say when
+// to retry.
+const defaultRetryDelay = 5 * time.Second
+
+const (
+	// DefaultRetryBackoff is the default value of Client.RetryBackoff.
+	DefaultRetryBackoff = time.Second
+	// maxRetryBackoff is the maximum delay before retrying after a transient failure.
+	maxRetryBackoff = time.Minute
+)
+
+// RateLimitError is returned when the server responds with
+// 429 Too Many Requests and no retries remain.
+type RateLimitError struct {
+	URL   string
+	Until time.Time // when to retry; zero if unknown
+}
+
+func (e *RateLimitError) Error() string {
+	if e.Until.IsZero() {
+		return fmt.Sprintf("%v: rate limited", e.URL)
+	}
+	return fmt.Sprintf("%v: rate limited; retry after %v", e.URL, e.Until.Format(time.RFC1123))
+}
+
+// maxErrorBodyLen is the maximum number of bytes of response bodies that are
+// included in errors.
+const maxErrorBodyLen = 200
+
+// StatusError is returned when the server responds with an unexpected status.
+// Rate-limited responses are instead reported as *RateLimitError.
+type StatusError struct {
+	URL    string
+	Code   int    // e.g. 404
+	Status string // e.g. "404 Not Found"
+	Body   string // beginning of the response body
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("%v: %v", e.URL, e.Status)
+	}
+	return fmt.Sprintf("%v: %v: %q", e.URL, e.Status, e.Body)
+}
+
+// checkStatus returns a *StatusError if resp (a response for u) doesn't have
+// status 200 OK. resp's body is partially consumed in that case.
+func checkStatus(u string, resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyLen+1))
+	return &StatusError{URL: u, Code: resp.StatusCode, Status: resp.Status, Body: snippet(b)}
+}
+
+// snippet returns the beginning of b for use in error messages.
+func snippet(b []byte) string {
+	s := strings.TrimSpace(string(b))
+	if len(s) > maxErrorBodyLen {
+		s = strings.ToValidUTF8(s[:maxErrorBodyLen], "") + "..."
+	}
+	return s
+}
+
+// CheckURL sends a HEAD request for u and returns the response's status code.
+func (c *Client) CheckURL(ctx context.Context, u string) (int, error) {
+	resp, err := c.do(ctx, http.MethodHead, u, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// getCached returns the body of a GET request for u. A *StatusError is returned
+// if the server doesn't respond with 200 OK. If c.Cache is non-nil, it is used
+// to return or save successful responses. Expired responses that included an
+// ETag or Last-Modified header are revalidated with a conditional request.
+func (c *Client) getCached(ctx context.Context, u string) ([]byte, error) {
+	return c.fetchCached(ctx, http.MethodGet, u, nil)
+}
+
+// postCached is similar to getCached but POSTs body as JSON to u.
+// Responses are cached using both u and body as the key.
+func (c *Client) postCached(ctx context.Context, u string, body []byte) ([]byte, error) {
+	return c.fetchCached(ctx, http.MethodPost, u, body)
+}
+
+// fetchCached implements getCached and postCached.
+func (c *Client) fetchCached(ctx context.Context, method, u string, body []byte) ([]byte, error) {
+	key := u
+	if body != nil {
+		key += "\n" + string(body)
+	}
+	var stale []byte
+	var hdr http.Header
+	if c.Cache != nil {
+		b, ok := c.Cache.get(key, time.Now())
+		c.mu.Lock()
+		if ok {
+			c.cacheHits++
+		} else {
+			c.cacheMisses++
+		}
+		c.mu.Unlock()
+		if ok {
+			return b, nil
+		}
+		var v validators
+		if stale, v, ok = c.Cache.getStale(key); ok {
+			hdr = make(http.Header)
+			if v.ETag != "" {
+				hdr.Set("If-None-Match", v.ETag)
+			}
+			if v.LastModified != "" {
+				hdr.Set("If-Modified-Since", v.LastModified)
+			}
+		}
+	}
+	if body != nil {
+		if hdr == nil {
+			hdr = make(http.Header)
+		}
+		hdr.Set("Content-Type", "application/json")
+	}
+	resp, err := c.do(ctx, method, u, hdr, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && stale != nil {
+		c.mu.Lock()
+		c.cacheRevalidated++
+		c.mu.Unlock()
+		if err := c.Cache.touch(key, time.Now()); err != nil {
+			return nil, err
+		}
+		return stale, nil
+	}
+	if err := checkStatus(u, resp); err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", u, err)
+	}
+	if c.Cache != nil {
+		v := validators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+		if err := c.Cache.put(key, b, v); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// get sends a GET request for u and returns the response, which the caller
+// must close.
+func (c *Client) get(ctx context.Context, u string) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, u, nil, nil)
+}
+
+// do sends a request for u with the supplied additional headers and body (both
+// of which may be nil) and returns the response, which the caller must close.
+// Requests that fail due to rate-limiting, server errors, or network
+// errors are retried up to c.Retries times, subject to c.RetryBudget. If no
+// retries remain, server errors are returned as responses and other failures
+// as errors.
+func (c *Client) do(ctx context.Context, method, u string, hdr http.Header, body []byte) (*http.Response, error) {
+	for tries := 0; ; tries++ {
+		if err := c.Limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		var br io.Reader
+		if body != nil {
+			br = bytes.NewReader(body) // recreated for each try
+		}
+		req, err := http.NewRequestWithContext(ctx, method, u, br)
+		if err != nil {
+			return nil, err
+		}
+		ua := c.UserAgent
+		if ua == "" {
+			ua = DefaultUserAgent
+		}
+		for k, vs := range hdr {
+			req.Header[k] = vs
+		}
+		req.Header.Set("User-Agent", ua)
+		resp, err := c.httpClient().Do(req)
+		var delay time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, ctx.Err() // let callers check for cancellation
+			}
+			err = fmt.Errorf("%v: %v", u, err)
+			delay = c.backoff(tries)
+		case resp.StatusCode == http.StatusTooManyRequests:
+			now := time.Now()
+			rle := &RateLimitError{URL: u, Until: parseRetryAfter(resp.Header.Get("Retry-After"), now)}
+			err = rle
+			delay = defaultRetryDelay
+			if !rle.Until.IsZero() {
+				delay = rle.Until.Sub(now)
+				if delay < 0 {
+					delay = 0 // date in the past
+				}
+			}
+		case resp.StatusCode >= 500:
+			delay = c.backoff(tries)
+		default:
+			return resp, nil
+		}
+
+		if tries >= c.Retries || !c.reserveRetryWait(delay) {
+			if err != nil {
+				if resp != nil {
+					resp.Body.Close()
+				}
+				return nil, err
+			}
+			return resp, nil // let the caller report the server error
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff returns the delay before retrying a request that failed with a
+// transient error after tries previous retries. The delay doubles with each
+// retry and is randomly jittered so that concurrent requests are spread out.
+func (c *Client) backoff(tries int) time.Duration {
+	d := c.RetryBackoff
+	if d <= 0 {
+		d = DefaultRetryBackoff
+	}
+	for i := 0; i < tries && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	// Wait for between half and all of d.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which may contain
+// either a number of seconds or an HTTP date. The zero time is returned if
+// v is empty or invalid.
+func parseRetryAfter(v string, now time.Time) time.Time {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Time{}
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return time.Time{}
+		}
+		return now.Add(time.Duration(secs) * time.Second)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+// sleep waits for d or until ctx is cancelled.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
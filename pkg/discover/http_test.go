@@ -0,0 +1,114 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient_Backoff(t *testing.T) {
+	for _, tc := range []struct {
+		base  time.Duration // Client.RetryBackoff
+		tries int
+		max   time.Duration // expected max delay; min is half of this
+	}{
+		{0, 0, DefaultRetryBackoff},
+		{0, 2, 4 * DefaultRetryBackoff},
+		{100 * time.Millisecond, 0, 100 * time.Millisecond},
+		{100 * time.Millisecond, 1, 200 * time.Millisecond},
+		{100 * time.Millisecond, 3, 800 * time.Millisecond},
+		{10 * time.Second, 3, maxRetryBackoff},
+		{time.Second, 1000, maxRetryBackoff}, // shouldn't overflow
+		{2 * maxRetryBackoff, 0, maxRetryBackoff},
+	} {
+		c := Client{RetryBackoff: tc.base}
+		seen := make(map[time.Duration]struct{})
+		for i := 0; i < 100; i++ {
+			d := c.backoff(tc.tries)
+			if d < tc.max/2 || d > tc.max {
+				t.Errorf("backoff(%d) with base %v = %v; want %v to %v", tc.tries, tc.base, d, tc.max/2, tc.max)
+				break
+			}
+			seen[d] = struct{}{}
+		}
+		// The delay should be randomly jittered.
+		if len(seen) < 2 {
+			t.Errorf("backoff(%d) with base %v always returned %v", tc.tries, tc.base, c.backoff(tc.tries))
+		}
+	}
+}
+
+func TestClient_RetryBudget(t *testing.T) {
+	var reqs int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&reqs, 1)
+		http.Error(w, "broken", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	const (
+		retries = 10
+		budget  = 100 * time.Millisecond
+	)
+	client := newTestClient(srv)
+	client.Retries = retries
+	client.RetryBackoff = 20 * time.Millisecond
+	client.RetryBudget = budget
+	start := time.Now()
+	_, err := client.Fetch(context.Background(), testQuery)
+	var se *StatusError
+	if !errors.As(err, &se) || se.Code != http.StatusServiceUnavailable {
+		t.Errorf("Fetch returned %v; want %v StatusError", err, http.StatusServiceUnavailable)
+	}
+	// The budget should be exhausted long before all retries are used.
+	if n := atomic.LoadInt32(&reqs); n < 2 || n > retries {
+		t.Errorf("Fetch sent %d requests; want 2 to %d", n, retries)
+	}
+	if wait := client.RetryWait(); wait > budget {
+		t.Errorf("RetryWait() = %v; want at most %v", wait, budget)
+	}
+	if elapsed := time.Since(start); elapsed > 10*budget {
+		t.Errorf("Fetch took %v", elapsed)
+	}
+
+	// Later requests shouldn't be retried once the budget is exhausted, even
+	// if the server asks for a short delay.
+	rsrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&reqs, 1)
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer rsrv.Close()
+	client.BaseURL = rsrv.URL
+	atomic.StoreInt32(&reqs, 0)
+	var rle *RateLimitError
+	if _, err := client.Fetch(context.Background(), testQuery); !errors.As(err, &rle) {
+		t.Errorf("Fetch after exhausting budget returned %v; want RateLimitError", err)
+	}
+	if n := atomic.LoadInt32(&reqs); n != 1 {
+		t.Errorf("Fetch after exhausting budget sent %d requests; want 1", n)
+	}
+}
+
+func TestClient_ReserveRetryWait(t *testing.T) {
+	c := Client{RetryBudget: time.Second}
+	if !c.reserveRetryWait(-time.Hour) {
+		t.Error("reserveRetryWait(-1h) failed")
+	}
+	if got := c.RetryWait(); got != 0 {
+		t.Errorf("RetryWait() = %v after negative reservation; want 0", got)
+	}
+	if !c.reserveRetryWait(time.Second) {
+		t.Error("reserveRetryWait(1s) failed")
+	}
+	if c.reserveRetryWait(time.Nanosecond) {
+		t.Error("reserveRetryWait(1ns) succeeded after exhausting budget")
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is used to limit the rate at which requests are sent.
+// A single Limiter may be shared by multiple Clients.
+type Limiter struct {
+	interval time.Duration // minimum time between requests; 0 if unlimited
+	mu       sync.Mutex
+	next     time.Time // earliest time at which the next request may be sent
+}
+
+// NewLimiter returns a Limiter permitting rate requests per second.
+// If rate is 0 or negative, requests are not limited.
+func NewLimiter(rate float64) *Limiter {
+	var l Limiter
+	if rate > 0 {
+		l.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return &l
+}
+
+// Wait blocks until another request may be sent or ctx is cancelled.
+// It is safe to call Wait on a nil Limiter.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l == nil || l.interval == 0 {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	return sleep(ctx, delay)
+}
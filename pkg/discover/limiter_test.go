@@ -0,0 +1,69 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Wait(t *testing.T) {
+	const (
+		rate  = 50 // per second
+		calls = 5
+	)
+	interval := time.Second / rate
+	l := NewLimiter(rate)
+	ctx := context.Background()
+	start := time.Now()
+	var times []time.Duration
+	for i := 0; i < calls; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatalf("Wait %d failed: %v", i, err)
+		}
+		times = append(times, time.Since(start))
+	}
+	if times[0] > interval/2 {
+		t.Errorf("First Wait took %v; want immediate return", times[0])
+	}
+	// Later calls are scheduled relative to the first one, so a late wakeup
+	// can shorten the following delay.
+	for i := 1; i < len(times); i++ {
+		if min := time.Duration(i) * interval; times[i] < min {
+			t.Errorf("Wait %d returned after %v; want at least %v", i, times[i], min)
+		}
+	}
+}
+
+func TestLimiter_Unlimited(t *testing.T) {
+	ctx := context.Background()
+	for _, l := range []*Limiter{nil, NewLimiter(0), NewLimiter(-1)} {
+		start := time.Now()
+		for i := 0; i < 100; i++ {
+			if err := l.Wait(ctx); err != nil {
+				t.Fatalf("Wait failed: %v", err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Errorf("Unlimited Wait calls took %v", elapsed)
+		}
+	}
+}
+
+func TestLimiter_Cancel(t *testing.T) {
+	l := NewLimiter(0.1) // one request every 10 seconds
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := l.Wait(ctx); err != nil {
+		t.Fatal("First Wait failed:", err)
+	}
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	if err := l.Wait(ctx); err != context.Canceled {
+		t.Errorf("Wait returned %v after cancellation; want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Wait took %v to notice cancellation", elapsed)
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// Location describes a place that can be used as Query.Location.
+type Location struct {
+	ID       int64  `json:"id"`       // GeoNames ID
+	Name     string `json:"name"`     // e.g. "Berlin"
+	FullName string `json:"fullname"` // e.g. "Berlin, Germany"
+}
+
+// maxLocations is the maximum number of locations returned by SearchLocations.
+const maxLocations = 5
+
+// SearchLocations returns locations matching name (e.g. "berlin"), with the
+// best matches first.
+func (c *Client) SearchLocations(ctx context.Context, name string) ([]Location, error) {
+	vals := url.Values{"q": {name}, "n": {fmt.Sprint(maxLocations)}}
+	u := c.baseURL() + "/api/location/1/geoname_search?" + vals.Encode()
+	b, err := c.getCached(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		OK      bool       `json:"ok"`
+		Results []Location `json:"results"`
+	}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, fmt.Errorf("%v: bad JSON (%v): %q", u, err, snippet(b))
+	}
+	if !data.OK {
+		return nil, fmt.Errorf("%v: request failed: %q", u, snippet(b))
+	}
+	return data.Results, nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TagSorts lists the values accepted by TagQuery.Sort.
+var TagSorts = []string{"pop", "date", "random"}
+
+// TagQuery describes a query for the "dig deeper" API used by Bandcamp's tag
+// pages (e.g. https://bandcamp.com/tag/dungeon-synth). Unlike Query, it
+// accepts arbitrary tags rather than only genres from Genres.
+type TagQuery struct {
+	Tags     []string // e.g. "dungeon-synth"; results must have all tags
+	Sort     string   // "pop", "date", or "random"
+	Format   string   // "all", "digital", "vinyl", "cd", or "cassette"
+	Location int64    // GeoNames ID from SearchLocations, or 0 for anywhere
+	Page     int      // first page to fetch, starting at 0
+	Pages    int      // number of pages to fetch; 0 is treated as 1 and AllPages fetches all
+	Limit    int      // maximum number of results to return; 0 for no limit
+}
+
+// Validate returns an error if q's fields contain invalid values.
+func (q *TagQuery) Validate() error {
+	switch {
+	case len(q.Tags) == 0:
+		return errors.New("no tags")
+	case !contains(TagSorts, q.Sort):
+		return fmt.Errorf("invalid sort %q (valid: %v)", q.Sort, strings.Join(TagSorts, ", "))
+	case q.Format != "all" && !contains(Formats, q.Format):
+		return fmt.Errorf("invalid format %q (valid: all, %v)", q.Format, strings.Join(Formats, ", "))
+	case q.Page < 0:
+		return fmt.Errorf("invalid page %d", q.Page)
+	case q.Pages < 0 && q.Pages != AllPages:
+		return fmt.Errorf("invalid page count %d", q.Pages)
+	case q.Location < 0:
+		return fmt.Errorf("invalid location %d", q.Location)
+	case q.Limit < 0:
+		return fmt.Errorf("invalid limit %d", q.Limit)
+	}
+	for _, t := range q.Tags {
+		if t == "" {
+			return errors.New("empty tag")
+		}
+	}
+	return nil
+}
+
+// FetchTag runs q and returns its results. Paging stops once q.Limit results
+// have been received. Each result's Genre field contains q's tags joined by
+// commas, and Ranking contains q.Sort.
+func (c *Client) FetchTag(ctx context.Context, q TagQuery) ([]Result, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	pages := q.Pages
+	if pages == 0 {
+		pages = 1
+	}
+	var res []Result
+	for p := q.Page; pages == AllPages || p < q.Page+pages; p++ {
+		pres, more, err := c.fetchTagPage(ctx, q, p)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range pres {
+			r.Rank = len(res) + 1
+			res = append(res, r)
+			if q.Limit > 0 && len(res) >= q.Limit {
+				return res, nil
+			}
+		}
+		if !more {
+			break
+		}
+	}
+	return res, nil
+}
+
+// tagItem is an item in a dig_deeper API response.
+type tagItem struct {
+	Title       string `json:"title"`
+	Artist      string `json:"artist"`
+	TralbumType string `json:"tralbum_type"` // "a" for album, "t" for track
+	TralbumID   int64  `json:"tralbum_id"`
+	TralbumURL  string `json:"tralbum_url"`
+	ArtID       int64  `json:"art_id"`
+	BandID      int64  `json:"band_id"`
+}
+
+// fetchTagPage fetches the specified 0-based page of q's results. more is
+// true if the API reported that additional pages are available.
+func (c *Client) fetchTagPage(ctx context.Context, q TagQuery, page int) (res []Result, more bool, err error) {
+	type filters struct {
+		Format   string   `json:"format"`
+		Location int64    `json:"location"`
+		Sort     string   `json:"sort"`
+		Tags     []string `json:"tags"`
+	}
+	body, err := json.Marshal(struct {
+		Filters filters `json:"filters"`
+		Page    int     `json:"page"` // 1-based
+	}{filters{q.Format, q.Location, q.Sort, q.Tags}, page + 1})
+	if err != nil {
+		return nil, false, err
+	}
+	u := c.baseURL() + "/api/hub/2/dig_deeper"
+	b, err := c.postCached(ctx, u, body)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var data struct {
+		OK            bool      `json:"ok"`
+		Items         []tagItem `json:"items"`
+		MoreAvailable bool      `json:"more_available"`
+	}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, false, fmt.Errorf("%v: bad JSON (%v): %q", u, err, snippet(b))
+	}
+	if !data.OK {
+		return nil, false, fmt.Errorf("%v: request failed: %q", u, snippet(b))
+	}
+	genre := strings.Join(q.Tags, ",")
+	for _, item := range data.Items {
+		typ, ok := itemTypes[item.TralbumType]
+		if !ok || item.TralbumURL == "" {
+			if c.SkipFunc != nil {
+				c.SkipFunc(fmt.Sprintf("%q by %q", item.Title, item.Artist),
+					fmt.Sprintf("unsupported item type %q or missing URL", item.TralbumType))
+			}
+			continue
+		}
+		res = append(res, Result{
+			Artist:  item.Artist,
+			Album:   item.Title,
+			URL:     item.TralbumURL,
+			Type:    typ,
+			ArtID:   item.ArtID,
+			BandID:  item.BandID,
+			ItemID:  item.TralbumID,
+			Genre:   genre,
+			Ranking: q.Sort,
+		})
+	}
+	return res, data.MoreAvailable && len(data.Items) > 0, nil
+}
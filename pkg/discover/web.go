@@ -0,0 +1,185 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	// GetWebAPI is the original Discover API ("/api/discover/<version>/get_web")
+	// and is used if Client.API is empty.
+	GetWebAPI = "get_web"
+	// DiscoverWebAPI is the newer Discover API used by bandcamp.com/discover
+	// ("/api/discover/1/discover_web"). It uses cursors instead of page numbers,
+	// so Query.Page is implemented by fetching and discarding earlier pages.
+	DiscoverWebAPI = "discover_web"
+)
+
+// APIs lists the values accepted by Client.API.
+var APIs = []string{GetWebAPI, DiscoverWebAPI}
+
+// discoverWebPageSize is the number of results requested in each
+// discover_web page.
+const discoverWebPageSize = 60
+
+// discoverWebSlices maps from rankings in Rankings to discover_web "slice"
+// values.
+var discoverWebSlices = map[string]string{"top": "top", "new": "new", "rec": "rand"}
+
+// discoverWebCategories maps from Query.Format values to discover_web
+// "category_id" values.
+var discoverWebCategories = map[string]int{"all": 0, "digital": 1, "vinyl": 2, "cd": 3, "cassette": 4}
+
+// discoverWebURL returns the URL to which discover_web requests are sent.
+func (c *Client) discoverWebURL() string {
+	return c.baseURL() + "/api/discover/1/discover_web"
+}
+
+// webItem is an item in a discover_web response.
+type webItem struct {
+	ID         int64  `json:"id"` // album or track ID
+	Title      string `json:"title"`
+	BandName   string `json:"band_name"`
+	BandID     int64  `json:"band_id"`
+	ItemURL    string `json:"item_url"`
+	ImageID    int64  `json:"item_image_id"`
+	ResultType string `json:"result_type"` // "a" for album, "t" for track
+}
+
+// streamDiscoverWeb implements stream using the discover_web API.
+func (c *Client) streamDiscoverWeb(ctx context.Context, q Query, rch chan<- Result) error {
+	if q.Week != 0 {
+		return errors.New("week isn't supported by " + DiscoverWebAPI)
+	}
+	tags := []string{}
+	if q.Genre != "all" {
+		tags = append(tags, q.Genre)
+		if q.Subgenre != "" {
+			tags = append(tags, q.Subgenre)
+		}
+	}
+	want := q.Type
+	if want == "" {
+		want = "album"
+	}
+	pages := q.Pages
+	if pages == 0 {
+		pages = 1
+	}
+
+	cursor := "*"
+	var sent int // number of results sent to rch
+	for p := 0; pages == AllPages || p < q.Page+pages; p++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		body, err := json.Marshal(map[string]interface{}{
+			"category_id":          discoverWebCategories[q.Format],
+			"tag_norm_names":       tags,
+			"geoname_id":           q.Location,
+			"slice":                discoverWebSlices[q.Ranking],
+			"cursor":               cursor,
+			"size":                 discoverWebPageSize,
+			"include_result_types": []string{"a", "t"},
+		})
+		if err != nil {
+			return err
+		}
+		u := c.discoverWebURL()
+		b, err := c.postCached(ctx, u, body)
+		if err != nil {
+			return err
+		}
+		var data struct {
+			Results []webItem `json:"results"`
+			Cursor  string    `json:"cursor"`
+		}
+		if err := json.Unmarshal(b, &data); err != nil {
+			return fmt.Errorf("%v: bad JSON (%v): %q", u, err, snippet(b))
+		}
+		if p < q.Page {
+			// Skip pages before the requested one, which were only fetched to
+			// get the next cursor.
+			if cursor = data.Cursor; cursor == "" || len(data.Results) == 0 {
+				return nil
+			}
+			continue
+		}
+
+		var res []Result
+		var badTypes []string
+		var invalid int
+		for _, item := range data.Results {
+			desc := fmt.Sprintf("%q by %q", item.Title, item.BandName)
+			if item.ItemURL == "" || item.Title == "" {
+				invalid++
+				c.skipWeb(desc, "missing required fields")
+				continue
+			}
+			if q.StrictItemType != "" && item.ResultType != q.StrictItemType {
+				if !contains(badTypes, item.ResultType) {
+					badTypes = append(badTypes, item.ResultType)
+				}
+				continue
+			}
+			typ, ok := itemTypes[item.ResultType]
+			if !ok {
+				c.skipWeb(desc, fmt.Sprintf("unsupported item type %q", item.ResultType))
+				continue
+			}
+			if typ != want && want != "all" {
+				c.skipWeb(desc, typ+" excluded by query type")
+				continue
+			}
+			res = append(res, Result{
+				Artist:   item.BandName,
+				Album:    item.Title,
+				URL:      item.ItemURL,
+				Type:     typ,
+				ArtID:    item.ImageID,
+				BandID:   item.BandID,
+				ItemID:   item.ID,
+				Genre:    q.Genre,
+				Subgenre: q.Subgenre,
+				Ranking:  q.Ranking,
+			})
+		}
+		c.mu.Lock()
+		c.invalid += invalid
+		c.mu.Unlock()
+		if len(badTypes) > 0 {
+			sort.Strings(badTypes)
+			return &ItemTypeError{Want: q.StrictItemType, Got: badTypes}
+		}
+
+		for _, r := range res {
+			sent++
+			r.Rank = sent
+			select {
+			case rch <- r:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if q.Limit > 0 && sent >= q.Limit {
+				return nil
+			}
+		}
+		if cursor = data.Cursor; cursor == "" || len(data.Results) == 0 {
+			break // no more pages
+		}
+	}
+	return nil
+}
+
+// skipWeb calls c.SkipFunc (if non-nil) for the item described by desc.
+func (c *Client) skipWeb(desc, reason string) {
+	if c.SkipFunc != nil {
+		c.SkipFunc(desc, reason)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestStream_DiscoverWebCursor(t *testing.T) {
+	// Each page's cursor points at the next page. The last page has no cursor.
+	pages := map[string]struct {
+		slugs []string
+		next  string
+	}{
+		"*":  {[]string{"a", "b"}, "c1"},
+		"c1": {[]string{"c", "d"}, "c2"},
+		"c2": {[]string{"e"}, ""},
+	}
+	var mu sync.Mutex
+	var cursors []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/discover/1/discover_web" {
+			t.Errorf("Unexpected %v request for %v", r.Method, r.URL.Path)
+		}
+		var req struct {
+			Cursor string `json:"cursor"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error("Failed decoding request:", err)
+		}
+		mu.Lock()
+		cursors = append(cursors, req.Cursor)
+		mu.Unlock()
+		page, ok := pages[req.Cursor]
+		if !ok {
+			t.Errorf("Got request with unexpected cursor %q", req.Cursor)
+			http.Error(w, "bad cursor", http.StatusInternalServerError)
+			return
+		}
+		var data struct {
+			Results []webItem `json:"results"`
+			Cursor  string    `json:"cursor"`
+		}
+		data.Cursor = page.next
+		for i, s := range page.slugs {
+			data.Results = append(data.Results, webItem{ID: int64(i + 1), Title: "Album " + s,
+				BandName: "Artist " + s, ItemURL: testURL(s), ResultType: "a"})
+		}
+		if err := json.NewEncoder(w).Encode(data); err != nil {
+			t.Error("Failed writing page:", err)
+		}
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv)
+	c.API = DiscoverWebAPI
+	for _, tc := range []struct {
+		page, pages int
+		cursors     []string // expected cursors in requests
+		slugs       []string // expected results
+	}{
+		{0, AllPages, []string{"*", "c1", "c2"}, []string{"a", "b", "c", "d", "e"}},
+		{1, 1, []string{"*", "c1"}, []string{"c", "d"}},
+		{1, AllPages, []string{"*", "c1", "c2"}, []string{"c", "d", "e"}},
+		{0, 5, []string{"*", "c1", "c2"}, []string{"a", "b", "c", "d", "e"}},
+	} {
+		cursors = nil
+		q := testQuery
+		q.Page, q.Pages = tc.page, tc.pages
+		desc := fmt.Sprintf("Page %d, pages %d", tc.page, tc.pages)
+		got, err := c.Fetch(context.Background(), q)
+		if err != nil {
+			t.Errorf("%v: Fetch failed: %v", desc, err)
+			continue
+		}
+		var want []string
+		for _, s := range tc.slugs {
+			want = append(want, testURL(s))
+		}
+		if urls := resultURLs(got); !reflect.DeepEqual(urls, want) {
+			t.Errorf("%v: Fetch returned %q; want %q", desc, urls, want)
+		}
+		if !reflect.DeepEqual(cursors, tc.cursors) {
+			t.Errorf("%v: server got cursors %q; want %q", desc, cursors, tc.cursors)
+		}
+	}
+}
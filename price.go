@@ -0,0 +1,72 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// price is an amount of money in an optional currency.
+type price struct {
+	amount   float64
+	currency string // ISO 4217 code like "EUR", or empty if unspecified
+}
+
+func (p price) String() string {
+	s := strconv.FormatFloat(p.amount, 'f', 2, 64)
+	if p.currency != "" {
+		s += " " + p.currency
+	}
+	return s
+}
+
+// parsePrice parses s, a string like "10", "9.99 EUR", or "usd 5".
+func parsePrice(s string) (price, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return price{}, fmt.Errorf("%q should be an amount optionally followed by a currency", s)
+	}
+	var p price
+	if len(fields) == 2 {
+		// Accept the currency either before or after the amount.
+		if _, err := strconv.ParseFloat(fields[0], 64); err != nil {
+			fields[0], fields[1] = fields[1], fields[0]
+		}
+		p.currency = strings.ToUpper(fields[1])
+		if len(p.currency) != 3 || strings.Trim(p.currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			return price{}, fmt.Errorf("%q isn't a three-letter currency code", fields[1])
+		}
+	}
+	var err error
+	if p.amount, err = strconv.ParseFloat(fields[0], 64); err != nil || p.amount < 0 {
+		return price{}, fmt.Errorf("%q isn't a non-negative amount", fields[0])
+	}
+	return p, nil
+}
+
+// priceResults returns the results whose minimum digital prices (from -details)
+// don't exceed max. If max specifies a currency, results in other currencies
+// are also omitted, since prices can't be compared across currencies.
+// Rejected results are reported to e.
+func priceResults(results []discover.Result, max price, e *explainer) []discover.Result {
+	var kept []discover.Result
+	for i := range results {
+		r := &results[i]
+		switch {
+		case r.Details == nil:
+			e.reject(r, "price unknown")
+		case max.currency != "" && r.Details.Currency != max.currency:
+			e.reject(r, "price in "+r.Details.Currency)
+		case r.Details.Price > max.amount:
+			e.reject(r, fmt.Sprintf("price %v exceeds %v", price{r.Details.Price, r.Details.Currency}, max))
+		default:
+			kept = append(kept, *r)
+		}
+	}
+	return kept
+}
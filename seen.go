@@ -0,0 +1,140 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// seenFileName is the name of the file within the default cache directory that
+// is used by -new-only if -seen-db is empty.
+const seenFileName = "seen.jsonl"
+
+// seenEntry describes a result that was printed by a previous run.
+type seenEntry struct {
+	URL       string    `json:"url"`
+	FirstSeen time.Time `json:"first_seen"`
+	Artist    string    `json:"artist,omitempty"`
+	Album     string    `json:"album,omitempty"`
+	Genre     string    `json:"genre,omitempty"`
+	Subgenre  string    `json:"subgenre,omitempty"`
+}
+
+// seenDB records the results that have been printed by the program.
+// It is stored as a file containing one JSON-encoded seenEntry per line,
+// which is only appended to. If path is empty, the database is only kept in
+// memory.
+type seenDB struct {
+	path    string
+	entries []seenEntry    // in the order in which they were added
+	urls    map[string]int // indexes into entries
+}
+
+// newMemorySeenDB returns an empty database that isn't saved to disk.
+func newMemorySeenDB() *seenDB {
+	return &seenDB{urls: make(map[string]int)}
+}
+
+// openSeenDB reads the database at p. An empty database is returned if the
+// file doesn't exist yet.
+func openSeenDB(p string) (*seenDB, error) {
+	db := &seenDB{path: p, urls: make(map[string]int)}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return db, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for ln := 1; sc.Scan(); ln++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e seenEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%v:%d: %v", p, ln, err)
+		}
+		if _, ok := db.urls[e.URL]; !ok {
+			db.urls[e.URL] = len(db.entries)
+			db.entries = append(db.entries, e)
+		}
+	}
+	return db, sc.Err()
+}
+
+// seen returns true if u is in the database.
+func (db *seenDB) seen(u string) bool {
+	_, ok := db.urls[u]
+	return ok
+}
+
+// firstSeen returns the time at which u was added to the database.
+// ok is false if u isn't in the database.
+func (db *seenDB) firstSeen(u string) (t time.Time, ok bool) {
+	i, ok := db.urls[u]
+	if !ok {
+		return time.Time{}, false
+	}
+	return db.entries[i].FirstSeen, true
+}
+
+// filterNew returns the results in rs that aren't in db. Rejected results are
+// reported to e.
+func (db *seenDB) filterNew(rs []discover.Result, e *explainer) []discover.Result {
+	return filterResults(rs, func(r *discover.Result) bool { return !db.seen(r.URL) }, e, "printed by previous run")
+}
+
+// add appends entries for the results that aren't already in the database,
+// using now as their first-seen time. The number of added entries is returned.
+func (db *seenDB) add(results []discover.Result, now time.Time) (int, error) {
+	var added []seenEntry
+	for _, r := range results {
+		if db.seen(r.URL) {
+			continue
+		}
+		e := seenEntry{URL: r.URL, FirstSeen: now, Artist: r.Artist, Album: r.Album,
+			Genre: r.Genre, Subgenre: r.Subgenre}
+		db.urls[e.URL] = len(db.entries)
+		db.entries = append(db.entries, e)
+		added = append(added, e)
+	}
+	if len(added) == 0 || db.path == "" {
+		return len(added), nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(db.path), 0755); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(db.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	// Write all entries at once so concurrent runs don't interleave lines.
+	var b []byte
+	for _, e := range added {
+		eb, err := json.Marshal(e)
+		if err != nil {
+			f.Close()
+			return 0, err
+		}
+		b = append(append(b, eb...), '\n')
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return 0, err
+	}
+	return len(added), f.Close()
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+func TestSeenDB(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "subdir", "seen.jsonl") // dir is created by add
+	db, err := openSeenDB(p)
+	if err != nil {
+		t.Fatal("openSeenDB on missing file failed:", err)
+	}
+
+	a := discover.Result{Artist: "A", Album: "One", URL: "https://a.bandcamp.com/album/one", Genre: "rock"}
+	b := discover.Result{Artist: "B", Album: "Two", URL: "https://b.bandcamp.com/album/two", Subgenre: "indie"}
+	c := discover.Result{Artist: "C", Album: "Three", URL: "https://c.bandcamp.com/album/three"}
+	t1 := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	if n, err := db.add([]discover.Result{a, b, a}, t1); err != nil || n != 2 {
+		t.Fatalf("add(a, b, a) = %d, %v; want 2, nil", n, err)
+	}
+	if n, err := db.add([]discover.Result{b, c}, t2); err != nil || n != 1 {
+		t.Fatalf("add(b, c) = %d, %v; want 1, nil", n, err)
+	}
+	if n, err := db.add(nil, t2); err != nil || n != 0 {
+		t.Fatalf("add(nil) = %d, %v; want 0, nil", n, err)
+	}
+
+	// Reopen the file and check that entries were saved.
+	if db, err = openSeenDB(p); err != nil {
+		t.Fatal("openSeenDB failed:", err)
+	}
+	for _, tc := range []struct {
+		r    discover.Result
+		want time.Time
+	}{{a, t1}, {b, t1}, {c, t2}} {
+		if got, ok := db.firstSeen(tc.r.URL); !ok || !got.Equal(tc.want) {
+			t.Errorf("firstSeen(%q) = %v, %v; want %v, true", tc.r.URL, got, ok, tc.want)
+		}
+	}
+	const missing = "https://d.bandcamp.com/album/four"
+	if db.seen(missing) {
+		t.Errorf("seen(%q) = true", missing)
+	}
+	if _, ok := db.firstSeen(missing); ok {
+		t.Errorf("firstSeen(%q) succeeded", missing)
+	}
+	want := []seenEntry{
+		{URL: a.URL, FirstSeen: t1, Artist: "A", Album: "One", Genre: "rock"},
+		{URL: b.URL, FirstSeen: t1, Artist: "B", Album: "Two", Subgenre: "indie"},
+		{URL: c.URL, FirstSeen: t2, Artist: "C", Album: "Three"},
+	}
+	if !reflect.DeepEqual(db.entries, want) {
+		t.Errorf("Reopened database has entries %+v; want %+v", db.entries, want)
+	}
+
+	// The file should contain one JSON object per line.
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != len(want) {
+		t.Errorf("%v has %d line(s); want %d:\n%s", p, len(lines), len(want), data)
+	}
+
+	// -new-only should only keep unseen results.
+	var exp bytes.Buffer
+	d := discover.Result{Artist: "D", Album: "Four", URL: missing}
+	got := db.filterNew([]discover.Result{a, d, c}, &explainer{w: &exp})
+	if !reflect.DeepEqual(got, []discover.Result{d}) {
+		t.Errorf("filterNew(a, d, c) = %+v; want %+v", got, []discover.Result{d})
+	}
+	if n := strings.Count(exp.String(), "printed by previous run"); n != 2 {
+		t.Errorf("filterNew explained %d rejection(s); want 2:\n%s", n, exp.String())
+	}
+}
+
+func TestOpenSeenDB_Errors(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "seen.jsonl")
+	const data = `{"url":"https://a.bandcamp.com/album/one","first_seen":"2023-01-02T03:04:05Z"}
+
+{"url":"https://a.bandcamp.com/album/one","first_seen":"2024-01-02T03:04:05Z"}
+`
+	if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Blank lines should be skipped and the first entry for a URL should be used.
+	db, err := openSeenDB(p)
+	if err != nil {
+		t.Fatal("openSeenDB failed:", err)
+	}
+	if got, _ := db.firstSeen("https://a.bandcamp.com/album/one"); got.Year() != 2023 {
+		t.Errorf("firstSeen returned %v; want time from first entry", got)
+	}
+
+	if err := os.WriteFile(p, []byte(data+"not json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openSeenDB(p); err == nil || !strings.Contains(err.Error(), p+":4:") {
+		t.Errorf("openSeenDB on bad file returned %v; want error for line 4", err)
+	}
+}
+
+func TestRunDiscover_SeenDBOptIn(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	p := defaultSeenDB()
+	if p == "" {
+		t.Fatal("No default seen database")
+	}
+
+	srv := newAPIServer(t, func(vals url.Values) ([]string, int, error) {
+		return []string{"a"}, 1, nil
+	})
+	run := func(args ...string) string {
+		args = append([]string{"-config", "", "-api-base", srv.URL, "-rate", "0", "-cache-ttl", "0"}, args...)
+		var status int
+		stdout, stderr := captureOutput(t, func() { status = runDiscover(args) })
+		if status != 0 {
+			t.Fatalf("runDiscover(%q) exited with %d: %s", args, status, stderr)
+		}
+		return stdout
+	}
+
+	// Plain runs shouldn't write the seen database.
+	run()
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Errorf("Plain run created %v (stat returned %v)", p, err)
+	}
+
+	// -new-only should use the default database.
+	if got, want := run("-new-only"), testAlbumURL("a")+"\n"; got != want {
+		t.Errorf("First -new-only run printed %q; want %q", got, want)
+	}
+	if _, err := os.Stat(p); err != nil {
+		t.Errorf("-new-only didn't write default database: %v", err)
+	}
+	if got := run("-new-only"); got != "" {
+		t.Errorf("Second -new-only run printed %q", got)
+	}
+
+	// An explicit -seen-db should be written even without -new-only.
+	explicit := filepath.Join(t.TempDir(), "seen.jsonl")
+	run("-seen-db", explicit)
+	if _, err := os.Stat(explicit); err != nil {
+		t.Errorf("-seen-db didn't write %v: %v", explicit, err)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// selfTest uses client to fetch the first page of top albums for all genres
+// and checks that it contains at least one album. It returns the number of
+// albums or an error describing the problem.
+func selfTest(ctx context.Context, client *discover.Client) (int, error) {
+	q := discover.Query{Genre: "all", Ranking: "top", Format: "all", Type: "album", Pages: 1}
+	res, err := client.Fetch(ctx, q)
+	if err != nil {
+		var se *discover.StatusError
+		var rle *discover.RateLimitError
+		switch {
+		case errors.As(err, &se):
+			return 0, fmt.Errorf("%v: got %v: %q", se.URL, se.Status, se.Body)
+		case errors.As(err, &rle) && !rle.Until.IsZero():
+			return 0, fmt.Errorf("%v: rate limited for %v", rle.URL, time.Until(rle.Until).Round(time.Second))
+		case errors.As(err, &rle):
+			return 0, fmt.Errorf("%v: rate limited", rle.URL)
+		}
+		return 0, err // bad JSON, network errors, etc.
+	}
+	if len(res) == 0 {
+		if u, err := client.QueryURL(q, 0); err == nil {
+			return 0, fmt.Errorf("%v: no albums returned", u)
+		}
+		return 0, errors.New("no albums returned")
+	}
+	return len(res), nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+func TestSelfTest(t *testing.T) {
+	const album = `{"primary_text":"Album","secondary_text":"Artist","id":1,` +
+		`"url_hints":{"subdomain":"artist","slug":"album","item_type":"a"}}`
+	for _, tc := range []struct {
+		desc   string
+		status int
+		body   string
+		n      int    // expected album count
+		err    string // substring of expected error
+	}{
+		{"success", http.StatusOK, `{"items":[` + album + `,` + album + `]}`, 2, ""},
+		{"bad status", http.StatusInternalServerError, "server broke", 0, `got 500 Internal Server Error: "server broke"`},
+		{"bad JSON", http.StatusOK, "<html>", 0, `bad JSON`},
+		{"empty", http.StatusOK, `{"items":[]}`, 0, "get_web?"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasPrefix(r.URL.Path, "/api/discover/") {
+					http.NotFound(w, r)
+					return
+				}
+				w.WriteHeader(tc.status)
+				fmt.Fprint(w, tc.body)
+			}))
+			defer srv.Close()
+
+			client := &discover.Client{HTTPClient: srv.Client(), BaseURL: srv.URL}
+			n, err := selfTest(context.Background(), client)
+			if tc.err == "" {
+				if err != nil || n != tc.n {
+					t.Errorf("selfTest returned %d, %v; want %d, nil", n, err, tc.n)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("selfTest returned %d, %v; want error containing %q", n, err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// feedPathPrefix is the path prefix of feeds served by the "serve" command.
+const feedPathPrefix = "/feed/"
+
+// runServe runs the "serve" command.
+func runServe(args []string) int {
+	fset := newFlagSet("serve", "[flag]...",
+		"Serves RSS feeds of Discover results at "+feedPathPrefix+"<genre>.xml and "+
+			feedPathPrefix+"<genre>/<subgenre>.xml, and JSON results at\n"+
+			apiDiscoverPath+"?genre=<genre>[/<subgenre>]&ranking=<ranking>&page=<page>.\n"+
+			"Prometheus metrics are exported at "+metricsPath+".")
+	addr := fset.String("addr", "localhost:8080", "Address to listen on")
+	refresh := fset.Duration("refresh", time.Hour, "Interval at which requested feeds are refreshed")
+	ranking := fset.String("ranking", "new", "Ranking to use (top, new, rec) for feeds and by default for the API")
+	format := fset.String("format", "all", "Format to use (all, digital, vinyl, cd, cassette) for feeds "+
+		"and by default for the API")
+	pages := fset.Int("pages", 1, "Number of pages to fetch for each feed")
+	cf := addClientFlags(fset)
+	if !parseFlags(fset, args) {
+		return 2
+	}
+	if fset.NArg() > 0 {
+		fset.Usage()
+		return 2
+	}
+	if *refresh < time.Minute {
+		fmt.Fprintln(os.Stderr, "-refresh must be at least a minute")
+		return 2
+	}
+	query := discover.Query{Genre: "all", Ranking: *ranking, Format: *format, Pages: *pages}
+	if err := query.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "Bad query:", err)
+		return 2
+	}
+	client, err := cf.newClient()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	capCacheTTL(client, *refresh)
+	if err := loadSavedGenres(*cf.cacheDir); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed reading saved genres:", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	m := newMetrics(client)
+	client.HTTPClient.Transport = m.instrumentTransport(client.HTTPClient.Transport)
+	fs := newFeedServer(client, query)
+	go fs.refreshLoop(ctx, *refresh)
+
+	mux := http.NewServeMux()
+	mux.Handle(feedPathPrefix, m.instrumentHandler("feed", fs))
+	mux.Handle(apiDiscoverPath, m.instrumentHandler("api",
+		&apiServer{client, discover.Query{Ranking: *ranking, Format: *format, Pages: 1}}))
+	mux.Handle(metricsPath, m)
+	srv := &http.Server{Addr: *addr, Handler: mux, BaseContext: func(net.Listener) context.Context { return ctx }}
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(sctx)
+	}()
+	fmt.Fprintf(os.Stderr, "Serving feeds at http://%v%v and API at http://%v%v\n",
+		*addr, feedPathPrefix, *addr, apiDiscoverPath)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, "Failed serving:", err)
+		return 1
+	}
+	return 0
+}
+
+// feedServer is an http.Handler that serves RSS feeds of Discover results.
+// Feeds are fetched when first requested and then periodically refreshed by
+// refreshLoop.
+type feedServer struct {
+	client *discover.Client
+	query  discover.Query // base query; Genre and Subgenre are overwritten
+
+	mu    sync.Mutex
+	feeds map[genreSpec]*cachedFeed
+}
+
+// cachedFeed holds the most-recently-generated version of a feed.
+type cachedFeed struct {
+	mu      sync.Mutex // held while fetching
+	data    []byte     // RSS document; nil if not fetched yet
+	fetched time.Time
+
+	// firstSeen contains the times at which the feed's current results first
+	// appeared in it, keyed by URL. It's used to date items so they don't
+	// appear to be new after each refresh.
+	firstSeen map[string]time.Time
+}
+
+func newFeedServer(client *discover.Client, query discover.Query) *feedServer {
+	return &feedServer{client: client, query: query, feeds: make(map[genreSpec]*cachedFeed)}
+}
+
+func (fs *feedServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	spec, err := parseFeedPath(req.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	fs.mu.Lock()
+	feed, ok := fs.feeds[spec]
+	if !ok {
+		feed = &cachedFeed{}
+		fs.feeds[spec] = feed
+	}
+	fs.mu.Unlock()
+
+	feed.mu.Lock()
+	if feed.data == nil {
+		if err := fs.update(req.Context(), spec, feed); err != nil {
+			feed.mu.Unlock()
+			fmt.Fprintf(os.Stderr, "Failed fetching %v: %v\n", spec, err)
+			http.Error(w, "Failed fetching results", http.StatusBadGateway)
+			return
+		}
+	}
+	data, fetched := feed.data, feed.fetched
+	feed.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	http.ServeContent(w, req, "", fetched, bytes.NewReader(data))
+}
+
+// update fetches results for spec and regenerates feed's document.
+// feed.mu must be held.
+func (fs *feedServer) update(ctx context.Context, spec genreSpec, feed *cachedFeed) error {
+	q := fs.query
+	q.Genre, q.Subgenre = spec.genre, spec.subgenre
+	results, err := fs.client.Fetch(ctx, q)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	firstSeen := make(map[string]time.Time, len(results))
+	for _, r := range results {
+		if t, ok := feed.firstSeen[r.URL]; ok {
+			firstSeen[r.URL] = t
+		} else {
+			firstSeen[r.URL] = now
+		}
+	}
+	var b bytes.Buffer
+	title := fmt.Sprintf("Bandcamp %v: %v", q.Ranking, spec)
+	lookup := func(u string) (time.Time, bool) {
+		t, ok := firstSeen[u]
+		return t, ok
+	}
+	if err := writeRSS(&b, title, results, lookup, now); err != nil {
+		return err
+	}
+	feed.data, feed.fetched, feed.firstSeen = b.Bytes(), now, firstSeen
+	return nil
+}
+
+// refreshLoop refreshes all previously-requested feeds every interval until
+// ctx is cancelled. Feeds that fail to refresh keep their old contents.
+func (fs *feedServer) refreshLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		fs.mu.Lock()
+		feeds := make(map[genreSpec]*cachedFeed, len(fs.feeds))
+		for spec, feed := range fs.feeds {
+			feeds[spec] = feed
+		}
+		fs.mu.Unlock()
+
+		for spec, feed := range feeds {
+			feed.mu.Lock()
+			err := fs.update(ctx, spec, feed)
+			feed.mu.Unlock()
+			if interrupted(ctx) {
+				return
+			} else if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed refreshing %v: %v\n", spec, err)
+			}
+		}
+	}
+}
+
+// parseFeedPath parses a request path like "/feed/electronic.xml" or
+// "/feed/electronic/techno.xml". Unknown genres are rejected.
+func parseFeedPath(p string) (genreSpec, error) {
+	rest := strings.TrimPrefix(p, feedPathPrefix)
+	if rest == p || !strings.HasSuffix(rest, ".xml") {
+		return genreSpec{}, errors.New("feed paths should look like " + feedPathPrefix + "<genre>[/<subgenre>].xml")
+	}
+	genre, subgenre, _ := strings.Cut(strings.ToLower(strings.TrimSuffix(rest, ".xml")), "/")
+	if canon, ok := resolveGenreAlias(genre); ok {
+		genre = canon
+	}
+	if err := discover.CheckGenre(genre, subgenre); err != nil {
+		return genreSpec{}, err
+	}
+	return genreSpec{genre, subgenre}, nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// streamFormats lists the -output values that can be written one result at a
+// time by -stream.
+var streamFormats = []string{"csv", "ids", "jsonl", "long", "markdown", "tsv", "url"}
+
+// streamQueries runs queries in order and passes each result to fn as soon as
+// it's received. If fn returns false or an error, no more results are fetched.
+// labels describes each query for error messages. Errors are printed to stderr
+// and the process's exit status is returned.
+func streamQueries(ctx context.Context, client *discover.Client, queries []discover.Query,
+	labels []string, failFast bool, fn func(r *discover.Result) (bool, error)) int {
+	var status int
+	for i, q := range queries {
+		qctx, cancel := context.WithCancel(ctx)
+		rch, ech := client.Stream(qctx, q)
+		var ferr error
+		more := true
+		for r := range rch {
+			if more, ferr = fn(&r); !more || ferr != nil {
+				cancel()
+				break
+			}
+		}
+		for range rch {
+			// Drain the channel so the fetching goroutine can exit.
+		}
+		err := <-ech
+		cancel()
+
+		switch {
+		case ferr != nil:
+			fmt.Fprintln(os.Stderr, "Failed writing output:", ferr)
+			return 1
+		case !more:
+			return status
+		case interrupted(ctx):
+			return interruptedStatus
+		case err != nil && failFast:
+			fmt.Fprintf(os.Stderr, "Failed getting URLs for %v: %v\n", labels[i], err)
+			return fetchErrorStatus(err)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Failed getting URLs for %v: %v\n", labels[i], err)
+			status = partialFailureStatus
+		}
+	}
+	return status
+}
+
+// streamConfig configures the function returned by streamWriter.
+type streamConfig struct {
+	dedup   *deduper
+	seen    *seenDB // may be nil
+	newOnly bool    // skip results in seen
+	limit   int     // maximum results to write, or 0 for no limit
+	exp     *explainer
+	tmpl    *template.Template // used instead of format if non-nil
+	format  string             // from streamFormats
+	opts    *outputOptions
+	enc     string // from outputEncodings
+}
+
+// streamWriter returns a function for streamQueries that filters each result
+// and writes it to stdout as configured by cfg.
+func streamWriter(cfg streamConfig) func(r *discover.Result) (bool, error) {
+	var written int
+	return func(r *discover.Result) (bool, error) {
+		if !cfg.dedup.keep(r) {
+			cfg.exp.reject(r, "already seen")
+			return true, nil
+		}
+		if cfg.newOnly && cfg.seen.seen(r.URL) {
+			cfg.exp.reject(r, "printed by previous run")
+			return true, nil
+		}
+		results := []discover.Result{*r}
+		cfg.exp.keep(results)
+
+		var b bytes.Buffer
+		var err error
+		if cfg.tmpl != nil {
+			err = writeTemplate(&b, cfg.tmpl, results)
+		} else {
+			err = writeResults(&b, cfg.format, results, cfg.opts)
+		}
+		if err != nil {
+			return false, err
+		}
+		out := b.Bytes()
+		if cfg.tmpl != nil || cfg.format != "jsonl" { // JSON must be UTF-8 (RFC 8259)
+			if out, err = encodeOutput(out, cfg.enc); err != nil {
+				return false, err
+			}
+		}
+		if _, err := os.Stdout.Write(out); err != nil {
+			return false, err
+		}
+		// Only write the table header and byte order mark once.
+		cfg.opts.noHeader = true
+		if cfg.enc == "utf-8-bom" {
+			cfg.enc = "utf-8"
+		}
+
+		// Record each result as soon as it's written so interrupted runs
+		// don't print it again.
+		if cfg.seen != nil {
+			if _, err := cfg.seen.add(results, time.Now()); err != nil {
+				return false, fmt.Errorf("updating seen database: %v", err)
+			}
+		}
+		written++
+		return cfg.limit == 0 || written < cfg.limit, nil
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// runTag runs the "tag" command.
+func runTag(args []string) int {
+	fset := newFlagSet("tag", "[flag]... <tag>...",
+		"Prints albums from Bandcamp tag pages (e.g. https://bandcamp.com/tag/dungeon-synth).\n"+
+			"Multiple tags only match albums with all of them. Any tag can be used, not just genres.")
+	sort := fset.String("sort", "pop", "Sort order ("+strings.Join(discover.TagSorts, ", ")+")")
+	format := fset.String("format", "all", "Format to display (all, digital, vinyl, cd, cassette)")
+	locationFlag := fset.String("location", "", `Place name or GeoNames ID to find artists from (e.g. "berlin")`)
+	pages := fset.Int("pages", 1, "Number of pages to fetch")
+	allPages := fset.Bool("all-pages", false, "Fetch pages until no more results are returned")
+	limit := fset.Int("limit", 0, "Maximum number of results to print (0 for no limit)")
+	output := fset.String("output", "url", "Output format ("+strings.Join(sortedKeys(outputFormats), ", ")+")")
+	cf := addClientFlags(fset)
+	if !parseFlags(fset, args) {
+		return 2
+	}
+	if fset.NArg() == 0 {
+		fset.Usage()
+		return 2
+	}
+	if _, ok := outputFormats[*output]; !ok {
+		fmt.Fprintln(os.Stderr, "-output must be one of:", strings.Join(sortedKeys(outputFormats), ", "))
+		return 2
+	}
+	if *pages < 1 || *limit < 0 {
+		fmt.Fprintln(os.Stderr, "-pages must be positive and -limit must be non-negative")
+		return 2
+	}
+	query := discover.TagQuery{Sort: *sort, Format: *format, Pages: *pages, Limit: *limit}
+	if *allPages {
+		query.Pages = discover.AllPages
+	}
+	for _, arg := range fset.Args() {
+		query.Tags = append(query.Tags, normalizeTag(arg))
+	}
+	if err := query.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "Bad query:", err)
+		return 2
+	}
+	client, err := cf.newClient()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *locationFlag != "" {
+		loc, err := resolveLocation(ctx, client, *locationFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed resolving location:", err)
+			return 1
+		}
+		query.Location = loc.ID
+	}
+	results, err := client.FetchTag(ctx, query)
+	if interrupted(ctx) {
+		return interruptedStatus
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed getting URLs:", err)
+		return fetchErrorStatus(err)
+	}
+	results = newDeduper(dedupKeys["url"]).filter(results)
+	if *limit > 0 && len(results) > *limit {
+		results = results[:*limit]
+	}
+	title := fmt.Sprintf("Bandcamp tag: %v (%v, %v)", strings.Join(query.Tags, ", "), query.Sort, query.Format)
+	opts := outputOptions{title: title, warnings: os.Stderr}
+	if cols := defaultColumns[*output]; cols != "" {
+		opts.columns, _ = parseColumns(cols)
+	}
+	if err := writeResults(os.Stdout, *output, results, &opts); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed writing output:", err)
+		return 1
+	}
+	return 0
+}
+
+// normalizeTag converts s (e.g. "Dungeon Synth") to the form used in
+// Bandcamp tag URLs (e.g. "dungeon-synth").
+func normalizeTag(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), "-")
+}
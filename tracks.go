@@ -0,0 +1,51 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// trackFormats contains -output values that list individual tracks.
+var trackFormats = []string{"m3u", "xspf"}
+
+// resolveTracks fetches the album pages of results and returns their tracks
+// keyed by album URL, with at most concurrency requests issued simultaneously.
+// Errors for individual albums are returned separately.
+func resolveTracks(ctx context.Context, client *discover.Client, results []discover.Result,
+	concurrency int) (map[string][]discover.Track, []error) {
+	tracks := make([][]discover.Track, len(results))
+	errs := make([]error, len(results))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			tracks[i], errs[i] = client.AlbumTracks(ctx, results[i].URL)
+		}(i)
+	}
+	wg.Wait()
+
+	all := make(map[string][]discover.Track, len(results))
+	var failed []error
+	for i, r := range results {
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+		} else {
+			all[r.URL] = tracks[i]
+		}
+	}
+	return all, failed
+}
@@ -0,0 +1,75 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+// validateResults sends HEAD requests for the URLs in results, with at most
+// concurrency requests issued simultaneously. The returned slice contains
+// the response status code for each result, or 0 if the request failed.
+func validateResults(ctx context.Context, client *discover.Client, results []discover.Result,
+	concurrency int) []int {
+	statuses := make([]int, len(results))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+			statuses[i], _ = client.CheckURL(ctx, results[i].URL)
+		}(i)
+	}
+	wg.Wait()
+	return statuses
+}
+
+// liveResults returns the results from results with 200 statuses in statuses.
+// Rejected results are reported to e.
+func liveResults(results []discover.Result, statuses []int, e *explainer) []discover.Result {
+	var live []discover.Result
+	for i, r := range results {
+		switch statuses[i] {
+		case http.StatusOK:
+			live = append(live, r)
+		case 0:
+			e.reject(&results[i], "URL check failed")
+		default:
+			e.reject(&results[i], fmt.Sprintf("URL returned %d", statuses[i]))
+		}
+	}
+	return live
+}
+
+// printValidationSummary writes a summary of statuses to w.
+func printValidationSummary(w io.Writer, statuses []int) {
+	var ok, notFound, other, failed int
+	for _, st := range statuses {
+		switch st {
+		case http.StatusOK:
+			ok++
+		case http.StatusNotFound:
+			notFound++
+		case 0:
+			failed++
+		default:
+			other++
+		}
+	}
+	fmt.Fprintf(w, "Validated %d URL(s): %d OK, %d not found, %d other status, %d failed\n",
+		len(statuses), ok, notFound, other, failed)
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 Daniel Erat.
+// All rights reserved.
+
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"math"
+
+	"github.com/derat/bandcamp-discover/pkg/discover"
+)
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version string      `xml:"version,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location string `xml:"location,omitempty"`
+	Title    string `xml:"title,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	Album    string `xml:"album,omitempty"`
+	TrackNum int    `xml:"trackNum,omitempty"`
+	Duration int64  `xml:"duration,omitempty"` // milliseconds
+	Image    string `xml:"image,omitempty"`
+	Info     string `xml:"info,omitempty"` // album URL
+}
+
+// writeXSPF writes results to w as an XSPF playlist with the supplied title.
+// Streamable tracks from tracks (keyed by album URL) are listed; results
+// without tracks are listed as a single entry without a location.
+func writeXSPF(w io.Writer, title string, results []discover.Result, tracks map[string][]discover.Track) error {
+	pl := xspfPlaylist{Version: "1", Title: title}
+	for i := range results {
+		r := &results[i]
+		ts, ok := tracks[r.URL]
+		if !ok {
+			pl.Tracks = append(pl.Tracks, xspfTrack{
+				Title:   r.Album,
+				Creator: r.Artist,
+				Album:   r.Album,
+				Image:   r.ArtURL(),
+				Info:    r.URL,
+			})
+			continue
+		}
+		for _, t := range ts {
+			if t.StreamURL == "" {
+				continue
+			}
+			pl.Tracks = append(pl.Tracks, xspfTrack{
+				Location: t.StreamURL,
+				Title:    t.Title,
+				Creator:  t.Artist,
+				Album:    r.Album,
+				TrackNum: t.Num,
+				Duration: int64(math.Round(t.Duration * 1000)),
+				Image:    r.ArtURL(),
+				Info:     r.URL,
+			})
+		}
+	}
+	return writeXML(w, pl)
+}